@@ -0,0 +1,109 @@
+/*
+ * Copyright 2023 steadybit GmbH. All rights reserved.
+ */
+
+package config
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/steadybit/extension-newrelic/types"
+)
+
+const nrqlConditionsSearchQuery = `{actor {account(id: %d) {alerts {nrqlConditionsSearch(searchCriteria: {%s}%s) {nextCursor nrqlConditions {id name enabled policyId type entityGuid runbookUrl nrql {query}}}}}}}`
+
+// nrqlConditionUpdateMutations are the mutations updating NRQL conditions, per condition type.
+var nrqlConditionUpdateMutations = map[string]string{
+	"STATIC":   "alertsNrqlConditionStaticUpdate",
+	"BASELINE": "alertsNrqlConditionBaselineUpdate",
+}
+
+const nrqlConditionUpdateMutation = `mutation {%s(accountId: %d, id: %s, condition: {enabled: %t}) {id name enabled policyId type}}`
+
+// SearchNrqlConditions returns the NRQL alert conditions of an account with the given id or of
+// the given policy, or all of them if neither is given, following the result cursor.
+func (s *Specification) SearchNrqlConditions(_ context.Context, accountId int64, conditionId string, policyId string) ([]types.NrqlCondition, error) {
+	var criteria []string
+	if conditionId != "" {
+		criteria = append(criteria, fmt.Sprintf("id: %s", graphQlString(conditionId)))
+	}
+	if policyId != "" {
+		criteria = append(criteria, fmt.Sprintf("policyId: %s", graphQlString(policyId)))
+	}
+
+	conditions := make([]types.NrqlCondition, 0)
+	cursor := ""
+	for {
+		result, errs, err := s.graphQl("nrqlConditionsSearch", fmt.Sprintf(nrqlConditionsSearchQuery, accountId, strings.Join(criteria, ", "), cursor))
+		if err != nil {
+			return nil, err
+		}
+		if result.Data == nil || result.Data.Actor == nil || result.Data.Actor.Account == nil || result.Data.Actor.Account.Alerts == nil || result.Data.Actor.Account.Alerts.NrqlConditionsSearch == nil {
+			if errs != "" {
+				return nil, fmt.Errorf("errors returned by the New Relic API: %s", errs)
+			}
+			return conditions, nil
+		}
+		search := result.Data.Actor.Account.Alerts.NrqlConditionsSearch
+		conditions = append(conditions, search.NrqlConditions...)
+		if search.NextCursor == nil || *search.NextCursor == "" {
+			return conditions, nil
+		}
+		cursor = fmt.Sprintf(", cursor: %s", graphQlString(*search.NextCursor))
+	}
+}
+
+const policiesSearchQuery = `{actor {account(id: %d) {alerts {policiesSearch%s {nextCursor policies {id name incidentPreference accountId}}}}}}`
+
+// GetAlertPolicies returns all alert policies of an account, following the result cursor.
+func (s *Specification) GetAlertPolicies(_ context.Context, accountId int64) ([]types.AlertPolicy, error) {
+	policies := make([]types.AlertPolicy, 0)
+	cursor := ""
+	for {
+		result, errs, err := s.graphQl("policiesSearch", fmt.Sprintf(policiesSearchQuery, accountId, cursor))
+		if err != nil {
+			return nil, err
+		}
+		if result.Data == nil || result.Data.Actor == nil || result.Data.Actor.Account == nil || result.Data.Actor.Account.Alerts == nil || result.Data.Actor.Account.Alerts.PoliciesSearch == nil {
+			if errs != "" {
+				return nil, fmt.Errorf("errors returned by the New Relic API: %s", errs)
+			}
+			return policies, nil
+		}
+		search := result.Data.Actor.Account.Alerts.PoliciesSearch
+		policies = append(policies, search.Policies...)
+		if search.NextCursor == nil || *search.NextCursor == "" {
+			return policies, nil
+		}
+		cursor = fmt.Sprintf("(cursor: %s)", graphQlString(*search.NextCursor))
+	}
+}
+
+// SetNrqlConditionEnabled enables or disables a NRQL alert condition.
+func (s *Specification) SetNrqlConditionEnabled(_ context.Context, accountId int64, condition types.NrqlCondition, enabled bool) error {
+	mutation, ok := nrqlConditionUpdateMutations[condition.Type]
+	if !ok {
+		return fmt.Errorf("conditions of type %s are not supported", condition.Type)
+	}
+
+	result, errs, err := s.graphQl(mutation, fmt.Sprintf(nrqlConditionUpdateMutation, mutation, accountId, graphQlString(condition.Id), enabled))
+	if err != nil {
+		return err
+	}
+	var updated *types.NrqlCondition
+	if result.Data != nil {
+		updated = result.Data.AlertsNrqlConditionStaticUpdate
+		if updated == nil {
+			updated = result.Data.AlertsNrqlConditionBaselineUpdate
+		}
+	}
+	if updated == nil {
+		if errs != "" {
+			return fmt.Errorf("errors returned by the New Relic API: %s", errs)
+		}
+		return fmt.Errorf("condition %s not updated", condition.Id)
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+/*
+ * Copyright 2023 steadybit GmbH. All rights reserved.
+ */
+
+package config
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/steadybit/extension-newrelic/types"
+)
+
+// changeTrackingCategory and changeTrackingType classify the recorded changes. Chaos
+// experiments are operational changes without a more specific predefined type.
+const (
+	changeTrackingCategory = "Operational"
+	changeTrackingType     = "Other"
+)
+
+const changeTrackingCreateEventMutation = `mutation {changeTrackingCreateEvent(changeTrackingEvent: {` +
+	`categoryAndTypeData: {kind: {category: %s, type: %s}}, entitySearch: {query: %s}, ` +
+	`shortDescription: %s, description: %s, user: %s, groupId: %s, timestamp: %d, customAttributes: {%s}}) ` +
+	`{changeTrackingEvent {changeTrackingId}}}`
+
+// CreateChangeTrackingEvent records a change on the timeline of the given entities, where it
+// shows up in the change tracking UI and on the entities' charts.
+func (s *Specification) CreateChangeTrackingEvent(_ context.Context, event types.ChangeTrackingEvent) error {
+	guids := make([]string, 0, len(event.EntityGuids))
+	for _, guid := range event.EntityGuids {
+		guids = append(guids, NrqlString(guid))
+	}
+	entitySearch := fmt.Sprintf("id IN (%s)", strings.Join(guids, ", "))
+
+	mutation := fmt.Sprintf(changeTrackingCreateEventMutation,
+		graphQlString(changeTrackingCategory),
+		graphQlString(changeTrackingType),
+		graphQlString(entitySearch),
+		graphQlString(event.ShortDescription),
+		graphQlString(event.Description),
+		graphQlString(event.User),
+		graphQlString(event.GroupId),
+		event.Timestamp.UnixMilli(),
+		graphQlObjectFields(event.CustomAttributes),
+	)
+
+	result, errs, err := s.graphQl("changeTrackingCreateEvent", mutation)
+	if err != nil {
+		return err
+	}
+	if result.Data == nil || result.Data.ChangeTrackingCreateEvent == nil || result.Data.ChangeTrackingCreateEvent.ChangeTrackingEvent == nil {
+		if errs != "" {
+			return fmt.Errorf("errors returned by the New Relic API: %s", errs)
+		}
+		return fmt.Errorf("no change tracking event created")
+	}
+	return nil
+}
+
+// graphQlObjectFields renders a map as the fields of a GraphQL object literal, sorted by key.
+// Keys must be valid GraphQL names.
+func graphQlObjectFields(values map[string]string) string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	fields := make([]string, 0, len(keys))
+	for _, key := range keys {
+		fields = append(fields, fmt.Sprintf("%s: %s", key, graphQlString(values[key])))
+	}
+	return strings.Join(fields, ", ")
+}
@@ -6,6 +6,7 @@ package config
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
 	"encoding/json"
 	"errors"
@@ -13,6 +14,8 @@ import (
 	"github.com/kelseyhightower/envconfig"
 	"github.com/rs/zerolog/log"
 	"github.com/steadybit/extension-newrelic/types"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
 	"io"
 	"net/http"
 	"strings"
@@ -31,6 +34,58 @@ type Specification struct {
 	InsightsCollectorApiBaseUrl string `json:"insightsCollectorApiBaseUrl" split_words:"true" required:"true"`
 	// The New Relic API Key of type "INGEST - LICENSE"
 	InsightsCollectorApiKey string `json:"insightsCollectorApiKey" split_words:"true" required:"true"`
+	// The New Relic Log API Base Url, like 'https://log-api.newrelic.com' or 'https://log-api.eu.newrelic.com'
+	LogApiBaseUrl string `json:"logApiBaseUrl" split_words:"true" required:"false" default:"https://log-api.newrelic.com"`
+	// The New Relic OTLP endpoint, like 'https://otlp.nr-data.net' or 'https://otlp.eu01.nr-data.net'
+	OtlpApiBaseUrl string `json:"otlpApiBaseUrl" split_words:"true" required:"false" default:"https://otlp.nr-data.net"`
+	// The New Relic Metric API Base Url, like 'https://metric-api.newrelic.com' or 'https://metric-api.eu.newrelic.com'
+	MetricApiBaseUrl string `json:"metricApiBaseUrl" split_words:"true" required:"false" default:"https://metric-api.newrelic.com"`
+	// Directory to persist not yet delivered events in, so they survive a restart. Events are only kept in memory if empty.
+	EventSpoolDir string `json:"eventSpoolDir" split_words:"true" required:"false"`
+	// Maximum time to retry delivering an event before it is dropped
+	EventMaxAge time.Duration `json:"eventMaxAge" split_words:"true" required:"false" default:"1h"`
+	// Maximum number of events waiting for delivery. Further events are dropped while the queue is full.
+	EventQueueSize int `json:"eventQueueSize" split_words:"true" required:"false" default:"1000"`
+	// Number of workers delivering events concurrently
+	EventDeliveryWorkers int `json:"eventDeliveryWorkers" split_words:"true" required:"false" default:"2"`
+	// Maximum number of events sent to an account in one request
+	EventBatchSize int `json:"eventBatchSize" split_words:"true" required:"false" default:"100"`
+	// Maximum time to wait for further events before a batch is sent
+	EventFlushInterval time.Duration `json:"eventFlushInterval" split_words:"true" required:"false" default:"1s"`
+	// Accounts to send the events of a team's experiments to, like 'checkout:1234;5678,payment:9012' keyed by team key
+	EventTeamAccounts map[string]string `json:"eventTeamAccounts" split_words:"true" required:"false"`
+	// Accounts to send the events of an environment's experiments to, like 'Production:1234,Staging:5678' keyed by environment name
+	EventEnvironmentAccounts map[string]string `json:"eventEnvironmentAccounts" split_words:"true" required:"false"`
+	// Send events to all accounts if no account could be determined from the target, team or environment
+	EventFanOutToAllAccounts bool `json:"eventFanOutToAllAccounts" split_words:"true" required:"false" default:"false"`
+	// Event types to send, like ExperimentStarted and ExperimentEnded. All are sent if empty
+	EventTypes []string `json:"eventTypes" split_words:"true" required:"false"`
+	// Environment names to send events for. Events of all environments are sent if empty
+	EventEnvironments []string `json:"eventEnvironments" split_words:"true" required:"false"`
+	// Team keys to send events for. Events of all teams are sent if empty
+	EventTeams []string `json:"eventTeams" split_words:"true" required:"false"`
+	// Regular expression the whole experiment key must match for events to be sent
+	EventExperimentKeyPattern string `json:"eventExperimentKeyPattern" split_words:"true" required:"false"`
+	// Additionally publish running experiments and active attacks as gauges to the Metric API
+	EventMetrics bool `json:"eventMetrics" split_words:"true" required:"false" default:"false"`
+	// Interval in which the gauges of running experiments and active attacks are reported
+	EventMetricsInterval time.Duration `json:"eventMetricsInterval" split_words:"true" required:"false" default:"30s"`
+	// Additionally export experiment executions as traces to the OTLP endpoint
+	EventTraces bool `json:"eventTraces" split_words:"true" required:"false" default:"false"`
+	// Tag the entities under attack with the experiment key for the duration of the attack
+	EventEntityTags bool `json:"eventEntityTags" split_words:"true" required:"false" default:"false"`
+	// Additionally forward experiment log lines to the Log API
+	EventLogs bool `json:"eventLogs" split_words:"true" required:"false" default:"false"`
+	// Kinds of steps to send StepEnded events for: attack, check, load_test, other and wait
+	EventStepKinds []string `json:"eventStepKinds" split_words:"true" required:"false"`
+	// Target attributes to add to events, like 'k8s.cluster-name:clusterName,k8s.namespace:namespace' mapping target to event attribute names
+	EventTargetAttributes map[string]string `json:"eventTargetAttributes" split_words:"true" required:"false"`
+	// Static attributes to add to all events, like 'source:steadybit-prod'
+	EventStaticAttributes map[string]string `json:"eventStaticAttributes" split_words:"true" required:"false"`
+	// Additionally record attacks and experiments as change tracking events on the attacked entities
+	EventChangeTracking bool `json:"eventChangeTracking" split_words:"true" required:"false" default:"false"`
+	// The Steadybit platform url, like 'https://platform.steadybit.com', used to link experiment executions from events
+	SteadybitBaseUrl string `json:"steadybitBaseUrl" split_words:"true" required:"false"`
 }
 
 var (
@@ -55,6 +110,19 @@ func graphQlString(value string) string {
 	return string(encoded)
 }
 
+// graphQlStringList renders values as a comma separated list of GraphQL string literals,
+// to be embedded in a list argument like `guids: [%s]`.
+func graphQlStringList(values []string) string {
+	var sb strings.Builder
+	for i, value := range values {
+		if i > 0 {
+			sb.WriteString(",")
+		}
+		sb.WriteString(graphQlString(value))
+	}
+	return sb.String()
+}
+
 // graphQlErrors renders the GraphQL-level errors of a response as a single string, or
 // "" if there are none. New Relic answers authorization problems ("user's role doesn't
 // permit this action") and field timeouts with HTTP 200 and a populated `errors` array,
@@ -174,7 +242,9 @@ func (s *Specification) GetAccountIds(_ context.Context) ([]int64, error) {
 	}
 }
 
-const workloadQuery = `{actor {account(id: %d){workload {collections {guid name permalink}}}}}`
+// workloadQuery also asks for the owning and the scope accounts: a workload is listed by every
+// account that can see it, but belongs to exactly one of them.
+const workloadQuery = `{actor {account(id: %d){workload {collections {guid name permalink account {id} scopeAccounts {accountIds}}}}}}`
 
 func (s *Specification) GetWorkloads(_ context.Context, accountId int64) ([]types.Workload, error) {
 	url := fmt.Sprintf("%s/graphql", s.ApiBaseUrl)
@@ -399,35 +469,198 @@ func (s *Specification) GetIncidents(_ context.Context, incidentPriorityFilter [
 	}
 }
 
-func (s *Specification) PostEvent(_ context.Context, event *types.EventIngest, accountId int64) error {
+// PostEvents sends a batch of events to an account with a single gzip-compressed request.
+// The Event API accepts up to 1MB of compressed payload per request.
+func (s *Specification) PostEvents(_ context.Context, events []types.EventIngest, accountId int64) error {
 	url := fmt.Sprintf("%s/v1/accounts/%d/events", s.InsightsCollectorApiBaseUrl, accountId)
 
-	objects := []types.EventIngest{*event}
-
-	b, err := json.Marshal(objects)
+	b, err := json.Marshal(events)
 	if err != nil {
 		log.Error().Err(err).Msgf("Failed to marshal request")
 		return err
 	}
 
-	responseBody, response, err := s.do(url, "POST", b, s.InsightsCollectorApiKey)
+	responseBody, response, err := s.send(url, "POST", jsonContentType, b, s.InsightsCollectorApiKey, true)
 	if err != nil {
-		log.Error().Err(err).Msgf("Failed to post event to New Relic. Full response %+v", string(responseBody))
+		log.Error().Err(err).Msgf("Failed to post events to New Relic. Full response %+v", string(responseBody))
 		return err
 	}
 
 	if response.StatusCode != 200 {
 		log.Error().Int("code", response.StatusCode).Err(err).Msgf("Unexpected response %+v", string(responseBody))
-		return errors.New("unexpected response code")
+		return &UnexpectedStatusError{StatusCode: response.StatusCode}
+	}
+
+	return nil
+}
+
+// PostMetrics sends metrics with a single gzip-compressed request. Unlike events, metrics
+// are stored in the account of the license key.
+func (s *Specification) PostMetrics(_ context.Context, metrics []types.Metric) error {
+	url := fmt.Sprintf("%s/metric/v1", s.MetricApiBaseUrl)
+
+	b, err := json.Marshal([]types.MetricData{{Metrics: metrics}})
+	if err != nil {
+		log.Error().Err(err).Msgf("Failed to marshal request")
+		return err
+	}
+
+	responseBody, response, err := s.send(url, "POST", jsonContentType, b, s.InsightsCollectorApiKey, true)
+	if err != nil {
+		log.Error().Err(err).Msgf("Failed to post metrics to New Relic. Full response %+v", string(responseBody))
+		return err
+	}
+
+	if response.StatusCode != 202 {
+		log.Error().Int("code", response.StatusCode).Msgf("Unexpected response %+v", string(responseBody))
+		return &UnexpectedStatusError{StatusCode: response.StatusCode}
+	}
+
+	return nil
+}
+
+// logSource marks the logs forwarded by the extension.
+const logSource = "steadybit"
+
+// PostLogs sends log entries with a single gzip-compressed request. Like metrics, logs are
+// stored in the account of the license key.
+func (s *Specification) PostLogs(_ context.Context, logs []types.LogEntry) error {
+	url := fmt.Sprintf("%s/log/v1", s.LogApiBaseUrl)
+
+	b, err := json.Marshal([]types.LogData{{
+		Common: types.LogCommon{Attributes: map[string]any{"logtype": logSource}},
+		Logs:   logs,
+	}})
+	if err != nil {
+		log.Error().Err(err).Msgf("Failed to marshal request")
+		return err
+	}
+
+	responseBody, response, err := s.send(url, "POST", jsonContentType, b, s.InsightsCollectorApiKey, true)
+	if err != nil {
+		log.Error().Err(err).Msgf("Failed to post logs to New Relic. Full response %+v", string(responseBody))
+		return err
+	}
+
+	if response.StatusCode != 202 {
+		log.Error().Int("code", response.StatusCode).Msgf("Unexpected response %+v", string(responseBody))
+		return &UnexpectedStatusError{StatusCode: response.StatusCode}
+	}
+
+	return nil
+}
+
+// PostTraces sends spans to the OTLP endpoint with a single gzip-compressed request. Like
+// metrics, traces are stored in the account of the license key.
+func (s *Specification) PostTraces(_ context.Context, traces *tracepb.TracesData) error {
+	url := fmt.Sprintf("%s/v1/traces", s.OtlpApiBaseUrl)
+
+	// TracesData is wire compatible with the ExportTraceServiceRequest expected by the endpoint.
+	b, err := proto.Marshal(traces)
+	if err != nil {
+		log.Error().Err(err).Msgf("Failed to marshal request")
+		return err
+	}
+
+	responseBody, response, err := s.send(url, "POST", protobufContentType, b, s.InsightsCollectorApiKey, true)
+	if err != nil {
+		log.Error().Err(err).Msgf("Failed to post traces to New Relic.")
+		return err
+	}
+
+	if response.StatusCode != 200 {
+		log.Error().Int("code", response.StatusCode).Msgf("Unexpected response %+v", string(responseBody))
+		return &UnexpectedStatusError{StatusCode: response.StatusCode}
 	}
 
 	return nil
 }
 
+// UnexpectedStatusError is returned when New Relic answers a request with a status code
+// other than 200, so callers can tell rejected requests from temporary failures.
+type UnexpectedStatusError struct {
+	StatusCode int
+}
+
+func (e *UnexpectedStatusError) Error() string {
+	return fmt.Sprintf("unexpected response code %d", e.StatusCode)
+}
+
+// Retryable reports whether the request may succeed when sent again. Client errors other
+// than timeouts and rate limiting won't.
+func (e *UnexpectedStatusError) Retryable() bool {
+	if e.StatusCode == http.StatusRequestTimeout || e.StatusCode == http.StatusTooManyRequests {
+		return true
+	}
+	return e.StatusCode < 400 || e.StatusCode >= 500
+}
+
+// graphQl runs a NerdGraph query and decodes the response. GraphQL-level errors are logged
+// and returned as a string rather than an error, since New Relic may still answer with
+// partial data the caller can use - see graphQlErrors.
+func (s *Specification) graphQl(operation string, query string) (*types.GraphQlResponse, string, error) {
+	url := fmt.Sprintf("%s/graphql", s.ApiBaseUrl)
+
+	responseBody, response, err := s.do(url, "POST", graphQlRequestBody(query), s.ApiKey)
+	if err != nil {
+		log.Error().Err(err).Str("operation", operation).Msgf("Failed to query New Relic. Full response %+v", string(responseBody))
+		return nil, "", err
+	}
+
+	if response.StatusCode != 200 {
+		log.Error().Int("code", response.StatusCode).Str("operation", operation).Msgf("Unexpected response %+v", string(responseBody))
+		return nil, "", errors.New("unexpected response code")
+	}
+
+	if responseBody == nil {
+		log.Error().Str("operation", operation).Msgf("Empty response body")
+		return nil, "", errors.New("empty response body")
+	}
+
+	var result types.GraphQlResponse
+	err = json.Unmarshal(responseBody, &result)
+	if err != nil {
+		log.Error().Err(err).Str("body", string(responseBody)).Msgf("Failed to parse body")
+		return nil, "", err
+	}
+
+	errs := graphQlErrors(&result)
+	if errs != "" {
+		log.Warn().Str("operation", operation).Str("errors", errs).Msg("New Relic API returned errors.")
+	}
+	return &result, errs, nil
+}
+
 func (s *Specification) do(url string, method string, body []byte, apiKey string) ([]byte, *http.Response, error) {
+	return s.send(url, method, jsonContentType, body, apiKey, false)
+}
+
+const (
+	jsonContentType     = "application/json; charset=UTF-8"
+	protobufContentType = "application/x-protobuf"
+)
+
+// send executes a request, optionally gzip-compressing the body.
+func (s *Specification) send(url string, method string, contentType string, body []byte, apiKey string, compress bool) ([]byte, *http.Response, error) {
 	log.Debug().Str("url", url).Str("method", method).Msg("Requesting New Relic API")
-	if body != nil {
+	if body != nil && contentType == jsonContentType {
 		log.Debug().Int("len", len(body)).Str("body", string(body)).Msg("Request body")
+	} else if body != nil {
+		log.Debug().Int("len", len(body)).Msg("Request body")
+	}
+
+	if body != nil && compress {
+		var compressed bytes.Buffer
+		writer := gzip.NewWriter(&compressed)
+		if _, err := writer.Write(body); err != nil {
+			log.Error().Err(err).Msgf("Failed to compress request body")
+			return nil, nil, err
+		}
+		if err := writer.Close(); err != nil {
+			log.Error().Err(err).Msgf("Failed to compress request body")
+			return nil, nil, err
+		}
+		body = compressed.Bytes()
 	}
 
 	var bodyReader io.Reader
@@ -439,7 +672,10 @@ func (s *Specification) do(url string, method string, body []byte, apiKey string
 		log.Error().Err(err).Msgf("Failed to create request")
 		return nil, nil, err
 	}
-	request.Header.Set("Content-Type", "application/json; charset=UTF-8")
+	request.Header.Set("Content-Type", contentType)
+	if body != nil && compress {
+		request.Header.Set("Content-Encoding", "gzip")
+	}
 	request.Header.Set("API-Key", apiKey)
 
 	response, err := httpClient.Do(request)
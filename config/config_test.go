@@ -5,6 +5,7 @@
 package config
 
 import (
+	"compress/gzip"
 	"context"
 	"encoding/json"
 	"io"
@@ -13,6 +14,8 @@ import (
 	"strings"
 
 	"github.com/steadybit/extension-newrelic/types"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
 	"testing"
 	"time"
 )
@@ -25,6 +28,14 @@ func TestGraphQlStringEscaping(t *testing.T) {
 	}
 }
 
+func TestNrqlStringEscaping(t *testing.T) {
+	got := NrqlString(`a'b\c`)
+	want := `'a\'b\\c'`
+	if got != want {
+		t.Errorf("NrqlString = %s, want %s", got, want)
+	}
+}
+
 func TestCreateMutingRuleEscapesInjection(t *testing.T) {
 	var captured []byte
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -270,3 +281,239 @@ func TestGetWorkloadStatusWithNullWorkload(t *testing.T) {
 		t.Errorf("expected status UNKNOWN, got %v", status)
 	}
 }
+
+func TestPostEventsSendsGzipCompressedBatch(t *testing.T) {
+	var received []types.EventIngest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/accounts/1234/events" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		if r.Header.Get("Content-Encoding") != "gzip" {
+			t.Errorf("body is not gzip-compressed")
+		}
+		reader, err := gzip.NewReader(r.Body)
+		if err != nil {
+			t.Fatalf("failed to decompress body: %v", err)
+		}
+		if err := json.NewDecoder(reader).Decode(&received); err != nil {
+			t.Fatalf("failed to decode body: %v", err)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	s := &Specification{InsightsCollectorApiBaseUrl: server.URL, InsightsCollectorApiKey: "test-key"}
+
+	err := s.PostEvents(context.Background(), []types.EventIngest{
+		{EventType: types.EventTypeAttackStarted, Target: "a"},
+		{EventType: types.EventTypeAttackStarted, Target: "b"},
+	}, 1234)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(received) != 2 || received[1].Target != "b" {
+		t.Errorf("unexpected events %+v", received)
+	}
+}
+
+func TestPostMetricsSendsGaugesToMetricApi(t *testing.T) {
+	var received []types.MetricData
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/metric/v1" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		if r.Header.Get("API-Key") != "license-key" {
+			t.Errorf("unexpected api key %s", r.Header.Get("API-Key"))
+		}
+		reader, err := gzip.NewReader(r.Body)
+		if err != nil {
+			t.Fatalf("failed to decompress body: %v", err)
+		}
+		if err := json.NewDecoder(reader).Decode(&received); err != nil {
+			t.Fatalf("failed to decode body: %v", err)
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	s := &Specification{MetricApiBaseUrl: server.URL, InsightsCollectorApiKey: "license-key"}
+
+	err := s.PostMetrics(context.Background(), []types.Metric{
+		{Name: "steadybit.attack.active", Type: types.MetricTypeGauge, Value: 1, Timestamp: 1000, Attributes: map[string]string{"target": "a"}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(received) != 1 || len(received[0].Metrics) != 1 || received[0].Metrics[0].Attributes["target"] != "a" {
+		t.Errorf("unexpected metrics %+v", received)
+	}
+}
+
+func TestPostLogsSendsLogLines(t *testing.T) {
+	var received []types.LogData
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/log/v1" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		reader, err := gzip.NewReader(r.Body)
+		if err != nil {
+			t.Fatalf("failed to decompress body: %v", err)
+		}
+		if err := json.NewDecoder(reader).Decode(&received); err != nil {
+			t.Fatalf("failed to decode body: %v", err)
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	s := &Specification{LogApiBaseUrl: server.URL, InsightsCollectorApiKey: "license-key"}
+
+	err := s.PostLogs(context.Background(), []types.LogEntry{
+		{Timestamp: 1000, Message: "Experiment ADM-1 started", Attributes: map[string]any{"executionId": "42"}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(received) != 1 || received[0].Common.Attributes["logtype"] != "steadybit" || received[0].Logs[0].Message != "Experiment ADM-1 started" {
+		t.Errorf("unexpected logs %+v", received)
+	}
+}
+
+func TestPostTracesSendsProtobuf(t *testing.T) {
+	var received tracepb.TracesData
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		if r.Header.Get("Content-Type") != "application/x-protobuf" {
+			t.Errorf("unexpected content type %s", r.Header.Get("Content-Type"))
+		}
+		reader, err := gzip.NewReader(r.Body)
+		if err != nil {
+			t.Fatalf("failed to decompress body: %v", err)
+		}
+		body, err := io.ReadAll(reader)
+		if err != nil {
+			t.Fatalf("failed to read body: %v", err)
+		}
+		if err := proto.Unmarshal(body, &received); err != nil {
+			t.Fatalf("failed to decode body: %v", err)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	s := &Specification{OtlpApiBaseUrl: server.URL, InsightsCollectorApiKey: "license-key"}
+
+	err := s.PostTraces(context.Background(), &tracepb.TracesData{ResourceSpans: []*tracepb.ResourceSpans{{
+		ScopeSpans: []*tracepb.ScopeSpans{{Spans: []*tracepb.Span{{Name: "experiment ADM-1"}}}},
+	}}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(received.ResourceSpans) != 1 || received.ResourceSpans[0].ScopeSpans[0].Spans[0].Name != "experiment ADM-1" {
+		t.Errorf("unexpected traces %+v", &received)
+	}
+}
+
+func TestAddEntityTagFailsOnTaggingErrors(t *testing.T) {
+	var query string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		query = body["query"]
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`{"data":{"taggingAddTagsToEntity":{"errors":[{"message":"Entity not found","type":"NOT_FOUND"}]}}}`))
+	}))
+	defer server.Close()
+
+	s := &Specification{ApiBaseUrl: server.URL, ApiKey: "test-key"}
+
+	err := s.AddEntityTag(context.Background(), "guid-1", "steadybit.attack", []string{"ADM-1"})
+	if err == nil || !strings.Contains(err.Error(), "Entity not found") {
+		t.Errorf("expected tagging error, got %v", err)
+	}
+	want := `taggingAddTagsToEntity(guid: "guid-1", tags: [{key: "steadybit.attack", values: ["ADM-1"]}])`
+	if !strings.Contains(query, want) {
+		t.Errorf("query %s does not contain %s", query, want)
+	}
+}
+
+func TestSetSyntheticMonitorStatus(t *testing.T) {
+	var query string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		query = body["query"]
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`{"data":{"syntheticsMonitorUpdate":{"errors":[]}}}`))
+	}))
+	defer server.Close()
+
+	s := &Specification{ApiBaseUrl: server.URL, ApiKey: "test-key"}
+
+	err := s.SetSyntheticMonitorStatus(context.Background(), types.GraphQlResponseEntities{Guid: "monitor-1", MonitorType: "SCRIPT_API"}, "DISABLED")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := `syntheticsMonitorUpdate: syntheticsUpdateScriptApiMonitor(guid: "monitor-1", monitor: {status: DISABLED})`
+	if !strings.Contains(query, want) {
+		t.Errorf("query %s does not contain %s", query, want)
+	}
+
+	err = s.SetSyntheticMonitorStatus(context.Background(), types.GraphQlResponseEntities{Guid: "monitor-1", MonitorType: "UNKNOWN"}, "DISABLED")
+	if err == nil {
+		t.Errorf("expected an error for an unsupported monitor type")
+	}
+}
+
+func TestCreateChangeTrackingEvent(t *testing.T) {
+	var query string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		query = body["query"]
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`{"data":{"changeTrackingCreateEvent":{"changeTrackingEvent":{"changeTrackingId":"42"}}}}`))
+	}))
+	defer server.Close()
+
+	s := &Specification{ApiBaseUrl: server.URL, ApiKey: "test-key"}
+
+	err := s.CreateChangeTrackingEvent(context.Background(), types.ChangeTrackingEvent{
+		EntityGuids:      []string{"guid-1", "guid-2"},
+		ShortDescription: `Chaos attack started: "CPU" on checkout`,
+		User:             "jane",
+		GroupId:          "steadybit-ADM-1-42",
+		Timestamp:        time.UnixMilli(1700000000000),
+		CustomAttributes: map[string]string{"experimentKey": "ADM-1", "executionId": "42"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, expected := range []string{
+		`entitySearch: {query: "id IN ('guid-1', 'guid-2')"}`,
+		`shortDescription: "Chaos attack started: \"CPU\" on checkout"`,
+		`timestamp: 1700000000000`,
+		`customAttributes: {executionId: "42", experimentKey: "ADM-1"}`,
+	} {
+		if !strings.Contains(query, expected) {
+			t.Errorf("mutation %q does not contain %q", query, expected)
+		}
+	}
+}
+
+func TestCreateChangeTrackingEventFailsOnErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`{"data":{"changeTrackingCreateEvent":null},"errors":[{"message":"No entities found"}]}`))
+	}))
+	defer server.Close()
+
+	s := &Specification{ApiBaseUrl: server.URL, ApiKey: "test-key"}
+
+	err := s.CreateChangeTrackingEvent(context.Background(), types.ChangeTrackingEvent{EntityGuids: []string{"guid-1"}})
+	if err == nil || !strings.Contains(err.Error(), "No entities found") {
+		t.Errorf("expected the API error, got %v", err)
+	}
+}
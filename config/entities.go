@@ -0,0 +1,65 @@
+/*
+ * Copyright 2023 steadybit GmbH. All rights reserved.
+ */
+
+package config
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/steadybit/extension-newrelic/types"
+)
+
+// maxEntitiesPerQuery is the maximum number of guids `actor.entities` accepts at once.
+const maxEntitiesPerQuery = 25
+
+// alertSeverity is only defined for alertable entities, hence the inline fragments.
+const entitiesQuery = `{actor {entities(guids: [%s]) {guid name permalink ... on AlertableEntity {alertSeverity}}}}`
+
+// GetEntities looks up entities by their guids. Unknown guids are silently omitted by New Relic.
+func (s *Specification) GetEntities(_ context.Context, guids []string) ([]types.GraphQlResponseEntities, error) {
+	entities := make([]types.GraphQlResponseEntities, 0, len(guids))
+	for start := 0; start < len(guids); start += maxEntitiesPerQuery {
+		end := min(start+maxEntitiesPerQuery, len(guids))
+		result, errs, err := s.graphQl("entities", fmt.Sprintf(entitiesQuery, graphQlStringList(guids[start:end])))
+		if err != nil {
+			return nil, err
+		}
+		if result.Data == nil || result.Data.Actor == nil || result.Data.Actor.Entities == nil {
+			if errs != "" {
+				return nil, fmt.Errorf("errors returned by the New Relic API: %s", errs)
+			}
+			continue
+		}
+		entities = append(entities, result.Data.Actor.Entities...)
+	}
+	return entities, nil
+}
+
+const entitySearchQuery = `{actor {entitySearch(query: %s) {results%s {nextCursor entities {guid name permalink accountId tags {key values} ... on AlertableEntityOutline {alertSeverity} ... on ApmApplicationEntityOutline {language} ... on SyntheticMonitorEntityOutline {monitorId monitorType period monitorSummary {status successRate}}}}}}}`
+
+// SearchEntities returns all entities matching an entity search query like
+// `domain = 'APM' AND tags.team = 'checkout'`, following the result cursor.
+func (s *Specification) SearchEntities(_ context.Context, query string) ([]types.GraphQlResponseEntities, error) {
+	entities := make([]types.GraphQlResponseEntities, 0)
+	cursor := ""
+	for {
+		result, errs, err := s.graphQl("entitySearch", fmt.Sprintf(entitySearchQuery, graphQlString(query), cursor))
+		if err != nil {
+			return nil, err
+		}
+		if result.Data == nil || result.Data.Actor == nil || result.Data.Actor.EntitySearch == nil || result.Data.Actor.EntitySearch.Results == nil {
+			if errs != "" {
+				return nil, fmt.Errorf("errors returned by the New Relic API: %s", errs)
+			}
+			return entities, nil
+		}
+		results := result.Data.Actor.EntitySearch.Results
+		entities = append(entities, results.Entities...)
+		if results.NextCursor == nil || *results.NextCursor == "" {
+			return entities, nil
+		}
+		cursor = fmt.Sprintf("(cursor: %s)", graphQlString(*results.NextCursor))
+	}
+}
@@ -0,0 +1,35 @@
+/*
+ * Copyright 2023 steadybit GmbH. All rights reserved.
+ */
+
+package config
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// NrqlString renders a value as a quoted NRQL string literal, so that quotes or backslashes
+// in the value cannot break out of the literal.
+func NrqlString(value string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value) + "'"
+}
+
+const nrqlQuery = `{actor {account(id: %d) {nrql(query: %s) {results}}}}`
+
+// QueryNrql runs a NRQL query in the given account and returns its result rows.
+func (s *Specification) QueryNrql(_ context.Context, accountId int64, query string) ([]map[string]any, error) {
+	result, errs, err := s.graphQl("nrql", fmt.Sprintf(nrqlQuery, accountId, graphQlString(query)))
+	if err != nil {
+		return nil, err
+	}
+	if result.Data == nil || result.Data.Actor == nil || result.Data.Actor.Account == nil || result.Data.Actor.Account.Nrql == nil {
+		// An invalid query is reported as a GraphQL error with `nrql: null`.
+		if errs != "" {
+			return nil, fmt.Errorf("errors returned by the New Relic API: %s", errs)
+		}
+		return nil, fmt.Errorf("no NRQL results for account %d", accountId)
+	}
+	return result.Data.Actor.Account.Nrql.Results, nil
+}
@@ -0,0 +1,77 @@
+/*
+ * Copyright 2023 steadybit GmbH. All rights reserved.
+ */
+
+package config
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/rs/zerolog/log"
+	"github.com/steadybit/extension-newrelic/types"
+)
+
+// serviceLevelsSearchQuery selects the service level indicator entities of an account. They
+// are tagged with the entity the indicator is defined for.
+const serviceLevelsSearchQuery = "type = 'SERVICE_LEVEL' AND accountId = %d"
+
+const associatedEntityGuidTag = "nr.associatedEntityGuid"
+
+const serviceLevelIndicatorsQuery = `{actor {entities(guids: [%s]) {guid name serviceLevel {indicators {guid name objectives {target timeWindow {rolling {count unit}}}}}}}}`
+
+// GetServiceLevels returns the service level indicators of an account. The definition of an
+// indicator, including its objectives, is only available through the entity it is defined
+// for, so the indicators are looked up first and their entities second.
+func (s *Specification) GetServiceLevels(ctx context.Context, accountId int64) ([]types.ServiceLevel, error) {
+	indicators, err := s.SearchEntities(ctx, fmt.Sprintf(serviceLevelsSearchQuery, accountId))
+	if err != nil {
+		return nil, err
+	}
+
+	indicatorGuids := make([]string, 0, len(indicators))
+	entityGuids := make([]string, 0, len(indicators))
+	for _, indicator := range indicators {
+		indicatorGuids = append(indicatorGuids, indicator.Guid)
+		for _, tag := range indicator.Tags {
+			if tag.Key == associatedEntityGuidTag && len(tag.Values) > 0 && !slices.Contains(entityGuids, tag.Values[0]) {
+				entityGuids = append(entityGuids, tag.Values[0])
+			}
+		}
+	}
+
+	serviceLevels := make([]types.ServiceLevel, 0, len(indicators))
+	for start := 0; start < len(entityGuids); start += maxEntitiesPerQuery {
+		end := min(start+maxEntitiesPerQuery, len(entityGuids))
+		result, errs, err := s.graphQl("serviceLevelIndicators", fmt.Sprintf(serviceLevelIndicatorsQuery, graphQlStringList(entityGuids[start:end])))
+		if err != nil {
+			return nil, err
+		}
+		if result.Data == nil || result.Data.Actor == nil || result.Data.Actor.Entities == nil {
+			if errs != "" {
+				return nil, fmt.Errorf("errors returned by the New Relic API: %s", errs)
+			}
+			continue
+		}
+		for _, entity := range result.Data.Actor.Entities {
+			if entity.ServiceLevel == nil {
+				continue
+			}
+			for _, indicator := range entity.ServiceLevel.Indicators {
+				// An entity's indicators may be defined in other accounts, too.
+				if !slices.Contains(indicatorGuids, indicator.Guid) {
+					continue
+				}
+				serviceLevels = append(serviceLevels, types.ServiceLevel{
+					Indicator:  indicator,
+					AccountId:  accountId,
+					EntityGuid: entity.Guid,
+					EntityName: entity.Name,
+				})
+			}
+		}
+	}
+	log.Debug().Int64("accountId", accountId).Int("indicators", len(indicators)).Int("serviceLevels", len(serviceLevels)).Msg("Resolved service levels.")
+	return serviceLevels, nil
+}
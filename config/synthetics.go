@@ -0,0 +1,108 @@
+/*
+ * Copyright 2023 steadybit GmbH. All rights reserved.
+ */
+
+package config
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/steadybit/extension-newrelic/types"
+)
+
+// syntheticMonitorUpdateMutations are the mutations updating synthetic monitors, per monitor
+// type.
+var syntheticMonitorUpdateMutations = map[string]string{
+	"SIMPLE":         "syntheticsUpdateSimpleMonitor",
+	"BROWSER":        "syntheticsUpdateSimpleBrowserMonitor",
+	"SCRIPT_API":     "syntheticsUpdateScriptApiMonitor",
+	"SCRIPT_BROWSER": "syntheticsUpdateScriptBrowserMonitor",
+	"CERT_CHECK":     "syntheticsUpdateCertCheckMonitor",
+	"BROKEN_LINKS":   "syntheticsUpdateBrokenLinksMonitor",
+	"STEP_MONITOR":   "syntheticsUpdateStepMonitor",
+}
+
+// The mutation is aliased, so the payload is found at the same place for every monitor type.
+const syntheticMonitorUpdateMutation = `mutation {syntheticsMonitorUpdate: %s(guid: %s, monitor: {status: %s}) {errors {description type}}}`
+
+const syntheticMonitorQuery = `{actor {entities(guids: [%s]) {guid name ... on SyntheticMonitorEntity {monitorId monitorType monitorSummary {status}}}}}`
+
+// GetSyntheticMonitor looks up the current type and status of a synthetic monitor.
+func (s *Specification) GetSyntheticMonitor(_ context.Context, guid string) (*types.GraphQlResponseEntities, error) {
+	result, errs, err := s.graphQl("entities", fmt.Sprintf(syntheticMonitorQuery, graphQlString(guid)))
+	if err != nil {
+		return nil, err
+	}
+	if result.Data == nil || result.Data.Actor == nil || len(result.Data.Actor.Entities) == 0 {
+		if errs != "" {
+			return nil, fmt.Errorf("errors returned by the New Relic API: %s", errs)
+		}
+		return nil, fmt.Errorf("synthetic monitor %s not found", guid)
+	}
+	return &result.Data.Actor.Entities[0], nil
+}
+
+// SetSyntheticMonitorStatus sets the status of a synthetic monitor to ENABLED, DISABLED or
+// MUTED, leaving its other settings untouched.
+func (s *Specification) SetSyntheticMonitorStatus(_ context.Context, monitor types.GraphQlResponseEntities, status string) error {
+	mutation, ok := syntheticMonitorUpdateMutations[monitor.MonitorType]
+	if !ok {
+		return fmt.Errorf("monitors of type %s are not supported", monitor.MonitorType)
+	}
+
+	result, errs, err := s.graphQl(mutation, fmt.Sprintf(syntheticMonitorUpdateMutation, mutation, graphQlString(monitor.Guid), status))
+	if err != nil {
+		return err
+	}
+	if result.Data == nil || result.Data.SyntheticsMonitorUpdate == nil {
+		if errs != "" {
+			return fmt.Errorf("errors returned by the New Relic API: %s", errs)
+		}
+		return fmt.Errorf("monitor %s not updated", monitor.Guid)
+	}
+	if len(result.Data.SyntheticsMonitorUpdate.Errors) > 0 {
+		messages := make([]string, 0, len(result.Data.SyntheticsMonitorUpdate.Errors))
+		for _, e := range result.Data.SyntheticsMonitorUpdate.Errors {
+			messages = append(messages, fmt.Sprintf("%s (%s)", e.Description, e.Type))
+		}
+		return fmt.Errorf("monitor update failed: %s", strings.Join(messages, ", "))
+	}
+	return nil
+}
+
+const syntheticsStartAutomatedTestMutation = `mutation {syntheticsStartAutomatedTest(config: {batchName: %s}, tests: [{monitorGuid: %s}]) {batchId}}`
+
+const syntheticsAutomatedTestResultQuery = `{actor {account(id: %d) {synthetics {automatedTestResult(batchId: %s) {status tests {id monitorGuid monitorName locationLabel result resultsUrl duration}}}}}}`
+
+// StartSyntheticTest triggers an immediate run of a synthetic monitor, outside its schedule,
+// and returns the id of the batch to look up the result with.
+func (s *Specification) StartSyntheticTest(_ context.Context, monitorGuid string, batchName string) (string, error) {
+	result, errs, err := s.graphQl("syntheticsStartAutomatedTest", fmt.Sprintf(syntheticsStartAutomatedTestMutation, graphQlString(batchName), graphQlString(monitorGuid)))
+	if err != nil {
+		return "", err
+	}
+	if result.Data == nil || result.Data.SyntheticsStartAutomatedTest == nil || result.Data.SyntheticsStartAutomatedTest.BatchId == "" {
+		if errs != "" {
+			return "", fmt.Errorf("errors returned by the New Relic API: %s", errs)
+		}
+		return "", fmt.Errorf("no test batch started for monitor %s", monitorGuid)
+	}
+	return result.Data.SyntheticsStartAutomatedTest.BatchId, nil
+}
+
+// GetSyntheticTestResult returns the result of a batch started with StartSyntheticTest.
+func (s *Specification) GetSyntheticTestResult(_ context.Context, accountId int64, batchId string) (*types.SyntheticsAutomatedTestResult, error) {
+	result, errs, err := s.graphQl("automatedTestResult", fmt.Sprintf(syntheticsAutomatedTestResultQuery, accountId, graphQlString(batchId)))
+	if err != nil {
+		return nil, err
+	}
+	if result.Data == nil || result.Data.Actor == nil || result.Data.Actor.Account == nil || result.Data.Actor.Account.Synthetics == nil || result.Data.Actor.Account.Synthetics.AutomatedTestResult == nil {
+		if errs != "" {
+			return nil, fmt.Errorf("errors returned by the New Relic API: %s", errs)
+		}
+		return nil, fmt.Errorf("no result for test batch %s", batchId)
+	}
+	return result.Data.Actor.Account.Synthetics.AutomatedTestResult, nil
+}
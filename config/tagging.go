@@ -0,0 +1,78 @@
+/*
+ * Copyright 2023 steadybit GmbH. All rights reserved.
+ */
+
+package config
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/steadybit/extension-newrelic/types"
+)
+
+const taggingAddTagsToEntityMutation = `mutation {taggingAddTagsToEntity(guid: %s, tags: [{key: %s, values: [%s]}]) {errors {message type}}}`
+
+const taggingDeleteTagValuesFromEntityMutation = `mutation {taggingDeleteTagValuesFromEntity(guid: %s, tagValues: [%s]) {errors {message type}}}`
+
+const taggingDeleteTagFromEntityMutation = `mutation {taggingDeleteTagFromEntity(guid: %s, tagKeys: [%s]) {errors {message type}}}`
+
+// AddEntityTag adds values to a tag of an entity, keeping the tag's other values.
+func (s *Specification) AddEntityTag(_ context.Context, guid string, key string, values []string) error {
+	result, errs, err := s.graphQl("taggingAddTagsToEntity", fmt.Sprintf(taggingAddTagsToEntityMutation, graphQlString(guid), graphQlString(key), graphQlStringList(values)))
+	if err != nil {
+		return err
+	}
+	if result.Data == nil {
+		return taggingError(errs, nil)
+	}
+	return taggingError(errs, result.Data.TaggingAddTagsToEntity)
+}
+
+// DeleteEntityTagValues removes values from a tag of an entity, keeping the tag's other values.
+func (s *Specification) DeleteEntityTagValues(_ context.Context, guid string, key string, values []string) error {
+	tagValues := make([]string, 0, len(values))
+	for _, value := range values {
+		tagValues = append(tagValues, fmt.Sprintf("{key: %s, value: %s}", graphQlString(key), graphQlString(value)))
+	}
+	result, errs, err := s.graphQl("taggingDeleteTagValuesFromEntity", fmt.Sprintf(taggingDeleteTagValuesFromEntityMutation, graphQlString(guid), strings.Join(tagValues, ", ")))
+	if err != nil {
+		return err
+	}
+	if result.Data == nil {
+		return taggingError(errs, nil)
+	}
+	return taggingError(errs, result.Data.TaggingDeleteTagValuesFromEntity)
+}
+
+// DeleteEntityTags removes tags with all their values from an entity.
+func (s *Specification) DeleteEntityTags(_ context.Context, guid string, keys []string) error {
+	result, errs, err := s.graphQl("taggingDeleteTagFromEntity", fmt.Sprintf(taggingDeleteTagFromEntityMutation, graphQlString(guid), graphQlStringList(keys)))
+	if err != nil {
+		return err
+	}
+	if result.Data == nil {
+		return taggingError(errs, nil)
+	}
+	return taggingError(errs, result.Data.TaggingDeleteTagFromEntity)
+}
+
+// taggingError reports the GraphQL errors of a tagging mutation as well as the errors in its
+// payload, which New Relic uses for tagging problems like a missing entity.
+func taggingError(errs string, payload *types.GraphQlResponseTaggingMutation) error {
+	if payload == nil {
+		if errs != "" {
+			return fmt.Errorf("errors returned by the New Relic API: %s", errs)
+		}
+		return fmt.Errorf("no tagging result returned")
+	}
+	if len(payload.Errors) > 0 {
+		messages := make([]string, 0, len(payload.Errors))
+		for _, e := range payload.Errors {
+			messages = append(messages, fmt.Sprintf("%s (%s)", e.Message, e.Type))
+		}
+		return fmt.Errorf("tagging failed: %s", strings.Join(messages, ", "))
+	}
+	return nil
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/steadybit/discovery-kit/go/discovery_kit_test/validate"
 	"github.com/steadybit/extension-kit/extlogging"
 	"github.com/steadybit/extension-newrelic/extaccount"
+	"github.com/steadybit/extension-newrelic/extentity"
 	"github.com/steadybit/extension-newrelic/extincident"
 	"github.com/steadybit/extension-newrelic/extworkload"
 	"github.com/stretchr/testify/assert"
@@ -53,6 +54,10 @@ func TestWithMinikube(t *testing.T) {
 			Name: "check incidents",
 			Test: testCheckIncident,
 		},
+		{
+			Name: "check entity alert severity",
+			Test: testCheckEntityAlertSeverity,
+		},
 		{
 			Name: "create muting rule",
 			Test: testCreateMutingRule,
@@ -141,6 +146,35 @@ func testCheckIncident(t *testing.T, m *e2e.Minikube, e *e2e.Extension) {
 	assert.Equal(t, "ip-10-40-85-195.eu-central-1.compute.internal", metrics[0].Metric["title"])
 }
 
+func testCheckEntityAlertSeverity(t *testing.T, m *e2e.Minikube, e *e2e.Extension) {
+	config := struct {
+		Duration           int      `json:"duration"`
+		EntityGuids        []string `json:"entityGuids"`
+		ExpectedSeverities []string `json:"expectedSeverities"`
+		ConditionCheckMode string   `json:"conditionCheckMode"`
+	}{Duration: 1000, EntityGuids: []string{"entity-1"}, ExpectedSeverities: []string{"NOT_ALERTING"}, ConditionCheckMode: "allTheTime"}
+
+	executionContext := &action_kit_api.ExecutionContext{}
+
+	action, err := e.RunAction(extentity.AlertSeverityCheckActionId, nil, config, executionContext)
+	defer func() { _ = action.Cancel() }()
+	require.NoError(t, err)
+	err = action.Wait()
+	require.NoError(t, err)
+
+	assert.Eventually(t, func() bool {
+		metrics := action.Metrics()
+		if metrics == nil {
+			return false
+		}
+		return len(metrics) > 0
+	}, 5*time.Second, 500*time.Millisecond)
+	metrics := action.Metrics()
+
+	assert.Equal(t, "entity-1", metrics[0].Metric["newrelic.entity-guid"])
+	assert.Equal(t, "success", metrics[0].Metric["state"])
+}
+
 func testCreateMutingRule(t *testing.T, m *e2e.Minikube, e *e2e.Extension) {
 	target := &action_kit_api.Target{
 		Name: "12345678",
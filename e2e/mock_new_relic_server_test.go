@@ -24,7 +24,12 @@ func createMockNewRelicServer() *httptest.Server {
 				panic(errRead)
 			}
 			requestBody := string(requestBodyBytes)
-			if strings.HasPrefix(r.URL.Path, "/graphql") && strings.Contains(requestBody, "actor {accounts {id}}") && r.Method == http.MethodPost {
+			// The entities lookup of the alert severity check, not the entity searches of the
+			// discoveries, which ask for the alert severity, too.
+			if strings.HasPrefix(r.URL.Path, "/graphql") && strings.Contains(requestBody, "actor {entities(guids:") && strings.Contains(requestBody, "... on AlertableEntity {alertSeverity}") && r.Method == http.MethodPost {
+				w.WriteHeader(http.StatusOK)
+				_, _ = w.Write(entitiesAlertSeverity())
+			} else if strings.HasPrefix(r.URL.Path, "/graphql") && strings.Contains(requestBody, "actor {accounts {id}}") && r.Method == http.MethodPost {
 				w.WriteHeader(http.StatusOK)
 				_, _ = w.Write(accounts())
 			} else if strings.HasPrefix(r.URL.Path, "/graphql") && strings.Contains(requestBody, "guid name permalink") && r.Method == http.MethodPost {
@@ -200,3 +205,20 @@ func mutingRuleDeleted() []byte {
   }
 }`)
 }
+
+func entitiesAlertSeverity() []byte {
+	return []byte(`{
+  "data": {
+    "actor": {
+      "entities": [
+        {
+          "guid": "entity-1",
+          "name": "checkout-service",
+          "permalink": "https://one.newrelic.com/redirect/entity/entity-1",
+          "alertSeverity": "NOT_ALERTING"
+        }
+      ]
+    }
+  }
+}`)
+}
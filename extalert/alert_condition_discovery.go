@@ -0,0 +1,219 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2022 Steadybit GmbH
+
+package extalert
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/steadybit/discovery-kit/go/discovery_kit_api"
+	"github.com/steadybit/discovery-kit/go/discovery_kit_sdk"
+	"github.com/steadybit/extension-kit/extbuild"
+	"github.com/steadybit/extension-newrelic/config"
+	"github.com/steadybit/extension-newrelic/types"
+)
+
+type alertConditionDiscovery struct {
+}
+
+var (
+	_ discovery_kit_sdk.TargetDescriber    = (*alertConditionDiscovery)(nil)
+	_ discovery_kit_sdk.AttributeDescriber = (*alertConditionDiscovery)(nil)
+)
+
+func NewAlertConditionDiscovery() discovery_kit_sdk.TargetDiscovery {
+	discovery := &alertConditionDiscovery{}
+	return discovery_kit_sdk.NewCachedTargetDiscovery(discovery,
+		discovery_kit_sdk.WithRefreshTargetsNow(),
+		discovery_kit_sdk.WithRefreshTargetsInterval(context.Background(), 5*time.Minute),
+	)
+}
+
+func (d *alertConditionDiscovery) Describe() discovery_kit_api.DiscoveryDescription {
+	return discovery_kit_api.DiscoveryDescription{
+		Id: AlertConditionTargetId,
+		Discover: discovery_kit_api.DescribingEndpointReferenceWithCallInterval{
+			CallInterval: new("5m"),
+		},
+	}
+}
+
+func (d *alertConditionDiscovery) DescribeTarget() discovery_kit_api.TargetDescription {
+	return discovery_kit_api.TargetDescription{
+		Id:       AlertConditionTargetId,
+		Label:    discovery_kit_api.PluralLabel{One: "New Relic Alert Condition", Other: "New Relic Alert Conditions"},
+		Category: new("monitoring"),
+		Version:  extbuild.GetSemverVersionStringOrUnknown(),
+		Icon:     new(alertConditionIcon),
+		Table: discovery_kit_api.Table{
+			Columns: []discovery_kit_api.Column{
+				{Attribute: "new-relic.alert-condition.name"},
+				{Attribute: "new-relic.alert-policy.name"},
+				{Attribute: "new-relic.alert-condition.enabled"},
+				{Attribute: "new-relic.alert-condition.account"},
+			},
+			OrderBy: []discovery_kit_api.OrderBy{
+				{
+					Attribute: "new-relic.alert-condition.name",
+					Direction: "ASC",
+				},
+			},
+		},
+	}
+}
+
+func (d *alertConditionDiscovery) DescribeAttributes() []discovery_kit_api.AttributeDescription {
+	return []discovery_kit_api.AttributeDescription{
+		{
+			Attribute: "new-relic.alert-condition.name",
+			Label: discovery_kit_api.PluralLabel{
+				One:   "New Relic Alert Condition Name",
+				Other: "New Relic Alert Condition Names",
+			},
+		},
+		{
+			Attribute: "new-relic.alert-condition.account",
+			Label: discovery_kit_api.PluralLabel{
+				One:   "New Relic Alert Condition Account",
+				Other: "New Relic Alert Condition Accounts",
+			},
+		},
+		{
+			Attribute: "new-relic.alert-condition.enabled",
+			Label: discovery_kit_api.PluralLabel{
+				One:   "New Relic Alert Condition Enabled",
+				Other: "New Relic Alert Condition Enabled",
+			},
+		},
+		{
+			Attribute: "new-relic.alert-condition.type",
+			Label: discovery_kit_api.PluralLabel{
+				One:   "New Relic Alert Condition Type",
+				Other: "New Relic Alert Condition Types",
+			},
+		},
+		{
+			Attribute: "new-relic.alert-condition.runbook-url",
+			Label: discovery_kit_api.PluralLabel{
+				One:   "New Relic Alert Condition Runbook URL",
+				Other: "New Relic Alert Condition Runbook URLs",
+			},
+		},
+		{
+			Attribute: "new-relic.alert-condition.signal.entity.guid",
+			Label: discovery_kit_api.PluralLabel{
+				One:   "New Relic Alert Condition Signal Entity GUID",
+				Other: "New Relic Alert Condition Signal Entity GUIDs",
+			},
+		},
+	}
+}
+
+func (d *alertConditionDiscovery) DiscoverTargets(ctx context.Context) ([]discovery_kit_api.Target, error) {
+	return getAllAlertConditions(ctx, &config.Config), nil
+}
+
+type GetAlertConditionsApi interface {
+	GetAccountIds(ctx context.Context) ([]int64, error)
+	GetAlertPolicies(ctx context.Context, accountId int64) ([]types.AlertPolicy, error)
+	SearchNrqlConditions(ctx context.Context, accountId int64, conditionId string, policyId string) ([]types.NrqlCondition, error)
+}
+
+func getAllAlertConditions(ctx context.Context, api GetAlertConditionsApi) []discovery_kit_api.Target {
+	result := make([]discovery_kit_api.Target, 0, 100)
+
+	accounts, err := api.GetAccountIds(ctx)
+	if err != nil {
+		log.Err(err).Msgf("Failed to get accounts from New Relic.")
+		return result
+	}
+
+	for _, accountId := range accounts {
+		conditions, err := api.SearchNrqlConditions(ctx, accountId, "", "")
+		if err != nil {
+			log.Err(err).Int64("accountId", accountId).Msgf("Failed to get alert conditions from New Relic.")
+			continue
+		}
+		// Policy names are only nice to have, conditions are discovered without them, too.
+		policyNames := make(map[string]string)
+		policies, err := api.GetAlertPolicies(ctx, accountId)
+		if err != nil {
+			log.Warn().Err(err).Int64("accountId", accountId).Msgf("Failed to get alert policies from New Relic.")
+		}
+		for _, policy := range policies {
+			policyNames[policy.Id] = policy.Name
+		}
+		for _, condition := range conditions {
+			result = append(result, toConditionTarget(accountId, condition, policyNames[condition.PolicyId]))
+		}
+	}
+
+	return result
+}
+
+func toConditionTarget(accountId int64, condition types.NrqlCondition, policyName string) discovery_kit_api.Target {
+	attributes := make(map[string][]string)
+	attributes["new-relic.alert-condition.id"] = []string{condition.Id}
+	attributes["new-relic.alert-condition.name"] = []string{condition.Name}
+	attributes["new-relic.alert-condition.account"] = []string{fmt.Sprintf("%d", accountId)}
+	attributes["new-relic.alert-condition.enabled"] = []string{strconv.FormatBool(condition.Enabled)}
+	attributes["new-relic.alert-policy.id"] = []string{condition.PolicyId}
+	label := condition.Name
+	if policyName != "" {
+		attributes["new-relic.alert-policy.name"] = []string{policyName}
+		label = fmt.Sprintf("%s (%s)", condition.Name, policyName)
+	}
+	if condition.Type != "" {
+		attributes["new-relic.alert-condition.type"] = []string{condition.Type}
+	}
+	if condition.EntityGuid != "" {
+		attributes["new-relic.alert-condition.guid"] = []string{condition.EntityGuid}
+	}
+	if condition.RunbookUrl != "" {
+		attributes["new-relic.alert-condition.runbook-url"] = []string{condition.RunbookUrl}
+	}
+	if condition.Nrql != nil {
+		attributes["new-relic.alert-condition.query"] = []string{condition.Nrql.Query}
+		if guids := signalEntityGuids(condition.Nrql.Query); len(guids) > 0 {
+			attributes["new-relic.alert-condition.signal.entity.guid"] = guids
+		}
+	}
+
+	return discovery_kit_api.Target{
+		Id:         fmt.Sprintf("%d/%s", accountId, condition.Id),
+		Label:      label,
+		TargetType: AlertConditionTargetId,
+		Attributes: attributes,
+	}
+}
+
+var (
+	// entityGuidCondition matches NRQL conditions on entity guids, like `entity.guid = '...'`
+	// or `entityGuid IN ('...', '...')`.
+	entityGuidCondition = regexp.MustCompile(`(?i)entity\.?guid\s*(?:=\s*'[^']*'|IN\s*\([^)]*\))`)
+	quotedValue         = regexp.MustCompile(`'([^']*)'`)
+)
+
+// signalEntityGuids returns the guids of the entities a condition's query is restricted to.
+// The NRQL condition search doesn't return the entities a condition monitors, so they are
+// taken from the query. Only comparisons of `entity.guid` or `entityGuid` with literal values
+// are recognized. Conditions selecting their entities otherwise, like by `appName`, tags,
+// facets or subqueries, yield no guids, so the attribute is a hint for target selection
+// rather than a complete list.
+func signalEntityGuids(query string) []string {
+	var guids []string
+	for _, condition := range entityGuidCondition.FindAllString(query, -1) {
+		for _, match := range quotedValue.FindAllStringSubmatch(condition, -1) {
+			if !slices.Contains(guids, match[1]) {
+				guids = append(guids, match[1])
+			}
+		}
+	}
+	return guids
+}
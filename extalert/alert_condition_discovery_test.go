@@ -0,0 +1,82 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2022 Steadybit GmbH
+
+package extalert
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/steadybit/extension-newrelic/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type alertsApiMock struct {
+	policies   []types.AlertPolicy
+	conditions []types.NrqlCondition
+	policyErr  error
+}
+
+func (m *alertsApiMock) GetAccountIds(_ context.Context) ([]int64, error) {
+	return []int64{1234}, nil
+}
+
+func (m *alertsApiMock) GetAlertPolicies(_ context.Context, _ int64) ([]types.AlertPolicy, error) {
+	return m.policies, m.policyErr
+}
+
+func (m *alertsApiMock) SearchNrqlConditions(_ context.Context, _ int64, _ string, _ string) ([]types.NrqlCondition, error) {
+	return m.conditions, nil
+}
+
+func TestGetAllAlertConditionsAddsPolicyAndSignalEntities(t *testing.T) {
+	api := &alertsApiMock{
+		policies: []types.AlertPolicy{{Id: "7", Name: "checkout-prod", IncidentPreference: "PER_CONDITION"}},
+		conditions: []types.NrqlCondition{{
+			Id:         "42",
+			Name:       "Error rate",
+			Enabled:    true,
+			PolicyId:   "7",
+			Type:       "STATIC",
+			RunbookUrl: "https://wiki/runbooks/checkout",
+			Nrql:       &types.NrqlConditionQuery{Query: "SELECT percentage(count(*), WHERE error) FROM Transaction WHERE entity.guid = 'guid-1' OR entityGuid IN ('guid-2', 'guid-1')"},
+		}},
+	}
+
+	targets := getAllAlertConditions(context.Background(), api)
+
+	require.Len(t, targets, 1)
+	assert.Equal(t, "1234/42", targets[0].Id)
+	assert.Equal(t, "Error rate (checkout-prod)", targets[0].Label)
+	assert.Equal(t, []string{"checkout-prod"}, targets[0].Attributes["new-relic.alert-policy.name"])
+	assert.Equal(t, []string{"true"}, targets[0].Attributes["new-relic.alert-condition.enabled"])
+	assert.Equal(t, []string{"https://wiki/runbooks/checkout"}, targets[0].Attributes["new-relic.alert-condition.runbook-url"])
+	assert.Equal(t, []string{"guid-1", "guid-2"}, targets[0].Attributes["new-relic.alert-condition.signal.entity.guid"])
+}
+
+func TestGetAllAlertConditionsWithoutPolicies(t *testing.T) {
+	api := &alertsApiMock{
+		conditions: []types.NrqlCondition{{Id: "42", Name: "Error rate", PolicyId: "7"}},
+		policyErr:  errors.New("forbidden"),
+	}
+
+	targets := getAllAlertConditions(context.Background(), api)
+
+	require.Len(t, targets, 1)
+	assert.Equal(t, "Error rate", targets[0].Label)
+	assert.Equal(t, []string{"7"}, targets[0].Attributes["new-relic.alert-policy.id"])
+	assert.NotContains(t, targets[0].Attributes, "new-relic.alert-policy.name")
+}
+
+func TestGetAllAlertPolicies(t *testing.T) {
+	api := &alertsApiMock{policies: []types.AlertPolicy{{Id: "7", Name: "checkout-prod", IncidentPreference: "PER_CONDITION"}}}
+
+	targets := getAllAlertPolicies(context.Background(), api)
+
+	require.Len(t, targets, 1)
+	assert.Equal(t, "1234/7", targets[0].Id)
+	assert.Equal(t, "checkout-prod", targets[0].Label)
+	assert.Equal(t, []string{"1234"}, targets[0].Attributes["new-relic.alert-policy.account"])
+}
@@ -0,0 +1,140 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2022 Steadybit GmbH
+
+package extalert
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/steadybit/discovery-kit/go/discovery_kit_api"
+	"github.com/steadybit/discovery-kit/go/discovery_kit_sdk"
+	"github.com/steadybit/extension-kit/extbuild"
+	"github.com/steadybit/extension-newrelic/config"
+	"github.com/steadybit/extension-newrelic/types"
+)
+
+type alertPolicyDiscovery struct {
+}
+
+var (
+	_ discovery_kit_sdk.TargetDescriber    = (*alertPolicyDiscovery)(nil)
+	_ discovery_kit_sdk.AttributeDescriber = (*alertPolicyDiscovery)(nil)
+)
+
+func NewAlertPolicyDiscovery() discovery_kit_sdk.TargetDiscovery {
+	discovery := &alertPolicyDiscovery{}
+	return discovery_kit_sdk.NewCachedTargetDiscovery(discovery,
+		discovery_kit_sdk.WithRefreshTargetsNow(),
+		discovery_kit_sdk.WithRefreshTargetsInterval(context.Background(), 5*time.Minute),
+	)
+}
+
+func (d *alertPolicyDiscovery) Describe() discovery_kit_api.DiscoveryDescription {
+	return discovery_kit_api.DiscoveryDescription{
+		Id: AlertPolicyTargetId,
+		Discover: discovery_kit_api.DescribingEndpointReferenceWithCallInterval{
+			CallInterval: new("5m"),
+		},
+	}
+}
+
+func (d *alertPolicyDiscovery) DescribeTarget() discovery_kit_api.TargetDescription {
+	return discovery_kit_api.TargetDescription{
+		Id:       AlertPolicyTargetId,
+		Label:    discovery_kit_api.PluralLabel{One: "New Relic Alert Policy", Other: "New Relic Alert Policies"},
+		Category: new("monitoring"),
+		Version:  extbuild.GetSemverVersionStringOrUnknown(),
+		Icon:     new(alertPolicyIcon),
+		Table: discovery_kit_api.Table{
+			Columns: []discovery_kit_api.Column{
+				{Attribute: "new-relic.alert-policy.name"},
+				{Attribute: "new-relic.alert-policy.incident-preference"},
+				{Attribute: "new-relic.alert-policy.account"},
+			},
+			OrderBy: []discovery_kit_api.OrderBy{
+				{
+					Attribute: "new-relic.alert-policy.name",
+					Direction: "ASC",
+				},
+			},
+		},
+	}
+}
+
+func (d *alertPolicyDiscovery) DescribeAttributes() []discovery_kit_api.AttributeDescription {
+	return []discovery_kit_api.AttributeDescription{
+		{
+			Attribute: "new-relic.alert-policy.name",
+			Label: discovery_kit_api.PluralLabel{
+				One:   "New Relic Alert Policy Name",
+				Other: "New Relic Alert Policy Names",
+			},
+		},
+		{
+			Attribute: "new-relic.alert-policy.account",
+			Label: discovery_kit_api.PluralLabel{
+				One:   "New Relic Alert Policy Account",
+				Other: "New Relic Alert Policy Accounts",
+			},
+		},
+		{
+			Attribute: "new-relic.alert-policy.incident-preference",
+			Label: discovery_kit_api.PluralLabel{
+				One:   "New Relic Alert Policy Incident Preference",
+				Other: "New Relic Alert Policy Incident Preferences",
+			},
+		},
+	}
+}
+
+func (d *alertPolicyDiscovery) DiscoverTargets(ctx context.Context) ([]discovery_kit_api.Target, error) {
+	return getAllAlertPolicies(ctx, &config.Config), nil
+}
+
+type GetAlertPoliciesApi interface {
+	GetAccountIds(ctx context.Context) ([]int64, error)
+	GetAlertPolicies(ctx context.Context, accountId int64) ([]types.AlertPolicy, error)
+}
+
+func getAllAlertPolicies(ctx context.Context, api GetAlertPoliciesApi) []discovery_kit_api.Target {
+	result := make([]discovery_kit_api.Target, 0, 100)
+
+	accounts, err := api.GetAccountIds(ctx)
+	if err != nil {
+		log.Err(err).Msgf("Failed to get accounts from New Relic.")
+		return result
+	}
+
+	for _, accountId := range accounts {
+		policies, err := api.GetAlertPolicies(ctx, accountId)
+		if err != nil {
+			log.Err(err).Int64("accountId", accountId).Msgf("Failed to get alert policies from New Relic.")
+			continue
+		}
+		for _, policy := range policies {
+			result = append(result, toPolicyTarget(accountId, policy))
+		}
+	}
+
+	return result
+}
+
+func toPolicyTarget(accountId int64, policy types.AlertPolicy) discovery_kit_api.Target {
+	attributes := make(map[string][]string)
+	attributes["new-relic.alert-policy.id"] = []string{policy.Id}
+	attributes["new-relic.alert-policy.name"] = []string{policy.Name}
+	attributes["new-relic.alert-policy.account"] = []string{fmt.Sprintf("%d", accountId)}
+	if policy.IncidentPreference != "" {
+		attributes["new-relic.alert-policy.incident-preference"] = []string{policy.IncidentPreference}
+	}
+
+	return discovery_kit_api.Target{
+		Id:         fmt.Sprintf("%d/%s", accountId, policy.Id),
+		Label:      policy.Name,
+		TargetType: AlertPolicyTargetId,
+		Attributes: attributes,
+	}
+}
@@ -0,0 +1,154 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2022 Steadybit GmbH
+
+package extalert
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/steadybit/action-kit/go/action_kit_api/v2"
+	"github.com/steadybit/action-kit/go/action_kit_sdk"
+	extension_kit "github.com/steadybit/extension-kit"
+	"github.com/steadybit/extension-kit/extbuild"
+	"github.com/steadybit/extension-kit/extutil"
+	"github.com/steadybit/extension-newrelic/config"
+	"github.com/steadybit/extension-newrelic/types"
+)
+
+type DisableAlertConditionsAction struct{}
+
+// Make sure action implements all required interfaces
+var (
+	_ action_kit_sdk.Action[DisableAlertConditionsState]         = (*DisableAlertConditionsAction)(nil)
+	_ action_kit_sdk.ActionWithStop[DisableAlertConditionsState] = (*DisableAlertConditionsAction)(nil)
+)
+
+type DisableAlertConditionsState struct {
+	AccountId   int64
+	ConditionId string
+	// DisabledCondition is the condition disabled by the action, which is enabled again on
+	// stop. A condition that was disabled before isn't touched.
+	DisabledCondition *types.NrqlCondition
+}
+
+func NewDisableAlertConditionsAction() action_kit_sdk.Action[DisableAlertConditionsState] {
+	return &DisableAlertConditionsAction{}
+}
+
+func (m *DisableAlertConditionsAction) NewEmptyState() DisableAlertConditionsState {
+	return DisableAlertConditionsState{}
+}
+
+func (m *DisableAlertConditionsAction) Describe() action_kit_api.ActionDescription {
+	return action_kit_api.ActionDescription{
+		Id:          DisableAlertConditionsActionId,
+		Label:       "Disable Alert Conditions",
+		Description: "Disable NRQL alert conditions for a given duration, so no incidents are opened.",
+		Version:     extbuild.GetSemverVersionStringOrUnknown(),
+		Icon:        new(alertConditionIcon),
+		TargetSelection: new(action_kit_api.TargetSelection{
+			TargetType:          AlertConditionTargetId,
+			QuantityRestriction: extutil.Ptr(action_kit_api.QuantityRestrictionAll),
+			SelectionTemplates: new([]action_kit_api.TargetSelectionTemplate{
+				{
+					Label: "alert policy name",
+					Query: "new-relic.alert-policy.name=\"\"",
+				},
+				{
+					Label: "alert condition name",
+					Query: "new-relic.alert-condition.name=\"\"",
+				},
+			}),
+		}),
+		Technology: new("New Relic"),
+
+		Kind:        action_kit_api.Other,
+		TimeControl: action_kit_api.TimeControlExternal,
+		Parameters: []action_kit_api.ActionParameter{
+			{
+				Name:         "duration",
+				Label:        "Duration",
+				Description:  new(""),
+				Type:         action_kit_api.ActionParameterTypeDuration,
+				DefaultValue: new("30s"),
+				Order:        new(1),
+				Required:     new(true),
+			},
+		},
+		Stop: new(action_kit_api.MutatingEndpointReference{}),
+	}
+}
+
+func (m *DisableAlertConditionsAction) Prepare(_ context.Context, state *DisableAlertConditionsState, request action_kit_api.PrepareActionRequestBody) (*action_kit_api.PrepareResult, error) {
+	state.AccountId = extutil.ToInt64(request.Target.Attributes["new-relic.alert-condition.account"][0])
+	state.ConditionId = request.Target.Attributes["new-relic.alert-condition.id"][0]
+	return nil, nil
+}
+
+func (m *DisableAlertConditionsAction) Start(ctx context.Context, state *DisableAlertConditionsState) (*action_kit_api.StartResult, error) {
+	return DisableAlertConditionsStart(ctx, state, &config.Config)
+}
+
+func (m *DisableAlertConditionsAction) Stop(ctx context.Context, state *DisableAlertConditionsState) (*action_kit_api.StopResult, error) {
+	return DisableAlertConditionsStop(ctx, state, &config.Config)
+}
+
+type AlertConditionsApi interface {
+	SearchNrqlConditions(ctx context.Context, accountId int64, conditionId string, policyId string) ([]types.NrqlCondition, error)
+	SetNrqlConditionEnabled(ctx context.Context, accountId int64, condition types.NrqlCondition, enabled bool) error
+}
+
+func DisableAlertConditionsStart(ctx context.Context, state *DisableAlertConditionsState, api AlertConditionsApi) (*action_kit_api.StartResult, error) {
+	// The condition is looked up again, as it may have been changed since it was discovered.
+	found, err := api.SearchNrqlConditions(ctx, state.AccountId, state.ConditionId, "")
+	if err != nil {
+		return nil, extension_kit.ToError("Failed to find alert condition in New Relic.", err)
+	}
+	if len(found) == 0 {
+		// The condition was deleted since it was discovered, there is nothing to disable.
+		return &action_kit_api.StartResult{
+			Messages: &action_kit_api.Messages{
+				action_kit_api.Message{Level: extutil.Ptr(action_kit_api.Warn), Message: fmt.Sprintf("Condition %s not found in account %d, skipped.", state.ConditionId, state.AccountId)},
+			},
+		}, nil
+	}
+	condition := found[0]
+
+	if !condition.Enabled {
+		return &action_kit_api.StartResult{
+			Messages: &action_kit_api.Messages{
+				action_kit_api.Message{Level: extutil.Ptr(action_kit_api.Info), Message: fmt.Sprintf("Condition %s is already disabled. (id %s)", condition.Name, condition.Id)},
+			},
+		}, nil
+	}
+	if err := api.SetNrqlConditionEnabled(ctx, state.AccountId, condition, false); err != nil {
+		return nil, extension_kit.ToError(fmt.Sprintf("Failed to disable condition %s in New Relic.", condition.Name), err)
+	}
+	state.DisabledCondition = &condition
+
+	return &action_kit_api.StartResult{
+		Messages: &action_kit_api.Messages{
+			action_kit_api.Message{Level: extutil.Ptr(action_kit_api.Info), Message: fmt.Sprintf("Condition %s disabled. (id %s)", condition.Name, condition.Id)},
+		},
+	}, nil
+}
+
+// DisableAlertConditionsStop enables the disabled condition again. The condition is kept in
+// the state until that succeeded, so stopping again retries it.
+func DisableAlertConditionsStop(ctx context.Context, state *DisableAlertConditionsState, api AlertConditionsApi) (*action_kit_api.StopResult, error) {
+	if state.DisabledCondition == nil {
+		return nil, nil
+	}
+
+	condition := *state.DisabledCondition
+	if err := api.SetNrqlConditionEnabled(ctx, state.AccountId, condition, true); err != nil {
+		return nil, extension_kit.ToError(fmt.Sprintf("Failed to enable condition %s in New Relic.", condition.Name), err)
+	}
+	state.DisabledCondition = nil
+	return &action_kit_api.StopResult{
+		Messages: &action_kit_api.Messages{
+			action_kit_api.Message{Level: extutil.Ptr(action_kit_api.Info), Message: fmt.Sprintf("Condition %s enabled again. (id %s)", condition.Name, condition.Id)},
+		},
+	}, nil
+}
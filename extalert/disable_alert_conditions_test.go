@@ -0,0 +1,140 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2022 Steadybit GmbH
+
+package extalert
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/steadybit/extension-newrelic/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type alertConditionsApiMock struct {
+	// conditions are the conditions per account and id.
+	conditions map[int64]map[string]types.NrqlCondition
+	failIds    map[string]bool
+}
+
+func newAlertConditionsApiMock(conditions ...types.NrqlCondition) *alertConditionsApiMock {
+	m := &alertConditionsApiMock{conditions: make(map[int64]map[string]types.NrqlCondition), failIds: make(map[string]bool)}
+	for _, condition := range conditions {
+		m.add(1234, condition)
+	}
+	return m
+}
+
+func (m *alertConditionsApiMock) add(accountId int64, condition types.NrqlCondition) {
+	if m.conditions[accountId] == nil {
+		m.conditions[accountId] = make(map[string]types.NrqlCondition)
+	}
+	m.conditions[accountId][condition.Id] = condition
+}
+
+func (m *alertConditionsApiMock) SearchNrqlConditions(_ context.Context, accountId int64, conditionId string, _ string) ([]types.NrqlCondition, error) {
+	if condition, ok := m.conditions[accountId][conditionId]; ok {
+		return []types.NrqlCondition{condition}, nil
+	}
+	return nil, nil
+}
+
+func (m *alertConditionsApiMock) SetNrqlConditionEnabled(_ context.Context, accountId int64, condition types.NrqlCondition, enabled bool) error {
+	if m.failIds[condition.Id] {
+		return errors.New("forbidden")
+	}
+	if _, ok := m.conditions[accountId][condition.Id]; !ok {
+		return errors.New("not found")
+	}
+	condition.Enabled = enabled
+	m.conditions[accountId][condition.Id] = condition
+	return nil
+}
+
+func TestDisableAlertConditionsRestoresPreviousState(t *testing.T) {
+	api := newAlertConditionsApiMock(types.NrqlCondition{Id: "1", Name: "Error rate", Enabled: true, PolicyId: "p1", Type: "STATIC"})
+	state := &DisableAlertConditionsState{AccountId: 1234, ConditionId: "1"}
+
+	result, err := DisableAlertConditionsStart(context.Background(), state, api)
+	require.NoError(t, err)
+	assert.Equal(t, "Condition Error rate disabled. (id 1)", (*result.Messages)[0].Message)
+	assert.False(t, api.conditions[1234]["1"].Enabled)
+	require.NotNil(t, state.DisabledCondition)
+
+	_, err = DisableAlertConditionsStop(context.Background(), state, api)
+	require.NoError(t, err)
+	assert.True(t, api.conditions[1234]["1"].Enabled)
+	assert.Nil(t, state.DisabledCondition)
+
+	stopResult, err := DisableAlertConditionsStop(context.Background(), state, api)
+	require.NoError(t, err)
+	assert.Nil(t, stopResult)
+}
+
+func TestDisableAlertConditionsLeavesDisabledConditionDisabled(t *testing.T) {
+	api := newAlertConditionsApiMock(types.NrqlCondition{Id: "2", Name: "Latency", Enabled: false, PolicyId: "p1", Type: "BASELINE"})
+	state := &DisableAlertConditionsState{AccountId: 1234, ConditionId: "2"}
+
+	_, err := DisableAlertConditionsStart(context.Background(), state, api)
+	require.NoError(t, err)
+	assert.Nil(t, state.DisabledCondition)
+
+	stopResult, err := DisableAlertConditionsStop(context.Background(), state, api)
+	require.NoError(t, err)
+	assert.Nil(t, stopResult)
+	assert.False(t, api.conditions[1234]["2"].Enabled)
+}
+
+func TestDisableAlertConditionsRetriesFailedStop(t *testing.T) {
+	api := newAlertConditionsApiMock(types.NrqlCondition{Id: "1", Name: "Error rate", Enabled: true, PolicyId: "p1", Type: "STATIC"})
+	state := &DisableAlertConditionsState{AccountId: 1234, ConditionId: "1"}
+	_, err := DisableAlertConditionsStart(context.Background(), state, api)
+	require.NoError(t, err)
+
+	api.failIds["1"] = true
+	_, err = DisableAlertConditionsStop(context.Background(), state, api)
+	assert.ErrorContains(t, err, "Error rate")
+	assert.NotNil(t, state.DisabledCondition)
+
+	api.failIds["1"] = false
+	_, err = DisableAlertConditionsStop(context.Background(), state, api)
+	require.NoError(t, err)
+	assert.True(t, api.conditions[1234]["1"].Enabled)
+}
+
+func TestDisableAlertConditionsOfTwoAccounts(t *testing.T) {
+	api := newAlertConditionsApiMock()
+	api.add(1, types.NrqlCondition{Id: "1", Name: "Error rate", Enabled: true, PolicyId: "p1", Type: "STATIC"})
+	api.add(2, types.NrqlCondition{Id: "2", Name: "Error rate", Enabled: true, PolicyId: "p2", Type: "STATIC"})
+	first := &DisableAlertConditionsState{AccountId: 1, ConditionId: "1"}
+	second := &DisableAlertConditionsState{AccountId: 2, ConditionId: "2"}
+
+	_, err := DisableAlertConditionsStart(context.Background(), first, api)
+	require.NoError(t, err)
+	_, err = DisableAlertConditionsStart(context.Background(), second, api)
+	require.NoError(t, err)
+	assert.False(t, api.conditions[1]["1"].Enabled)
+	assert.False(t, api.conditions[2]["2"].Enabled)
+
+	_, err = DisableAlertConditionsStop(context.Background(), first, api)
+	require.NoError(t, err)
+	_, err = DisableAlertConditionsStop(context.Background(), second, api)
+	require.NoError(t, err)
+	assert.True(t, api.conditions[1]["1"].Enabled)
+	assert.True(t, api.conditions[2]["2"].Enabled)
+}
+
+func TestDisableAlertConditionsSkipsConditionMissingInAccount(t *testing.T) {
+	api := newAlertConditionsApiMock()
+	api.add(1, types.NrqlCondition{Id: "1", Name: "Error rate", Enabled: true, PolicyId: "p1", Type: "STATIC"})
+	state := &DisableAlertConditionsState{AccountId: 2, ConditionId: "1"}
+
+	result, err := DisableAlertConditionsStart(context.Background(), state, api)
+
+	require.NoError(t, err)
+	assert.Equal(t, "Condition 1 not found in account 2, skipped.", (*result.Messages)[0].Message)
+	assert.Nil(t, state.DisabledCondition)
+	assert.True(t, api.conditions[1]["1"].Enabled)
+}
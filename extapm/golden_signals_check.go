@@ -0,0 +1,575 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2022 Steadybit GmbH
+
+package extapm
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/steadybit/action-kit/go/action_kit_api/v2"
+	"github.com/steadybit/action-kit/go/action_kit_sdk"
+	extension_kit "github.com/steadybit/extension-kit"
+	"github.com/steadybit/extension-kit/extbuild"
+	"github.com/steadybit/extension-kit/extutil"
+	"github.com/steadybit/extension-newrelic/config"
+)
+
+type GoldenSignalsCheckAction struct{}
+
+// Make sure action implements all required interfaces
+var (
+	_ action_kit_sdk.Action[GoldenSignalsCheckState]           = (*GoldenSignalsCheckAction)(nil)
+	_ action_kit_sdk.ActionWithStatus[GoldenSignalsCheckState] = (*GoldenSignalsCheckAction)(nil)
+)
+
+type GoldenSignalsCheckState struct {
+	Start              time.Time
+	End                time.Time
+	AccountId          int64
+	EntityGuid         string
+	EntityName         string
+	LimitMode          string
+	ConditionCheckMode string
+	// Limits holds the configured limit per golden signal name. Signals without a limit are
+	// only shown, not checked.
+	Limits map[string]float64
+	// BaselineWindow is the time before the step the baseline is computed over.
+	BaselineWindow time.Duration
+	// Baseline holds the value of each golden signal before the step started. It is only
+	// captured for limitModeRelativeToBaseline and limitModeStandardDeviations.
+	Baseline map[string]float64
+	// BaselineStdDev holds the standard deviation of each golden signal before the step
+	// started. It is only captured for limitModeStandardDeviations.
+	BaselineStdDev        map[string]float64
+	ConditionCheckSuccess bool
+}
+
+type goldenSignal struct {
+	name  string
+	title string
+	unit  string
+	// upperBound is set for signals that must not exceed their limit (error rate, response
+	// time), as opposed to signals that must not fall below it (throughput).
+	upperBound bool
+	// minStdDev is the smallest standard deviation of the baseline, so a flat baseline
+	// doesn't fail the check on the slightest change.
+	minStdDev float64
+}
+
+const (
+	seriesValue    = "value"
+	seriesBaseline = "baseline"
+)
+
+var goldenSignals = []goldenSignal{
+	{name: "throughput", title: "Throughput", unit: "rpm", upperBound: false, minStdDev: 1},
+	{name: "errorRate", title: "Error rate", unit: "%", upperBound: true, minStdDev: 0.1},
+	{name: "responseTime", title: "Response time", unit: "ms", upperBound: true, minStdDev: 1},
+}
+
+// goldenSignalsNrql queries the APM golden metrics of an entity, like New Relic does on the
+// entity's summary page. The select items are aliased to the golden signal names. The query
+// is fixed rather than taken from the entity's golden metrics in NerdGraph, as those can be
+// customized per account, with other names and units the limits wouldn't apply to.
+const goldenSignalsNrql = "SELECT rate(count(apm.service.transaction.duration), 1 minute) AS 'throughput', " +
+	"count(apm.service.error.count) / count(apm.service.transaction.duration) * 100 AS 'errorRate', " +
+	"average(apm.service.transaction.duration) * 1000 AS 'responseTime' " +
+	"FROM Metric WHERE entity.guid = %s SINCE %d UNTIL %d"
+
+const (
+	// defaultBaselineWindow is the time before the step used to compute the baseline, unless
+	// configured otherwise.
+	defaultBaselineWindow = 5 * time.Minute
+	// evaluationWindow is the sliding window each status call evaluates. It is also the bucket
+	// size used to compute the standard deviation of the baseline, so both are comparable.
+	evaluationWindow = 1 * time.Minute
+	// maxTimeseriesBuckets is the most buckets NRQL returns for a TIMESERIES query, which
+	// limits the baseline window in standard deviation mode.
+	maxTimeseriesBuckets = 366
+	// minRelativeStdDev is the smallest standard deviation of the baseline relative to its
+	// mean, in addition to the minimum of each signal.
+	minRelativeStdDev = 0.01
+)
+
+func NewGoldenSignalsCheckAction() action_kit_sdk.Action[GoldenSignalsCheckState] {
+	return &GoldenSignalsCheckAction{}
+}
+
+func (m *GoldenSignalsCheckAction) NewEmptyState() GoldenSignalsCheckState {
+	return GoldenSignalsCheckState{}
+}
+
+func (m *GoldenSignalsCheckAction) Describe() action_kit_api.ActionDescription {
+	widgets := make([]action_kit_api.Widget, 0, len(goldenSignals))
+	for _, signal := range goldenSignals {
+		widgets = append(widgets, action_kit_api.LineChartWidget{
+			Type:  action_kit_api.ComSteadybitWidgetLineChart,
+			Title: fmt.Sprintf("New Relic %s", signal.title),
+			Identity: action_kit_api.LineChartWidgetIdentityConfig{
+				MetricName: metricName(signal),
+				From:       "service",
+				Mode:       action_kit_api.ComSteadybitWidgetLineChartIdentityModeWidgetPerValue,
+			},
+			Grouping: new(action_kit_api.LineChartWidgetGroupingConfig{
+				ShowSummary: new(false),
+				Groups: []action_kit_api.LineChartWidgetGroup{
+					{
+						Title: "Baseline",
+						Color: "warn",
+						Matcher: action_kit_api.LineChartWidgetGroupMatcherKeyEqualsValue{
+							Type:  action_kit_api.ComSteadybitWidgetLineChartGroupMatcherKeyEqualsValue,
+							Key:   "series",
+							Value: seriesBaseline,
+						},
+					},
+					{
+						Title: signal.title,
+						Color: "success",
+						Matcher: action_kit_api.LineChartWidgetGroupMatcherFallback{
+							Type: action_kit_api.ComSteadybitWidgetLineChartGroupMatcherFallback,
+						},
+					},
+				},
+			}),
+			Tooltip: new(action_kit_api.LineChartWidgetTooltipConfig{
+				MetricValueTitle: new(signal.title),
+				MetricValueUnit:  new(signal.unit),
+				AdditionalContent: []action_kit_api.LineChartWidgetTooltipContent{
+					{
+						From:  "limit",
+						Title: "Limit",
+						Unit:  new(signal.unit),
+					},
+				},
+			}),
+		})
+	}
+
+	return action_kit_api.ActionDescription{
+		Id:          GoldenSignalsCheckActionId,
+		Label:       "Golden Signals Check",
+		Description: "Checks throughput, error rate and response time of an APM service.",
+		Version:     extbuild.GetSemverVersionStringOrUnknown(),
+		Icon:        new(goldenSignalsCheckActionIcon),
+		TargetSelection: new(action_kit_api.TargetSelection{
+			TargetType:          ServiceTargetId,
+			QuantityRestriction: extutil.Ptr(action_kit_api.QuantityRestrictionAll),
+			SelectionTemplates: new([]action_kit_api.TargetSelectionTemplate{
+				{
+					Label: "service name",
+					Query: "new-relic.apm-service.name=\"\"",
+				},
+			}),
+		}),
+		Technology: new("New Relic"),
+
+		Kind:        action_kit_api.Check,
+		TimeControl: action_kit_api.TimeControlInternal,
+		Parameters: []action_kit_api.ActionParameter{
+			{
+				Name:         "duration",
+				Label:        "Duration",
+				Description:  new(""),
+				Type:         action_kit_api.ActionParameterTypeDuration,
+				DefaultValue: new("30s"),
+				Order:        new(1),
+				Required:     new(true),
+			},
+			{
+				Name:         "limitMode",
+				Label:        "Limit Mode",
+				Description:  new("Are the limits absolute values, or the allowed deviation from the values before the step started, in percent or in standard deviations?"),
+				Type:         action_kit_api.ActionParameterTypeString,
+				DefaultValue: new(limitModeAbsolute),
+				Options: new([]action_kit_api.ParameterOption{
+					action_kit_api.ExplicitParameterOption{
+						Label: "Absolute",
+						Value: limitModeAbsolute,
+					},
+					action_kit_api.ExplicitParameterOption{
+						Label: "Percent deviation from baseline",
+						Value: limitModeRelativeToBaseline,
+					},
+					action_kit_api.ExplicitParameterOption{
+						Label: "Standard deviations from baseline",
+						Value: limitModeStandardDeviations,
+					},
+				}),
+				Required: new(true),
+				Order:    new(2),
+			},
+			{
+				Name:         "baselineWindow",
+				Label:        "Baseline Window",
+				Description:  new("The time before the step the baseline is computed over. Only used if the limits are relative to the baseline. At most 6h for limits in standard deviations."),
+				Type:         action_kit_api.ActionParameterTypeDuration,
+				DefaultValue: new("5m"),
+				Order:        new(3),
+				Required:     new(false),
+				Advanced:     new(true),
+			},
+			{
+				Name:        "throughputLimit",
+				Label:       "Minimum Throughput",
+				Description: new("The minimum throughput in requests per minute, or the allowed decrease from the baseline. Leave empty to not check the throughput."),
+				Type:        action_kit_api.ActionParameterTypeString,
+				Order:       new(4),
+				Required:    new(false),
+			},
+			{
+				Name:        "errorRateLimit",
+				Label:       "Maximum Error Rate",
+				Description: new("The maximum error rate in percent, like 0.5, or the allowed increase over the baseline. Leave empty to not check the error rate."),
+				Type:        action_kit_api.ActionParameterTypeString,
+				Order:       new(5),
+				Required:    new(false),
+			},
+			{
+				Name:        "responseTimeLimit",
+				Label:       "Maximum Response Time",
+				Description: new("The maximum response time in milliseconds, or the allowed increase over the baseline. Leave empty to not check the response time."),
+				Type:        action_kit_api.ActionParameterTypeString,
+				Order:       new(6),
+				Required:    new(false),
+			},
+			{
+				Name:         "conditionCheckMode",
+				Label:        "Condition Check Mode",
+				Description:  new("Should the step succeed if the condition is met at least once or all the time?"),
+				Type:         action_kit_api.ActionParameterTypeString,
+				DefaultValue: new(conditionCheckModeAllTheTime),
+				Options: new([]action_kit_api.ParameterOption{
+					action_kit_api.ExplicitParameterOption{
+						Label: "All the time",
+						Value: conditionCheckModeAllTheTime,
+					},
+					action_kit_api.ExplicitParameterOption{
+						Label: "At least once",
+						Value: conditionCheckModeAtLeastOnce,
+					},
+				}),
+				Required: new(true),
+				Order:    new(7),
+			},
+		},
+		Widgets: new(widgets),
+		Prepare: action_kit_api.MutatingEndpointReference{},
+		Start:   action_kit_api.MutatingEndpointReference{},
+		Status: new(action_kit_api.MutatingEndpointReferenceWithCallInterval{
+			CallInterval: new("10s"),
+		}),
+	}
+}
+
+func (m *GoldenSignalsCheckAction) Prepare(ctx context.Context, state *GoldenSignalsCheckState, request action_kit_api.PrepareActionRequestBody) (*action_kit_api.PrepareResult, error) {
+	duration := request.Config["duration"].(float64)
+	state.Start = time.Now()
+	state.End = state.Start.Add(time.Millisecond * time.Duration(duration))
+	state.AccountId = extutil.ToInt64(request.Target.Attributes["new-relic.apm-service.account"][0])
+	state.EntityGuid = request.Target.Attributes["new-relic.apm-service.guid"][0]
+	state.EntityName = request.Target.Attributes["new-relic.apm-service.name"][0]
+	state.LimitMode = limitModeAbsolute
+	if request.Config["limitMode"] != nil {
+		state.LimitMode = fmt.Sprintf("%v", request.Config["limitMode"])
+	}
+	if request.Config["conditionCheckMode"] != nil {
+		state.ConditionCheckMode = fmt.Sprintf("%v", request.Config["conditionCheckMode"])
+	}
+	state.BaselineWindow = defaultBaselineWindow
+	if request.Config["baselineWindow"] != nil {
+		state.BaselineWindow = time.Millisecond * time.Duration(extutil.ToInt64(request.Config["baselineWindow"]))
+	}
+	limits, err := parseLimits(request.Config)
+	if err != nil {
+		return nil, err
+	}
+	state.Limits = limits
+
+	if state.LimitMode == limitModeRelativeToBaseline || state.LimitMode == limitModeStandardDeviations {
+		return nil, GoldenSignalsCheckPrepareBaseline(ctx, state, &config.Config)
+	}
+	return nil, nil
+}
+
+func (m *GoldenSignalsCheckAction) Start(ctx context.Context, state *GoldenSignalsCheckState) (*action_kit_api.StartResult, error) {
+	statusResult, err := GoldenSignalsCheckStatus(ctx, state, &config.Config)
+	if statusResult == nil {
+		return nil, err
+	}
+	startResult := action_kit_api.StartResult{
+		Artifacts: statusResult.Artifacts,
+		Error:     statusResult.Error,
+		Messages:  statusResult.Messages,
+		Metrics:   statusResult.Metrics,
+	}
+	return &startResult, err
+}
+
+func (m *GoldenSignalsCheckAction) Status(ctx context.Context, state *GoldenSignalsCheckState) (*action_kit_api.StatusResult, error) {
+	return GoldenSignalsCheckStatus(ctx, state, &config.Config)
+}
+
+// parseLimits parses the configured limits. They are strings, as there is no parameter type
+// for decimals, which limits like an error rate of 0.5% need.
+func parseLimits(config map[string]any) (map[string]float64, error) {
+	limits := make(map[string]float64)
+	for _, signal := range goldenSignals {
+		value, ok := config[signal.name+"Limit"]
+		if !ok || value == nil {
+			continue
+		}
+		if number, isNumber := value.(float64); isNumber {
+			limits[signal.name] = number
+			continue
+		}
+		text := strings.TrimSpace(extutil.ToString(value))
+		if text == "" {
+			continue
+		}
+		limit, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return nil, extension_kit.ToError(fmt.Sprintf("The %s limit '%s' is not a number.", strings.ToLower(signal.title), text), err)
+		}
+		limits[signal.name] = limit
+	}
+	return limits, nil
+}
+
+type NrqlApi interface {
+	QueryNrql(ctx context.Context, accountId int64, query string) ([]map[string]any, error)
+}
+
+// GoldenSignalsCheckPrepareBaseline captures the golden signals before the step started.
+// Every signal with a limit needs a baseline, otherwise the limit cannot be applied.
+func GoldenSignalsCheckPrepareBaseline(ctx context.Context, state *GoldenSignalsCheckState, api NrqlApi) error {
+	if state.LimitMode == limitModeStandardDeviations && state.BaselineWindow > maxTimeseriesBuckets*evaluationWindow {
+		return extension_kit.ToError(fmt.Sprintf("The baseline window must not exceed %s for limits in standard deviations.", maxTimeseriesBuckets*evaluationWindow), nil)
+	}
+	since := state.Start.Add(-state.BaselineWindow)
+	var baseline, stdDev map[string]float64
+	var err error
+	if state.LimitMode == limitModeStandardDeviations {
+		baseline, stdDev, err = queryGoldenSignalsDistribution(ctx, api, state.AccountId, state.EntityGuid, since, state.Start)
+	} else {
+		baseline, err = queryGoldenSignals(ctx, api, state.AccountId, state.EntityGuid, since, state.Start)
+	}
+	if err != nil {
+		return extension_kit.ToError("Failed to get the golden signals baseline from New Relic.", err)
+	}
+
+	state.Baseline = make(map[string]float64)
+	state.BaselineStdDev = make(map[string]float64)
+	for _, signal := range goldenSignals {
+		if _, limited := state.Limits[signal.name]; !limited {
+			continue
+		}
+		value, ok := baseline[signal.name]
+		if !ok {
+			return extension_kit.ToError(fmt.Sprintf("Not enough %s data for %s in the %s before the step to compute a baseline.", strings.ToLower(signal.title), state.EntityName, state.BaselineWindow), nil)
+		}
+		state.Baseline[signal.name] = value
+		if stdDev != nil {
+			state.BaselineStdDev[signal.name] = max(stdDev[signal.name], signal.minStdDev, math.Abs(value)*minRelativeStdDev)
+		}
+	}
+	return nil
+}
+
+func GoldenSignalsCheckStatus(ctx context.Context, state *GoldenSignalsCheckState, api NrqlApi) (*action_kit_api.StatusResult, error) {
+	now := time.Now()
+	values, err := queryGoldenSignals(ctx, api, state.AccountId, state.EntityGuid, now.Add(-evaluationWindow), now)
+	if err != nil {
+		return nil, extension_kit.ToError("Failed to get golden signals from New Relic.", err)
+	}
+
+	violations := make([]string, 0)
+	metrics := make([]action_kit_api.Metric, 0, len(goldenSignals))
+	for _, signal := range goldenSignals {
+		value, ok := values[signal.name]
+		if !ok {
+			continue
+		}
+		limit, limited := effectiveLimit(state, signal)
+		if limited && exceeds(signal, value, limit) {
+			violations = append(violations, violationMessage(state, signal, value, limit))
+		}
+		metrics = append(metrics, toMetrics(state, signal, value, limit, limited, now)...)
+	}
+
+	completed := now.After(state.End)
+	var checkError *action_kit_api.ActionKitError
+	if state.ConditionCheckMode == conditionCheckModeAllTheTime {
+		if len(violations) > 0 {
+			checkError = new(action_kit_api.ActionKitError{
+				Title:  strings.Join(violations, ", "),
+				Status: extutil.Ptr(action_kit_api.Failed),
+			})
+		}
+	} else if state.ConditionCheckMode == conditionCheckModeAtLeastOnce {
+		if len(violations) == 0 {
+			state.ConditionCheckSuccess = true
+		}
+		if completed && !state.ConditionCheckSuccess {
+			checkError = new(action_kit_api.ActionKitError{
+				Title:  fmt.Sprintf("Golden signals of %s were never within their limits.", state.EntityName),
+				Status: extutil.Ptr(action_kit_api.Failed),
+			})
+		}
+	}
+
+	return &action_kit_api.StatusResult{
+		Completed: completed,
+		Error:     checkError,
+		Metrics:   new(metrics),
+	}, nil
+}
+
+// effectiveLimit resolves the configured limit of a signal to an absolute value.
+func effectiveLimit(state *GoldenSignalsCheckState, signal goldenSignal) (float64, bool) {
+	limit, ok := state.Limits[signal.name]
+	if !ok {
+		return 0, false
+	}
+	if state.LimitMode == limitModeAbsolute {
+		return limit, true
+	}
+	baseline := state.Baseline[signal.name]
+	deviation := baseline * limit / 100
+	if state.LimitMode == limitModeStandardDeviations {
+		deviation = state.BaselineStdDev[signal.name] * limit
+	}
+	if signal.upperBound {
+		return baseline + deviation, true
+	}
+	return baseline - deviation, true
+}
+
+func exceeds(signal goldenSignal, value float64, limit float64) bool {
+	if signal.upperBound {
+		return value > limit
+	}
+	return value < limit
+}
+
+func violationMessage(state *GoldenSignalsCheckState, signal goldenSignal, value float64, limit float64) string {
+	direction := "below"
+	if signal.upperBound {
+		direction = "above"
+	}
+	message := fmt.Sprintf("%s of %s is %.2f %s, %s the limit of %.2f %s", signal.title, state.EntityName, value, signal.unit, direction, limit, signal.unit)
+	if state.LimitMode == limitModeRelativeToBaseline {
+		message += fmt.Sprintf(" (baseline %.2f %s)", state.Baseline[signal.name], signal.unit)
+	} else if state.LimitMode == limitModeStandardDeviations {
+		message += fmt.Sprintf(" (baseline %.2f %s, standard deviation %.2f %s)", state.Baseline[signal.name], signal.unit, state.BaselineStdDev[signal.name], signal.unit)
+	}
+	return message
+}
+
+// queryGoldenSignals returns the golden signals of an entity within the given time range.
+// Signals without data (e.g. the error rate without any transactions) are omitted.
+func queryGoldenSignals(ctx context.Context, api NrqlApi, accountId int64, entityGuid string, since time.Time, until time.Time) (map[string]float64, error) {
+	query := fmt.Sprintf(goldenSignalsNrql, config.NrqlString(entityGuid), since.UnixMilli(), until.UnixMilli())
+	results, err := api.QueryNrql(ctx, accountId, query)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]float64)
+	if len(results) == 0 {
+		return values, nil
+	}
+	for _, signal := range goldenSignals {
+		if value, ok := results[0][signal.name].(float64); ok {
+			values[signal.name] = value
+		} else {
+			log.Debug().Str("entityGuid", entityGuid).Str("signal", signal.name).Msg("No golden signal data.")
+		}
+	}
+	return values, nil
+}
+
+// queryGoldenSignalsDistribution returns the mean and the standard deviation of the golden
+// signals of an entity within the given time range, computed over buckets the size of the
+// evaluationWindow. Signals with data in less than two buckets are omitted.
+func queryGoldenSignalsDistribution(ctx context.Context, api NrqlApi, accountId int64, entityGuid string, since time.Time, until time.Time) (map[string]float64, map[string]float64, error) {
+	query := fmt.Sprintf(goldenSignalsNrql+" TIMESERIES %d seconds", config.NrqlString(entityGuid), since.UnixMilli(), until.UnixMilli(), int(evaluationWindow.Seconds()))
+	results, err := api.QueryNrql(ctx, accountId, query)
+	if err != nil {
+		return nil, nil, err
+	}
+	means := make(map[string]float64)
+	stdDevs := make(map[string]float64)
+	for _, signal := range goldenSignals {
+		values := make([]float64, 0, len(results))
+		for _, result := range results {
+			if value, ok := result[signal.name].(float64); ok {
+				values = append(values, value)
+			}
+		}
+		if len(values) < 2 {
+			log.Debug().Str("entityGuid", entityGuid).Str("signal", signal.name).Int("buckets", len(values)).Msg("Not enough golden signal data.")
+			continue
+		}
+		means[signal.name], stdDevs[signal.name] = meanAndStdDev(values)
+	}
+	return means, stdDevs, nil
+}
+
+// meanAndStdDev returns the mean and the population standard deviation of the values.
+func meanAndStdDev(values []float64) (float64, float64) {
+	var sum float64
+	for _, value := range values {
+		sum += value
+	}
+	mean := sum / float64(len(values))
+	var squares float64
+	for _, value := range values {
+		squares += (value - mean) * (value - mean)
+	}
+	return mean, math.Sqrt(squares / float64(len(values)))
+}
+
+func metricName(signal goldenSignal) string {
+	return fmt.Sprintf("new_relic_golden_signal_%s", signal.name)
+}
+
+// toMetrics renders the value of a golden signal and, if there is one, its baseline as a
+// separate series, which the widget draws as a reference line.
+func toMetrics(state *GoldenSignalsCheckState, signal goldenSignal, value float64, limit float64, limited bool, now time.Time) []action_kit_api.Metric {
+	limitString := ""
+	if limited {
+		limitString = fmt.Sprintf("%.2f", limit)
+	}
+	metrics := []action_kit_api.Metric{
+		{
+			Name: new(metricName(signal)),
+			Metric: map[string]string{
+				"newrelic.entity-guid": state.EntityGuid,
+				"service":              state.EntityName,
+				"series":               seriesValue,
+				"limit":                limitString,
+			},
+			Timestamp: now,
+			Value:     value,
+		},
+	}
+	if baseline, ok := state.Baseline[signal.name]; ok {
+		metrics = append(metrics, action_kit_api.Metric{
+			Name: new(metricName(signal)),
+			Metric: map[string]string{
+				"newrelic.entity-guid": state.EntityGuid,
+				"service":              state.EntityName,
+				"series":               seriesBaseline,
+				"limit":                limitString,
+			},
+			Timestamp: now,
+			Value:     baseline,
+		})
+	}
+	return metrics
+}
@@ -0,0 +1,141 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2022 Steadybit GmbH
+
+package extapm
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type nrqlApiMock struct {
+	results []map[string]any
+	queries []string
+}
+
+func (m *nrqlApiMock) QueryNrql(_ context.Context, _ int64, query string) ([]map[string]any, error) {
+	m.queries = append(m.queries, query)
+	return m.results, nil
+}
+
+func newGoldenSignalsState(limitMode string, limits map[string]float64) *GoldenSignalsCheckState {
+	return &GoldenSignalsCheckState{
+		Start:              time.Now(),
+		End:                time.Now().Add(time.Minute),
+		AccountId:          1234,
+		EntityGuid:         "guid-1",
+		EntityName:         "checkout",
+		LimitMode:          limitMode,
+		ConditionCheckMode: conditionCheckModeAllTheTime,
+		Limits:             limits,
+	}
+}
+
+func TestGoldenSignalsCheckAbsoluteLimits(t *testing.T) {
+	api := &nrqlApiMock{results: []map[string]any{{"throughput": 40.0, "errorRate": 1.5, "responseTime": 120.0}}}
+	state := newGoldenSignalsState(limitModeAbsolute, map[string]float64{"throughput": 50, "errorRate": 5})
+
+	result, err := GoldenSignalsCheckStatus(context.Background(), state, api)
+
+	require.NoError(t, err)
+	require.NotNil(t, result.Error)
+	assert.Equal(t, "Throughput of checkout is 40.00 rpm, below the limit of 50.00 rpm", result.Error.Title)
+	assert.Len(t, *result.Metrics, 3)
+	assert.Contains(t, api.queries[0], "entity.guid = 'guid-1'")
+}
+
+func TestGoldenSignalsCheckRelativeToBaseline(t *testing.T) {
+	api := &nrqlApiMock{results: []map[string]any{{"throughput": 100.0, "errorRate": nil, "responseTime": 100.0}}}
+	state := newGoldenSignalsState(limitModeRelativeToBaseline, map[string]float64{"responseTime": 50})
+	state.BaselineWindow = defaultBaselineWindow
+
+	require.NoError(t, GoldenSignalsCheckPrepareBaseline(context.Background(), state, api))
+	assert.Equal(t, map[string]float64{"responseTime": 100}, state.Baseline)
+
+	api.results = []map[string]any{{"throughput": 100.0, "errorRate": nil, "responseTime": 160.0}}
+	result, err := GoldenSignalsCheckStatus(context.Background(), state, api)
+
+	require.NoError(t, err)
+	require.NotNil(t, result.Error)
+	assert.Equal(t, "Response time of checkout is 160.00 ms, above the limit of 150.00 ms (baseline 100.00 ms)", result.Error.Title)
+	// No error rate without data, but a baseline series next to the response time.
+	require.Len(t, *result.Metrics, 3)
+	assert.Equal(t, seriesBaseline, (*result.Metrics)[2].Metric["series"])
+	assert.Equal(t, 100.0, (*result.Metrics)[2].Value)
+}
+
+func TestGoldenSignalsCheckStandardDeviations(t *testing.T) {
+	api := &nrqlApiMock{results: []map[string]any{
+		{"throughput": 90.0, "errorRate": 1.0, "responseTime": 100.0},
+		{"throughput": 110.0, "errorRate": 1.0, "responseTime": 100.0},
+		{"throughput": 100.0, "errorRate": nil, "responseTime": 100.0},
+	}}
+	state := newGoldenSignalsState(limitModeStandardDeviations, map[string]float64{"throughput": 2})
+	state.BaselineWindow = 3 * time.Minute
+
+	require.NoError(t, GoldenSignalsCheckPrepareBaseline(context.Background(), state, api))
+	assert.Contains(t, api.queries[0], "TIMESERIES 60 seconds")
+	assert.InDelta(t, 100.0, state.Baseline["throughput"], 0.001)
+	assert.InDelta(t, 8.165, state.BaselineStdDev["throughput"], 0.001)
+
+	api.results = []map[string]any{{"throughput": 80.0, "errorRate": nil, "responseTime": 100.0}}
+	result, err := GoldenSignalsCheckStatus(context.Background(), state, api)
+
+	require.NoError(t, err)
+	require.NotNil(t, result.Error)
+	assert.Equal(t, "Throughput of checkout is 80.00 rpm, below the limit of 83.67 rpm (baseline 100.00 rpm, standard deviation 8.16 rpm)", result.Error.Title)
+}
+
+// A flat baseline has no standard deviation, which must not fail the check on any change.
+func TestGoldenSignalsCheckStandardDeviationsOfFlatBaseline(t *testing.T) {
+	api := &nrqlApiMock{results: []map[string]any{
+		{"throughput": 100.0, "errorRate": 0.0, "responseTime": 100.0},
+		{"throughput": 100.0, "errorRate": 0.0, "responseTime": 100.0},
+	}}
+	state := newGoldenSignalsState(limitModeStandardDeviations, map[string]float64{"errorRate": 3, "responseTime": 3})
+	state.BaselineWindow = 2 * time.Minute
+
+	require.NoError(t, GoldenSignalsCheckPrepareBaseline(context.Background(), state, api))
+	assert.Equal(t, 0.1, state.BaselineStdDev["errorRate"])
+	assert.Equal(t, 1.0, state.BaselineStdDev["responseTime"])
+
+	api.results = []map[string]any{{"throughput": 100.0, "errorRate": 0.2, "responseTime": 102.0}}
+	result, err := GoldenSignalsCheckStatus(context.Background(), state, api)
+
+	require.NoError(t, err)
+	assert.Nil(t, result.Error)
+}
+
+func TestGoldenSignalsCheckRejectsTooLongBaselineForStandardDeviations(t *testing.T) {
+	api := &nrqlApiMock{}
+	state := newGoldenSignalsState(limitModeStandardDeviations, map[string]float64{"throughput": 2})
+	state.BaselineWindow = 7 * time.Hour
+
+	assert.ErrorContains(t, GoldenSignalsCheckPrepareBaseline(context.Background(), state, api), "6h6m0s")
+	assert.Empty(t, api.queries)
+}
+
+// A limit cannot be made relative to a baseline without data.
+func TestGoldenSignalsCheckFailsWithoutBaseline(t *testing.T) {
+	api := &nrqlApiMock{results: []map[string]any{{"throughput": 0.0, "errorRate": nil, "responseTime": nil}}}
+	state := newGoldenSignalsState(limitModeRelativeToBaseline, map[string]float64{"errorRate": 10})
+
+	assert.Error(t, GoldenSignalsCheckPrepareBaseline(context.Background(), state, api))
+}
+
+func TestGoldenSignalsCheckParsesDecimalLimits(t *testing.T) {
+	limits, err := parseLimits(map[string]any{"errorRateLimit": "0.5", "responseTimeLimit": float64(250), "throughputLimit": ""})
+
+	require.NoError(t, err)
+	assert.Equal(t, map[string]float64{"errorRate": 0.5, "responseTime": 250}, limits)
+}
+
+func TestGoldenSignalsCheckRejectsInvalidLimits(t *testing.T) {
+	_, err := parseLimits(map[string]any{"errorRateLimit": "0,5%"})
+
+	assert.ErrorContains(t, err, "error rate")
+}
@@ -0,0 +1,139 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2022 Steadybit GmbH
+
+package extapm
+
+import (
+	"context"
+	"fmt"
+	"github.com/rs/zerolog/log"
+	"github.com/steadybit/discovery-kit/go/discovery_kit_api"
+	"github.com/steadybit/discovery-kit/go/discovery_kit_sdk"
+	"github.com/steadybit/extension-kit/extbuild"
+	"github.com/steadybit/extension-newrelic/config"
+	"github.com/steadybit/extension-newrelic/types"
+	"time"
+)
+
+type serviceDiscovery struct {
+}
+
+var (
+	_ discovery_kit_sdk.TargetDescriber    = (*serviceDiscovery)(nil)
+	_ discovery_kit_sdk.AttributeDescriber = (*serviceDiscovery)(nil)
+)
+
+// apmServicesQuery selects all APM applications of all accounts the API key can see.
+const apmServicesQuery = "domain = 'APM' AND type = 'APPLICATION'"
+
+func NewServiceDiscovery() discovery_kit_sdk.TargetDiscovery {
+	discovery := &serviceDiscovery{}
+	return discovery_kit_sdk.NewCachedTargetDiscovery(discovery,
+		discovery_kit_sdk.WithRefreshTargetsNow(),
+		discovery_kit_sdk.WithRefreshTargetsInterval(context.Background(), 1*time.Minute),
+	)
+}
+func (d *serviceDiscovery) Describe() discovery_kit_api.DiscoveryDescription {
+	return discovery_kit_api.DiscoveryDescription{
+		Id: ServiceTargetId,
+		Discover: discovery_kit_api.DescribingEndpointReferenceWithCallInterval{
+			CallInterval: new("1m"),
+		},
+	}
+}
+
+func (d *serviceDiscovery) DescribeTarget() discovery_kit_api.TargetDescription {
+	return discovery_kit_api.TargetDescription{
+		Id:       ServiceTargetId,
+		Label:    discovery_kit_api.PluralLabel{One: "New Relic APM Service", Other: "New Relic APM Services"},
+		Category: new("monitoring"),
+		Version:  extbuild.GetSemverVersionStringOrUnknown(),
+		Icon:     new(serviceIcon),
+		Table: discovery_kit_api.Table{
+			Columns: []discovery_kit_api.Column{
+				{Attribute: "new-relic.apm-service.name"},
+				{Attribute: "new-relic.apm-service.account"},
+				{Attribute: "new-relic.apm-service.language"},
+			},
+			OrderBy: []discovery_kit_api.OrderBy{
+				{
+					Attribute: "new-relic.apm-service.name",
+					Direction: "ASC",
+				},
+			},
+		},
+	}
+}
+
+func (d *serviceDiscovery) DescribeAttributes() []discovery_kit_api.AttributeDescription {
+	return []discovery_kit_api.AttributeDescription{
+		{
+			Attribute: "new-relic.apm-service.name",
+			Label: discovery_kit_api.PluralLabel{
+				One:   "New Relic APM Service Name",
+				Other: "New Relic APM Service Names",
+			},
+		},
+		{
+			Attribute: "new-relic.apm-service.account",
+			Label: discovery_kit_api.PluralLabel{
+				One:   "New Relic APM Service Account",
+				Other: "New Relic APM Service Accounts",
+			},
+		},
+		{
+			Attribute: "new-relic.apm-service.language",
+			Label: discovery_kit_api.PluralLabel{
+				One:   "New Relic APM Service Language",
+				Other: "New Relic APM Service Languages",
+			},
+		},
+	}
+}
+
+func (d *serviceDiscovery) DiscoverTargets(ctx context.Context) ([]discovery_kit_api.Target, error) {
+	return getAllServices(ctx, &config.Config), nil
+}
+
+type GetServicesApi interface {
+	SearchEntities(ctx context.Context, query string) ([]types.GraphQlResponseEntities, error)
+}
+
+func getAllServices(ctx context.Context, api GetServicesApi) []discovery_kit_api.Target {
+	result := make([]discovery_kit_api.Target, 0, 100)
+
+	services, err := api.SearchEntities(ctx, apmServicesQuery)
+	if err != nil {
+		log.Err(err).Msgf("Failed to get APM services from New Relic.")
+		return result
+	}
+
+	for _, service := range services {
+		result = append(result, toTarget(service))
+	}
+
+	return result
+}
+
+func toTarget(service types.GraphQlResponseEntities) discovery_kit_api.Target {
+	label := fmt.Sprintf("%s (%d)", service.Name, service.AccountId)
+
+	attributes := make(map[string][]string)
+	attributes["new-relic.apm-service.name"] = []string{service.Name}
+	attributes["new-relic.apm-service.guid"] = []string{service.Guid}
+	attributes["new-relic.apm-service.permalink"] = []string{service.Permalink}
+	attributes["new-relic.apm-service.account"] = []string{fmt.Sprintf("%d", service.AccountId)}
+	if service.Language != "" {
+		attributes["new-relic.apm-service.language"] = []string{service.Language}
+	}
+	for _, tag := range service.Tags {
+		attributes[fmt.Sprintf("new-relic.apm-service.label.%s", tag.Key)] = tag.Values
+	}
+
+	return discovery_kit_api.Target{
+		Id:         service.Guid,
+		Label:      label,
+		TargetType: ServiceTargetId,
+		Attributes: attributes,
+	}
+}
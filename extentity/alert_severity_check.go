@@ -0,0 +1,330 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2022 Steadybit GmbH
+
+package extentity
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/steadybit/action-kit/go/action_kit_api/v2"
+	"github.com/steadybit/action-kit/go/action_kit_sdk"
+	extension_kit "github.com/steadybit/extension-kit"
+	"github.com/steadybit/extension-kit/extbuild"
+	"github.com/steadybit/extension-kit/extutil"
+	"github.com/steadybit/extension-newrelic/config"
+	"github.com/steadybit/extension-newrelic/types"
+)
+
+type AlertSeverityCheckAction struct{}
+
+// Make sure action implements all required interfaces
+var (
+	_ action_kit_sdk.Action[AlertSeverityCheckState]           = (*AlertSeverityCheckAction)(nil)
+	_ action_kit_sdk.ActionWithStatus[AlertSeverityCheckState] = (*AlertSeverityCheckAction)(nil)
+)
+
+type AlertSeverityCheckState struct {
+	End                time.Time
+	EntityGuids        []string
+	EntitySearchQuery  string
+	ExpectedSeverities []string
+	ConditionCheckMode string
+	// ObservedSeverities holds the severities seen so far, per entity guid.
+	ObservedSeverities map[string][]string
+	// EntityNames holds the names of all entities seen so far, per entity guid.
+	EntityNames map[string]string
+}
+
+func NewAlertSeverityCheckAction() action_kit_sdk.Action[AlertSeverityCheckState] {
+	return &AlertSeverityCheckAction{}
+}
+
+func (m *AlertSeverityCheckAction) NewEmptyState() AlertSeverityCheckState {
+	return AlertSeverityCheckState{}
+}
+
+func (m *AlertSeverityCheckAction) Describe() action_kit_api.ActionDescription {
+	return action_kit_api.ActionDescription{
+		Id:          AlertSeverityCheckActionId,
+		Label:       "Entity Alert Severity Check",
+		Description: "Checks the alert severity of New Relic entities.",
+		Version:     extbuild.GetSemverVersionStringOrUnknown(),
+		Icon:        new(alertSeverityCheckActionIcon),
+		Technology:  new("New Relic"),
+
+		Kind:        action_kit_api.Check,
+		TimeControl: action_kit_api.TimeControlInternal,
+		Parameters: []action_kit_api.ActionParameter{
+			{
+				Name:         "duration",
+				Label:        "Duration",
+				Description:  new(""),
+				Type:         action_kit_api.ActionParameterTypeDuration,
+				DefaultValue: new("30s"),
+				Order:        new(1),
+				Required:     new(true),
+			},
+			{
+				Name:        "entityGuids",
+				Label:       "Entity GUIDs",
+				Description: new("The GUIDs of the entities to check."),
+				Type:        action_kit_api.ActionParameterTypeStringArray,
+				Order:       new(2),
+				Required:    new(false),
+			},
+			{
+				Name:        "entitySearchQuery",
+				Label:       "Entity Search Query",
+				Description: new("An entity search query selecting the entities to check, e.g. `domain = 'APM' AND tags.team = 'checkout'`."),
+				Type:        action_kit_api.ActionParameterTypeString,
+				Order:       new(3),
+				Required:    new(false),
+			},
+			{
+				Name:        "expectedSeverities",
+				Label:       "Expected Severities",
+				Description: new("Which alert severities are expected? If you select all severities, the action will always succeed and just show the current severity in a graph."),
+				Type:        action_kit_api.ActionParameterTypeStringArray,
+				Order:       new(4),
+				Required:    new(true),
+				Advanced:    new(false),
+				Options: new([]action_kit_api.ParameterOption{
+					action_kit_api.ExplicitParameterOption{
+						Label: "Not alerting",
+						Value: "NOT_ALERTING",
+					},
+					action_kit_api.ExplicitParameterOption{
+						Label: "Warning",
+						Value: "WARNING",
+					},
+					action_kit_api.ExplicitParameterOption{
+						Label: "Critical",
+						Value: "CRITICAL",
+					},
+					action_kit_api.ExplicitParameterOption{
+						Label: "Not configured",
+						Value: "NOT_CONFIGURED",
+					},
+				}),
+				DefaultValue: new("[\"NOT_ALERTING\",\"NOT_CONFIGURED\"]"),
+			},
+			{
+				Name:         "conditionCheckMode",
+				Label:        "Condition Check Mode",
+				Description:  new("Should the step succeed if the condition is met at least once or all the time?"),
+				Type:         action_kit_api.ActionParameterTypeString,
+				DefaultValue: new(conditionCheckModeAllTheTime),
+				Options: new([]action_kit_api.ParameterOption{
+					action_kit_api.ExplicitParameterOption{
+						Label: "All the time",
+						Value: conditionCheckModeAllTheTime,
+					},
+					action_kit_api.ExplicitParameterOption{
+						Label: "At least once",
+						Value: conditionCheckModeAtLeastOnce,
+					},
+				}),
+				Required: new(true),
+				Order:    new(5),
+			},
+		},
+		Widgets: new([]action_kit_api.Widget{
+			action_kit_api.StateOverTimeWidget{
+				Type:  action_kit_api.ComSteadybitWidgetStateOverTime,
+				Title: "New Relic Entity Alert Severity",
+				Identity: action_kit_api.StateOverTimeWidgetIdentityConfig{
+					From: "newrelic.entity-guid",
+				},
+				Label: action_kit_api.StateOverTimeWidgetLabelConfig{
+					From: "title",
+				},
+				State: action_kit_api.StateOverTimeWidgetStateConfig{
+					From: "state",
+				},
+				Tooltip: action_kit_api.StateOverTimeWidgetTooltipConfig{
+					From: "tooltip",
+				},
+				Url: new(action_kit_api.StateOverTimeWidgetUrlConfig{
+					From: new("url"),
+				}),
+				Value: new(action_kit_api.StateOverTimeWidgetValueConfig{
+					Hide: new(true),
+				}),
+			},
+		}),
+		Prepare: action_kit_api.MutatingEndpointReference{},
+		Start:   action_kit_api.MutatingEndpointReference{},
+		Status: new(action_kit_api.MutatingEndpointReferenceWithCallInterval{
+			CallInterval: new("5s"),
+		}),
+	}
+}
+
+func (m *AlertSeverityCheckAction) Prepare(_ context.Context, state *AlertSeverityCheckState, request action_kit_api.PrepareActionRequestBody) (*action_kit_api.PrepareResult, error) {
+	duration := request.Config["duration"].(float64)
+	state.End = time.Now().Add(time.Millisecond * time.Duration(duration))
+	state.EntityGuids = extutil.ToStringArray(request.Config["entityGuids"])
+	if request.Config["entitySearchQuery"] != nil {
+		state.EntitySearchQuery = strings.TrimSpace(fmt.Sprintf("%v", request.Config["entitySearchQuery"]))
+	}
+	if len(state.EntityGuids) == 0 && state.EntitySearchQuery == "" {
+		return nil, extension_kit.ToError("Either entity GUIDs or an entity search query is required.", errors.New("no entities selected"))
+	}
+	state.ExpectedSeverities = extutil.ToStringArray(request.Config["expectedSeverities"])
+	state.ObservedSeverities = make(map[string][]string)
+	state.EntityNames = make(map[string]string)
+	if request.Config["conditionCheckMode"] != nil {
+		state.ConditionCheckMode = fmt.Sprintf("%v", request.Config["conditionCheckMode"])
+	}
+	return nil, nil
+}
+
+func (m *AlertSeverityCheckAction) Start(ctx context.Context, state *AlertSeverityCheckState) (*action_kit_api.StartResult, error) {
+	statusResult, err := AlertSeverityCheckStatus(ctx, state, &config.Config)
+	if statusResult == nil {
+		return nil, err
+	}
+	startResult := action_kit_api.StartResult{
+		Artifacts: statusResult.Artifacts,
+		Error:     statusResult.Error,
+		Messages:  statusResult.Messages,
+		Metrics:   statusResult.Metrics,
+	}
+	return &startResult, err
+}
+
+func (m *AlertSeverityCheckAction) Status(ctx context.Context, state *AlertSeverityCheckState) (*action_kit_api.StatusResult, error) {
+	return AlertSeverityCheckStatus(ctx, state, &config.Config)
+}
+
+type EntitiesApi interface {
+	GetEntities(ctx context.Context, guids []string) ([]types.GraphQlResponseEntities, error)
+	SearchEntities(ctx context.Context, query string) ([]types.GraphQlResponseEntities, error)
+}
+
+func AlertSeverityCheckStatus(ctx context.Context, state *AlertSeverityCheckState, api EntitiesApi) (*action_kit_api.StatusResult, error) {
+	now := time.Now()
+	entities, err := getEntities(ctx, state, api)
+	if err != nil {
+		return nil, extension_kit.ToError("Failed to get entities from New Relic.", err)
+	}
+
+	completed := now.After(state.End)
+	var checkError *action_kit_api.ActionKitError
+	if len(entities) == 0 {
+		checkError = new(action_kit_api.ActionKitError{
+			Title:  "No New Relic entities found for the given GUIDs or search query.",
+			Status: extutil.Ptr(action_kit_api.Failed),
+		})
+	}
+
+	unexpected := make([]string, 0)
+	for _, entity := range entities {
+		severity := alertSeverity(entity)
+		state.EntityNames[entity.Guid] = entity.Name
+		if !slices.Contains(state.ObservedSeverities[entity.Guid], severity) {
+			state.ObservedSeverities[entity.Guid] = append(state.ObservedSeverities[entity.Guid], severity)
+		}
+		if !slices.Contains(state.ExpectedSeverities, severity) {
+			unexpected = append(unexpected, fmt.Sprintf("%s: %s", entity.Name, severity))
+		}
+	}
+
+	if checkError == nil && state.ConditionCheckMode == conditionCheckModeAllTheTime {
+		if len(unexpected) > 0 {
+			checkError = new(action_kit_api.ActionKitError{
+				Title:  fmt.Sprintf("Unexpected alert severity (%s)", strings.Join(unexpected, ", ")),
+				Status: extutil.Ptr(action_kit_api.Failed),
+			})
+		}
+	} else if checkError == nil && state.ConditionCheckMode == conditionCheckModeAtLeastOnce && completed {
+		missing := make([]string, 0)
+		for guid, observed := range state.ObservedSeverities {
+			if !slices.ContainsFunc(observed, func(severity string) bool { return slices.Contains(state.ExpectedSeverities, severity) }) {
+				missing = append(missing, fmt.Sprintf("%s: %s", state.EntityNames[guid], strings.Join(observed, ", ")))
+			}
+		}
+		if len(missing) > 0 {
+			slices.Sort(missing)
+			checkError = new(action_kit_api.ActionKitError{
+				Title:  fmt.Sprintf("Expected alert severity missing. Expected: %s, Observed: %s", strings.Join(state.ExpectedSeverities, ", "), strings.Join(missing, "; ")),
+				Status: extutil.Ptr(action_kit_api.Failed),
+			})
+		}
+	}
+
+	metrics := make([]action_kit_api.Metric, 0, len(entities))
+	for _, entity := range entities {
+		metrics = append(metrics, toMetric(entity, now))
+	}
+
+	return &action_kit_api.StatusResult{
+		Completed: completed,
+		Error:     checkError,
+		Metrics:   new(metrics),
+	}, nil
+}
+
+func getEntities(ctx context.Context, state *AlertSeverityCheckState, api EntitiesApi) ([]types.GraphQlResponseEntities, error) {
+	entities := make([]types.GraphQlResponseEntities, 0)
+	if len(state.EntityGuids) > 0 {
+		byGuid, err := api.GetEntities(ctx, state.EntityGuids)
+		if err != nil {
+			return nil, err
+		}
+		entities = append(entities, byGuid...)
+	}
+	if state.EntitySearchQuery != "" {
+		bySearch, err := api.SearchEntities(ctx, state.EntitySearchQuery)
+		if err != nil {
+			return nil, err
+		}
+		for _, entity := range bySearch {
+			if !slices.ContainsFunc(entities, func(e types.GraphQlResponseEntities) bool { return e.Guid == entity.Guid }) {
+				entities = append(entities, entity)
+			}
+		}
+	}
+	return entities, nil
+}
+
+// alertSeverity reports entities which are not alertable at all as NOT_CONFIGURED, since
+// there is no alert condition that could fire for them either.
+func alertSeverity(entity types.GraphQlResponseEntities) string {
+	if entity.AlertSeverity == "" {
+		return "NOT_CONFIGURED"
+	}
+	return entity.AlertSeverity
+}
+
+func toMetric(entity types.GraphQlResponseEntities, now time.Time) action_kit_api.Metric {
+	severity := alertSeverity(entity)
+	return action_kit_api.Metric{
+		Name: new("new_relic_entity_alert_severity"),
+		Metric: map[string]string{
+			"newrelic.entity-guid": entity.Guid,
+			"title":                entity.Name,
+			"state":                getState(severity),
+			"tooltip":              fmt.Sprintf("Alert severity: %s", severity),
+			"url":                  entity.Permalink,
+		},
+		Timestamp: now,
+		Value:     0,
+	}
+}
+
+func getState(severity string) string {
+	if severity == "NOT_ALERTING" {
+		return "success"
+	} else if severity == "WARNING" {
+		return "warn"
+	} else if severity == "CRITICAL" {
+		return "danger"
+	}
+	return "info" //NOT_CONFIGURED
+}
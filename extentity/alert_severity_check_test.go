@@ -0,0 +1,77 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2022 Steadybit GmbH
+
+package extentity
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/steadybit/extension-newrelic/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type entitiesApiMock struct {
+	severities map[string]string
+}
+
+func (m *entitiesApiMock) GetEntities(_ context.Context, guids []string) ([]types.GraphQlResponseEntities, error) {
+	entities := make([]types.GraphQlResponseEntities, 0, len(guids))
+	for _, guid := range guids {
+		entities = append(entities, types.GraphQlResponseEntities{Guid: guid, Name: "name-" + guid, AlertSeverity: m.severities[guid]})
+	}
+	return entities, nil
+}
+
+func (m *entitiesApiMock) SearchEntities(_ context.Context, _ string) ([]types.GraphQlResponseEntities, error) {
+	return []types.GraphQlResponseEntities{{Guid: "a", Name: "name-a", AlertSeverity: m.severities["a"]}}, nil
+}
+
+func newState(mode string) *AlertSeverityCheckState {
+	return &AlertSeverityCheckState{
+		End:                time.Now().Add(time.Minute),
+		EntityGuids:        []string{"a", "b"},
+		EntitySearchQuery:  "tags.team = 'checkout'",
+		ExpectedSeverities: []string{"NOT_ALERTING"},
+		ConditionCheckMode: mode,
+		ObservedSeverities: map[string][]string{},
+		EntityNames:        map[string]string{},
+	}
+}
+
+func TestAlertSeverityCheckAllTheTime(t *testing.T) {
+	api := &entitiesApiMock{severities: map[string]string{"a": "NOT_ALERTING", "b": "CRITICAL"}}
+
+	result, err := AlertSeverityCheckStatus(context.Background(), newState(conditionCheckModeAllTheTime), api)
+
+	require.NoError(t, err)
+	require.NotNil(t, result.Error)
+	assert.Equal(t, "Unexpected alert severity (name-b: CRITICAL)", result.Error.Title)
+	// Entities found both by guid and by search query are only reported once.
+	assert.Len(t, *result.Metrics, 2)
+}
+
+func TestAlertSeverityCheckAtLeastOnce(t *testing.T) {
+	api := &entitiesApiMock{severities: map[string]string{"a": "CRITICAL", "b": "WARNING"}}
+	state := newState(conditionCheckModeAtLeastOnce)
+
+	result, err := AlertSeverityCheckStatus(context.Background(), state, api)
+	require.NoError(t, err)
+	assert.Nil(t, result.Error)
+
+	api.severities["a"] = "NOT_ALERTING"
+	state.End = time.Now().Add(-time.Second)
+	result, err = AlertSeverityCheckStatus(context.Background(), state, api)
+	require.NoError(t, err)
+	assert.True(t, result.Completed)
+	require.NotNil(t, result.Error)
+	assert.Equal(t, "Expected alert severity missing. Expected: NOT_ALERTING, Observed: name-b: WARNING", result.Error.Title)
+}
+
+// Entities which are not alertable have no severity; they are reported as NOT_CONFIGURED.
+func TestAlertSeverityOfNonAlertableEntity(t *testing.T) {
+	assert.Equal(t, "NOT_CONFIGURED", alertSeverity(types.GraphQlResponseEntities{}))
+	assert.Equal(t, "info", getState("NOT_CONFIGURED"))
+}
@@ -0,0 +1,40 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2022 Steadybit GmbH
+
+package extevents
+
+import (
+	"strings"
+
+	"github.com/steadybit/event-kit/go/event_kit_api"
+	"github.com/steadybit/extension-newrelic/types"
+)
+
+// attributeMapping configures the additional attributes of events: target attributes copied
+// under a new name, and static attributes added to every event.
+type attributeMapping struct {
+	target map[string]string
+	static map[string]string
+}
+
+// addCustomAttributes adds the configured attributes to an event. Target attributes with
+// several values are joined with ','. Target attributes win over static ones of the same name.
+func (m *attributeMapping) addCustomAttributes(newRelicEvent *types.EventIngest, event *event_kit_api.EventRequestBody) {
+	if m == nil {
+		return
+	}
+	attributes := make(map[string]string, len(m.static)+len(m.target))
+	for name, value := range m.static {
+		attributes[name] = value
+	}
+	if event.ExperimentStepTargetExecution != nil {
+		for targetAttribute, name := range m.target {
+			if values := event.ExperimentStepTargetExecution.TargetAttributes[targetAttribute]; len(values) > 0 {
+				attributes[name] = strings.Join(values, ",")
+			}
+		}
+	}
+	if len(attributes) > 0 {
+		newRelicEvent.Attributes = attributes
+	}
+}
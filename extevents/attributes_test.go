@@ -0,0 +1,40 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2022 Steadybit GmbH
+
+package extevents
+
+import (
+	"testing"
+
+	"github.com/steadybit/event-kit/go/event_kit_api"
+	"github.com/steadybit/extension-newrelic/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_attributeMapping_addCustomAttributes(t *testing.T) {
+	mapping := &attributeMapping{
+		target: map[string]string{"k8s.cluster-name": "clusterName", "k8s.zone": "zone", "k8s.namespace": "source"},
+		static: map[string]string{"source": "steadybit-prod"},
+	}
+
+	experimentEvent := types.EventIngest{}
+	mapping.addCustomAttributes(&experimentEvent, &event_kit_api.EventRequestBody{})
+	assert.Equal(t, map[string]string{"source": "steadybit-prod"}, experimentEvent.Attributes)
+
+	attackEvent := types.EventIngest{}
+	mapping.addCustomAttributes(&attackEvent, &event_kit_api.EventRequestBody{
+		ExperimentStepTargetExecution: &event_kit_api.ExperimentStepTargetExecution{
+			TargetAttributes: map[string][]string{
+				"k8s.cluster-name": {"prod"},
+				"k8s.namespace":    {"shop", "payment"},
+			},
+		},
+	})
+	assert.Equal(t, map[string]string{"clusterName": "prod", "source": "shop,payment"}, attackEvent.Attributes)
+}
+
+func Test_attributeMapping_withoutConfiguration(t *testing.T) {
+	event := types.EventIngest{}
+	(&attributeMapping{}).addCustomAttributes(&event, &event_kit_api.EventRequestBody{})
+	assert.Nil(t, event.Attributes)
+}
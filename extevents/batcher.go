@@ -0,0 +1,67 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2022 Steadybit GmbH
+
+package extevents
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// batcher sends items in the background in batches of up to batchSize items, or whatever was
+// added within flushInterval. Unlike events, items that failed to be sent are dropped, as they
+// only complement the events.
+type batcher[T any] struct {
+	name          string
+	items         chan T
+	batchSize     int
+	flushInterval time.Duration
+	send          func(ctx context.Context, items []T) error
+}
+
+func newBatcher[T any](name string, size int, batchSize int, flushInterval time.Duration, send func(ctx context.Context, items []T) error) *batcher[T] {
+	return &batcher[T]{
+		name:          name,
+		items:         make(chan T, size),
+		batchSize:     max(batchSize, 1),
+		flushInterval: flushInterval,
+		send:          send,
+	}
+}
+
+func (b *batcher[T]) start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(b.flushInterval)
+		defer ticker.Stop()
+		var batch []T
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case item := <-b.items:
+				batch = append(batch, item)
+				if len(batch) < b.batchSize {
+					continue
+				}
+			case <-ticker.C:
+				if len(batch) == 0 {
+					continue
+				}
+			}
+			if err := b.send(ctx, batch); err != nil {
+				log.Warn().Err(err).Int("count", len(batch)).Msgf("Failed to send %s to New Relic.", b.name)
+			}
+			batch = nil
+		}
+	}()
+}
+
+func (b *batcher[T]) add(item T) {
+	select {
+	case b.items <- item:
+	default:
+		log.Warn().Msgf("Queue of %s is full. Dropping.", b.name)
+	}
+}
@@ -0,0 +1,190 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2022 Steadybit GmbH
+
+package extevents
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jellydator/ttlcache/v3"
+	"github.com/rs/zerolog/log"
+	"github.com/steadybit/event-kit/go/event_kit_api"
+	"github.com/steadybit/extension-newrelic/types"
+)
+
+type CreateChangeTrackingEventApi interface {
+	CreateChangeTrackingEvent(ctx context.Context, event types.ChangeTrackingEvent) error
+}
+
+// changeTracker records attacks and experiments as change tracking events on the attacked
+// entities, so they show up on the entities' charts. Attacks are recorded as they start and
+// end. An experiment is only known to affect entities once it attacked them, so its start
+// and end are recorded on all attacked entities when it has ended.
+type changeTracker struct {
+	api    CreateChangeTrackingEventApi
+	events chan types.ChangeTrackingEvent
+
+	mu                sync.Mutex
+	executionEntities *ttlcache.Cache[string, []string]
+}
+
+// The entities of an execution are remembered from its first attack until it ends. Like for
+// the step caches, the TTL and capacity only bound the cache if the end is never received.
+const executionEntitiesCapacity = 1000
+
+func newChangeTracker(api CreateChangeTrackingEventApi, size int) *changeTracker {
+	return &changeTracker{
+		api:    api,
+		events: make(chan types.ChangeTrackingEvent, size),
+		executionEntities: ttlcache.New[string, []string](
+			ttlcache.WithTTL[string, []string](stepCacheTtl),
+			ttlcache.WithCapacity[string, []string](executionEntitiesCapacity),
+			ttlcache.WithDisableTouchOnHit[string, []string](),
+		),
+	}
+}
+
+func (c *changeTracker) start(ctx context.Context) {
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event := <-c.events:
+				if err := c.api.CreateChangeTrackingEvent(ctx, event); err != nil {
+					log.Err(err).Str("groupId", event.GroupId).Msg("Failed to create change tracking event in New Relic.")
+				}
+			}
+		}
+	}()
+}
+
+// track records the change tracking events for an event, whether it is sent to New Relic or not.
+func (c *changeTracker) track(newRelicEvent *types.EventIngest, event *event_kit_api.EventRequestBody) {
+	switch newRelicEvent.EventType {
+	case types.EventTypeAttackStarted, types.EventTypeAttackEnded:
+		guids := eventEntityGuids(newRelicEvent)
+		if len(guids) == 0 {
+			return
+		}
+		c.rememberEntities(newRelicEvent.ExecutionId, guids)
+		verb := "started"
+		if newRelicEvent.EventType == types.EventTypeAttackEnded {
+			verb = "ended"
+		}
+		c.push(c.changeEvent(newRelicEvent, guids, event.EventTime,
+			fmt.Sprintf("Chaos attack %s: %s on %s", verb, attackName(newRelicEvent), newRelicEvent.Target)))
+	case types.EventTypeExperimentEnded:
+		guids := c.forgetEntities(newRelicEvent.ExecutionId)
+		if len(guids) == 0 || event.ExperimentExecution == nil {
+			return
+		}
+		c.push(c.changeEvent(newRelicEvent, guids, event.ExperimentExecution.StartedTime,
+			fmt.Sprintf("Chaos experiment started: %s", newRelicEvent.ExperimentName)))
+		endedTime := event.EventTime
+		if event.ExperimentExecution.EndedTime != nil {
+			endedTime = *event.ExperimentExecution.EndedTime
+		}
+		c.push(c.changeEvent(newRelicEvent, guids, endedTime,
+			fmt.Sprintf("Chaos experiment ended: %s (%s)", newRelicEvent.ExperimentName, strings.ToLower(newRelicEvent.State))))
+	}
+}
+
+func (c *changeTracker) push(event types.ChangeTrackingEvent) {
+	select {
+	case c.events <- event:
+	default:
+		log.Warn().Str("groupId", event.GroupId).Msg("Change tracking queue is full. Dropping change tracking event.")
+	}
+}
+
+func (c *changeTracker) rememberEntities(executionId string, guids []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var entities []string
+	if item := c.executionEntities.Get(executionId); item != nil {
+		entities = item.Value()
+	}
+	for _, guid := range guids {
+		entities = appendEntity(entities, guid)
+	}
+	c.executionEntities.Set(executionId, entities, ttlcache.DefaultTTL)
+}
+
+func (c *changeTracker) forgetEntities(executionId string) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	item, _ := c.executionEntities.GetAndDelete(executionId)
+	if item == nil {
+		return nil
+	}
+	return item.Value()
+}
+
+func (c *changeTracker) changeEvent(newRelicEvent *types.EventIngest, guids []string, timestamp time.Time, shortDescription string) types.ChangeTrackingEvent {
+	attributes := map[string]string{
+		"experimentKey": newRelicEvent.ExperimentKey,
+		"executionId":   newRelicEvent.ExecutionId,
+		"source":        "steadybit",
+	}
+	description := fmt.Sprintf("Steadybit experiment %s, execution %s", newRelicEvent.ExperimentKey, newRelicEvent.ExecutionId)
+	if newRelicEvent.ExecutionUrl != "" {
+		attributes["executionUrl"] = newRelicEvent.ExecutionUrl
+		description = fmt.Sprintf("%s: %s", description, newRelicEvent.ExecutionUrl)
+	}
+	if newRelicEvent.PrincipalType != "" {
+		attributes["principalType"] = newRelicEvent.PrincipalType
+	}
+	if newRelicEvent.PrincipalName != "" {
+		attributes["principalName"] = newRelicEvent.PrincipalName
+	}
+	if newRelicEvent.PrincipalUsername != "" {
+		attributes["principalUsername"] = newRelicEvent.PrincipalUsername
+	}
+	user := newRelicEvent.PrincipalUsername
+	if user == "" {
+		user = newRelicEvent.PrincipalName
+	}
+
+	return types.ChangeTrackingEvent{
+		EntityGuids:      guids,
+		ShortDescription: shortDescription,
+		Description:      description,
+		User:             user,
+		GroupId:          fmt.Sprintf("steadybit-%s-%s", newRelicEvent.ExperimentKey, newRelicEvent.ExecutionId),
+		Timestamp:        timestamp,
+		CustomAttributes: attributes,
+	}
+}
+
+func eventEntityGuids(newRelicEvent *types.EventIngest) []string {
+	if newRelicEvent.EntityGuids != "" {
+		return strings.Split(newRelicEvent.EntityGuids, ",")
+	}
+	if newRelicEvent.EntityGuid != "" {
+		return []string{newRelicEvent.EntityGuid}
+	}
+	return nil
+}
+
+func attackName(newRelicEvent *types.EventIngest) string {
+	if newRelicEvent.ActionCustomLabel != "" {
+		return newRelicEvent.ActionCustomLabel
+	}
+	if newRelicEvent.ActionName != "" {
+		return newRelicEvent.ActionName
+	}
+	return newRelicEvent.ActionId
+}
+
+func appendEntity(guids []string, guid string) []string {
+	if slices.Contains(guids, guid) {
+		return guids
+	}
+	return append(guids, guid)
+}
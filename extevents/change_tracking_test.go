@@ -0,0 +1,85 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2022 Steadybit GmbH
+
+package extevents
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/steadybit/event-kit/go/event_kit_api"
+	"github.com/steadybit/extension-newrelic/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_changeTracker_recordsAttacksAndExperiments(t *testing.T) {
+	tracker := newChangeTracker(nil, 10)
+	attackTime := time.Date(2021, 1, 1, 0, 1, 0, 0, time.UTC)
+	startedTime := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	endedTime := time.Date(2021, 1, 1, 0, 5, 0, 0, time.UTC)
+
+	tracker.track(&types.EventIngest{
+		EventType:         types.EventTypeAttackStarted,
+		ExperimentKey:     "ADM-1",
+		ExecutionId:       "42",
+		ExecutionUrl:      "https://platform.steadybit.com/experiments/ADM-1/executions/42",
+		ActionName:        "Stress CPU",
+		Target:            "checkout",
+		PrincipalUsername: "jane",
+		EntityGuid:        "guid-1",
+		EntityGuids:       "guid-1,guid-2",
+	}, &event_kit_api.EventRequestBody{EventTime: attackTime})
+	// Targets without an entity aren't recorded.
+	tracker.track(&types.EventIngest{
+		EventType:   types.EventTypeAttackStarted,
+		ExecutionId: "42",
+	}, &event_kit_api.EventRequestBody{EventTime: attackTime})
+	tracker.track(&types.EventIngest{
+		EventType:      types.EventTypeExperimentEnded,
+		ExperimentKey:  "ADM-1",
+		ExperimentName: "Checkout survives CPU stress",
+		ExecutionId:    "42",
+		State:          "COMPLETED",
+	}, &event_kit_api.EventRequestBody{ExperimentExecution: &event_kit_api.ExperimentExecution{StartedTime: startedTime, EndedTime: &endedTime}})
+
+	require.Len(t, tracker.events, 3)
+	attack := <-tracker.events
+	assert.Equal(t, types.ChangeTrackingEvent{
+		EntityGuids:      []string{"guid-1", "guid-2"},
+		ShortDescription: "Chaos attack started: Stress CPU on checkout",
+		Description:      "Steadybit experiment ADM-1, execution 42: https://platform.steadybit.com/experiments/ADM-1/executions/42",
+		User:             "jane",
+		GroupId:          "steadybit-ADM-1-42",
+		Timestamp:        attackTime,
+		CustomAttributes: map[string]string{
+			"experimentKey":     "ADM-1",
+			"executionId":       "42",
+			"executionUrl":      "https://platform.steadybit.com/experiments/ADM-1/executions/42",
+			"principalUsername": "jane",
+			"source":            "steadybit",
+		},
+	}, attack)
+
+	started := <-tracker.events
+	assert.Equal(t, "Chaos experiment started: Checkout survives CPU stress", started.ShortDescription)
+	assert.Equal(t, startedTime, started.Timestamp)
+	assert.Equal(t, []string{"guid-1", "guid-2"}, started.EntityGuids)
+	ended := <-tracker.events
+	assert.Equal(t, "Chaos experiment ended: Checkout survives CPU stress (completed)", ended.ShortDescription)
+	assert.Equal(t, endedTime, ended.Timestamp)
+	assert.Equal(t, 0, tracker.executionEntities.Len())
+}
+
+func Test_changeTracker_boundsRememberedExecutions(t *testing.T) {
+	tracker := newChangeTracker(nil, 10)
+
+	for i := 0; i <= executionEntitiesCapacity; i++ {
+		tracker.rememberEntities(fmt.Sprintf("%d", i), []string{"guid-1"})
+	}
+
+	assert.Equal(t, executionEntitiesCapacity, tracker.executionEntities.Len())
+	assert.Nil(t, tracker.forgetEntities("0"))
+	assert.Equal(t, []string{"guid-1"}, tracker.forgetEntities(fmt.Sprintf("%d", executionEntitiesCapacity)))
+}
@@ -0,0 +1,371 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2022 Steadybit GmbH
+
+package extevents
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+	"github.com/steadybit/extension-newrelic/config"
+	"github.com/steadybit/extension-newrelic/types"
+)
+
+const (
+	minRetryBackoff = 1 * time.Second
+	maxRetryBackoff = 1 * time.Minute
+	spoolFileSuffix = ".json"
+
+	defaultFlushInterval = 1 * time.Second
+	// maxPayloadSize is the most the Event API accepts per request, compressed. Batches are
+	// limited to this size uncompressed, which the compressed payload never exceeds.
+	maxPayloadSize = 1_000_000
+)
+
+// queuedEvent is an event waiting for delivery to one account. It is also the format of
+// the files in the spool directory.
+type queuedEvent struct {
+	Id         string            `json:"id"`
+	AccountId  int64             `json:"accountId"`
+	Event      types.EventIngest `json:"event"`
+	EnqueuedAt time.Time         `json:"enqueuedAt"`
+	// attempts counts the failed deliveries of the event.
+	attempts int
+	// size is the size of the event in the request payload.
+	size int
+}
+
+// DeliveryStats counts the events that passed through the delivery queue since the start.
+// Filtered counts the events not sent due to the event filter, Dropped includes the events
+// dropped before they reached the queue.
+type DeliveryStats struct {
+	Filtered int64
+	Queued   int64
+	Sent     int64
+	Dropped  int64
+}
+
+// pendingBatch collects the events of an account until the batch is sent.
+type pendingBatch struct {
+	events []*queuedEvent
+	size   int
+}
+
+// deliveryQueue delivers events to New Relic in the background, so event listener requests
+// aren't blocked by and don't lose events to a slow or unavailable New Relic API. Events are
+// collected per account and sent in batches of up to batchSize events and maxPayloadSize
+// bytes, or whatever arrived within flushInterval. Failed deliveries are queued again with
+// exponential backoff until they succeed, are rejected by New Relic, or exceed maxAge, so an
+// unavailable account doesn't hold up the others. If a spool directory is set, queued events
+// are also written to disk until they are delivered, and picked up again after a restart.
+type deliveryQueue struct {
+	api            PostEventApi
+	events         chan *queuedEvent
+	retries        chan []*queuedEvent
+	batches        chan []*queuedEvent
+	batchSize      int
+	maxPayloadSize int
+	flushInterval  time.Duration
+	spoolDir       string
+	maxAge         time.Duration
+	minBackoff     time.Duration
+	maxBackoff     time.Duration
+
+	queued  atomic.Int64
+	sent    atomic.Int64
+	dropped atomic.Int64
+}
+
+func newDeliveryQueue(api PostEventApi, size int, batchSize int, flushInterval time.Duration, spoolDir string, maxAge time.Duration) *deliveryQueue {
+	if flushInterval <= 0 {
+		flushInterval = defaultFlushInterval
+	}
+	batchSize = max(batchSize, 1)
+	return &deliveryQueue{
+		api:            api,
+		events:         make(chan *queuedEvent, size),
+		retries:        make(chan []*queuedEvent),
+		batches:        make(chan []*queuedEvent, max(size/batchSize, 1)),
+		batchSize:      batchSize,
+		maxPayloadSize: maxPayloadSize,
+		flushInterval:  flushInterval,
+		spoolDir:       spoolDir,
+		maxAge:         maxAge,
+		minBackoff:     minRetryBackoff,
+		maxBackoff:     maxRetryBackoff,
+	}
+}
+
+// start starts batching and the workers, which run until ctx is cancelled, and restores the
+// spooled events.
+func (q *deliveryQueue) start(ctx context.Context, workers int) {
+	if q.spoolDir != "" {
+		if err := os.MkdirAll(q.spoolDir, 0o700); err != nil {
+			log.Err(err).Str("dir", q.spoolDir).Msg("Failed to create event spool directory. Events are only kept in memory.")
+			q.spoolDir = ""
+		}
+	}
+	go q.batch(ctx)
+	for i := 0; i < max(workers, 1); i++ {
+		go q.work(ctx)
+	}
+	if q.spoolDir != "" {
+		go q.restore(ctx)
+	}
+}
+
+// enqueue schedules an event for delivery to an account. It never blocks; if the queue is
+// full, the event is dropped.
+func (q *deliveryQueue) enqueue(event types.EventIngest, accountId int64) {
+	queued := &queuedEvent{
+		Id:         uuid.NewString(),
+		AccountId:  accountId,
+		Event:      event,
+		EnqueuedAt: time.Now(),
+	}
+	q.spool(queued)
+	q.push(queued)
+}
+
+func (q *deliveryQueue) push(event *queuedEvent) {
+	select {
+	case q.events <- event:
+		q.queued.Add(1)
+	default:
+		log.Warn().Str("eventType", string(event.Event.EventType)).Int64("accountId", event.AccountId).Msg("Event queue is full. Dropping event.")
+		q.drop(event)
+	}
+}
+
+// batch collects the queued and retried events per account and hands them to the workers
+// once a batch is full or the flush interval has passed.
+func (q *deliveryQueue) batch(ctx context.Context) {
+	pending := make(map[int64]*pendingBatch)
+	add := func(event *queuedEvent) bool {
+		if event.size == 0 {
+			event.size = payloadSize(event.Event)
+		}
+		batch := pending[event.AccountId]
+		if batch != nil && batch.size+event.size > q.maxPayloadSize {
+			delete(pending, event.AccountId)
+			if !q.flush(ctx, batch.events) {
+				return false
+			}
+			batch = nil
+		}
+		if batch == nil {
+			// The brackets of the JSON array.
+			batch = &pendingBatch{size: 1}
+			pending[event.AccountId] = batch
+		}
+		batch.events = append(batch.events, event)
+		batch.size += event.size
+		if len(batch.events) < q.batchSize {
+			return true
+		}
+		delete(pending, event.AccountId)
+		return q.flush(ctx, batch.events)
+	}
+
+	ticker := time.NewTicker(q.flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-q.events:
+			if !add(event) {
+				return
+			}
+		case retried := <-q.retries:
+			for _, event := range retried {
+				if !add(event) {
+					return
+				}
+			}
+		case <-ticker.C:
+			for accountId, batch := range pending {
+				delete(pending, accountId)
+				if !q.flush(ctx, batch.events) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// payloadSize returns the size of an event in the JSON request payload, including the
+// separating comma.
+func payloadSize(event types.EventIngest) int {
+	b, err := json.Marshal(event)
+	if err != nil {
+		return 0
+	}
+	return len(b) + 1
+}
+
+func (q *deliveryQueue) flush(ctx context.Context, batch []*queuedEvent) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case q.batches <- batch:
+		return true
+	}
+}
+
+func (q *deliveryQueue) work(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case batch := <-q.batches:
+			q.deliver(ctx, batch)
+		}
+	}
+}
+
+func (q *deliveryQueue) deliver(ctx context.Context, batch []*queuedEvent) {
+	accountId := batch[0].AccountId
+	oldest := batch[0].EnqueuedAt
+	attempts := 0
+	events := make([]types.EventIngest, 0, len(batch))
+	for _, event := range batch {
+		events = append(events, event.Event)
+		if event.EnqueuedAt.Before(oldest) {
+			oldest = event.EnqueuedAt
+		}
+		attempts = max(attempts, event.attempts)
+	}
+
+	err := q.api.PostEvents(ctx, events, accountId)
+	if err == nil {
+		q.sent.Add(int64(len(batch)))
+		q.unspool(batch...)
+		return
+	}
+
+	var statusErr *config.UnexpectedStatusError
+	if errors.As(err, &statusErr) && !statusErr.Retryable() {
+		log.Err(err).Int("events", len(batch)).Int64("accountId", accountId).Msg("New Relic rejected events. Dropping events.")
+		q.drop(batch...)
+		return
+	}
+	backoff := q.backoff(attempts)
+	if time.Since(oldest)+backoff > q.maxAge {
+		log.Err(err).Int("events", len(batch)).Int64("accountId", accountId).Msgf("Failed to send events to New Relic within %s. Dropping events.", q.maxAge)
+		q.drop(batch...)
+		return
+	}
+
+	log.Warn().Err(err).Int("events", len(batch)).Int64("accountId", accountId).Msgf("Failed to send events to New Relic. Retrying in %s.", backoff)
+	for _, event := range batch {
+		event.attempts = attempts + 1
+	}
+	// The events are queued again after the backoff, so the worker is free for the batches
+	// of other accounts in the meantime.
+	time.AfterFunc(backoff, func() {
+		select {
+		case <-ctx.Done():
+			// Still spooled, if enabled, and retried after the restart.
+		case q.retries <- batch:
+		}
+	})
+}
+
+// backoff returns the time to wait before retrying events that failed to be delivered
+// the given number of times before.
+func (q *deliveryQueue) backoff(attempts int) time.Duration {
+	backoff := q.minBackoff
+	for i := 0; i < attempts && backoff < q.maxBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, q.maxBackoff)
+}
+
+func (q *deliveryQueue) drop(events ...*queuedEvent) {
+	q.dropped.Add(int64(len(events)))
+	q.unspool(events...)
+}
+
+func (q *deliveryQueue) stats() DeliveryStats {
+	return DeliveryStats{
+		Queued:  q.queued.Load(),
+		Sent:    q.sent.Load(),
+		Dropped: q.dropped.Load(),
+	}
+}
+
+func (q *deliveryQueue) spoolFile(event *queuedEvent) string {
+	return filepath.Join(q.spoolDir, event.Id+spoolFileSuffix)
+}
+
+func (q *deliveryQueue) spool(event *queuedEvent) {
+	if q.spoolDir == "" {
+		return
+	}
+	b, err := json.Marshal(event)
+	if err == nil {
+		err = os.WriteFile(q.spoolFile(event), b, 0o600)
+	}
+	if err != nil {
+		log.Err(err).Str("eventType", string(event.Event.EventType)).Msg("Failed to write event to the spool directory. It is only kept in memory.")
+	}
+}
+
+func (q *deliveryQueue) unspool(events ...*queuedEvent) {
+	if q.spoolDir == "" {
+		return
+	}
+	for _, event := range events {
+		if err := os.Remove(q.spoolFile(event)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Err(err).Str("file", q.spoolFile(event)).Msg("Failed to remove event from the spool directory.")
+		}
+	}
+}
+
+// restore queues the events left in the spool directory by a previous run. The events are
+// queued as the queue has room for them, so none are dropped for exceeding its size, and
+// they stay in the spool directory until they are delivered.
+func (q *deliveryQueue) restore(ctx context.Context) {
+	entries, err := os.ReadDir(q.spoolDir)
+	if err != nil {
+		log.Err(err).Str("dir", q.spoolDir).Msg("Failed to read event spool directory.")
+		return
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), spoolFileSuffix) {
+			continue
+		}
+		file := filepath.Join(q.spoolDir, entry.Name())
+		b, err := os.ReadFile(file)
+		if err != nil {
+			log.Err(err).Str("file", file).Msg("Failed to read spooled event.")
+			continue
+		}
+		var event queuedEvent
+		if err := json.Unmarshal(b, &event); err != nil || event.Id+spoolFileSuffix != entry.Name() {
+			log.Warn().Err(err).Str("file", file).Msg("Ignoring invalid spooled event.")
+			_ = os.Remove(file)
+			continue
+		}
+		if time.Since(event.EnqueuedAt) > q.maxAge {
+			log.Warn().Str("eventType", string(event.Event.EventType)).Int64("accountId", event.AccountId).Msg("Spooled event is too old. Dropping event.")
+			q.drop(&event)
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case q.events <- &event:
+			q.queued.Add(1)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2022 Steadybit GmbH
+
+package extevents
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/steadybit/extension-newrelic/config"
+	"github.com/steadybit/extension-newrelic/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type postedBatch struct {
+	accountId int64
+	events    []types.EventIngest
+}
+
+type postEventApiMock struct {
+	mu       sync.Mutex
+	failures []error
+	// unavailable are the accounts all deliveries to fail for.
+	unavailable map[int64]bool
+	posted      []types.EventIngest
+	batches     []postedBatch
+}
+
+func (m *postEventApiMock) PostEvents(_ context.Context, events []types.EventIngest, accountId int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.unavailable[accountId] {
+		return &config.UnexpectedStatusError{StatusCode: 503}
+	}
+	if len(m.failures) > 0 {
+		err := m.failures[0]
+		m.failures = m.failures[1:]
+		return err
+	}
+	m.posted = append(m.posted, events...)
+	m.batches = append(m.batches, postedBatch{accountId: accountId, events: events})
+	return nil
+}
+
+func (m *postEventApiMock) postedCount() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.posted)
+}
+
+func newTestDeliveryQueue(api PostEventApi, spoolDir string, maxAge time.Duration) *deliveryQueue {
+	q := newDeliveryQueue(api, 10, 3, time.Millisecond, spoolDir, maxAge)
+	q.minBackoff = time.Millisecond
+	q.maxBackoff = 5 * time.Millisecond
+	return q
+}
+
+func Test_deliveryQueue_retriesFailedDeliveries(t *testing.T) {
+	api := &postEventApiMock{failures: []error{
+		errors.New("connection refused"),
+		&config.UnexpectedStatusError{StatusCode: 503},
+	}}
+	q := newTestDeliveryQueue(api, "", time.Minute)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	q.start(ctx, 1)
+
+	q.enqueue(types.EventIngest{EventType: types.EventTypeExperimentStarted}, 1234)
+
+	assert.Eventually(t, func() bool { return api.postedCount() == 1 }, time.Second, time.Millisecond)
+	assert.Equal(t, DeliveryStats{Queued: 1, Sent: 1}, q.stats())
+}
+
+func Test_deliveryQueue_batchesEventsPerAccount(t *testing.T) {
+	api := &postEventApiMock{}
+	q := newDeliveryQueue(api, 10, 3, time.Hour, "", time.Minute)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	q.start(ctx, 1)
+
+	for _, target := range []string{"a", "b", "c", "d"} {
+		q.enqueue(types.EventIngest{EventType: types.EventTypeAttackStarted, Target: target}, 1234)
+		q.enqueue(types.EventIngest{EventType: types.EventTypeAttackStarted, Target: target}, 5678)
+	}
+
+	// Full batches are sent right away, the remaining events wait for the flush interval.
+	assert.Eventually(t, func() bool { return api.postedCount() == 6 }, time.Second, time.Millisecond)
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	require.Len(t, api.batches, 2)
+	assert.ElementsMatch(t, []int64{1234, 5678}, []int64{api.batches[0].accountId, api.batches[1].accountId})
+	for _, batch := range api.batches {
+		require.Len(t, batch.events, 3)
+		assert.Equal(t, "a", batch.events[0].Target)
+	}
+}
+
+func Test_deliveryQueue_dropsRejectedEvents(t *testing.T) {
+	api := &postEventApiMock{failures: []error{&config.UnexpectedStatusError{StatusCode: 400}}}
+	q := newTestDeliveryQueue(api, "", time.Minute)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	q.start(ctx, 1)
+
+	q.enqueue(types.EventIngest{EventType: types.EventTypeExperimentStarted}, 1234)
+
+	assert.Eventually(t, func() bool { return q.stats().Dropped == 1 }, time.Second, time.Millisecond)
+	assert.Equal(t, 0, api.postedCount())
+}
+
+func Test_deliveryQueue_dropsEventsAfterMaxAge(t *testing.T) {
+	api := &postEventApiMock{failures: []error{errors.New("timeout"), errors.New("timeout"), errors.New("timeout")}}
+	q := newTestDeliveryQueue(api, "", 2*time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	q.start(ctx, 1)
+
+	q.enqueue(types.EventIngest{EventType: types.EventTypeExperimentStarted}, 1234)
+
+	assert.Eventually(t, func() bool { return q.stats().Dropped == 1 }, time.Second, time.Millisecond)
+	assert.Equal(t, 0, api.postedCount())
+}
+
+func Test_deliveryQueue_restoresSpooledEvents(t *testing.T) {
+	spoolDir := t.TempDir()
+
+	// Nothing is delivered without workers, so the event stays in the spool directory.
+	stopped := newTestDeliveryQueue(&postEventApiMock{}, spoolDir, time.Minute)
+	stopped.enqueue(types.EventIngest{EventType: types.EventTypeAttackStarted, Target: "checkout"}, 1234)
+	files, err := os.ReadDir(spoolDir)
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+
+	api := &postEventApiMock{}
+	q := newTestDeliveryQueue(api, spoolDir, time.Minute)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	q.start(ctx, 1)
+
+	assert.Eventually(t, func() bool { return api.postedCount() == 1 }, time.Second, time.Millisecond)
+	assert.Equal(t, "checkout", api.posted[0].Target)
+	assert.Eventually(t, func() bool {
+		files, _ := os.ReadDir(spoolDir)
+		return len(files) == 0
+	}, time.Second, time.Millisecond)
+}
+
+func Test_deliveryQueue_retriesWithoutBlockingOtherAccounts(t *testing.T) {
+	api := &postEventApiMock{unavailable: map[int64]bool{1: true}}
+	q := newDeliveryQueue(api, 10, 1, time.Millisecond, "", 2*time.Hour)
+	q.minBackoff = time.Hour
+	q.maxBackoff = time.Hour
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	q.start(ctx, 1)
+
+	q.enqueue(types.EventIngest{EventType: types.EventTypeAttackStarted}, 1)
+	q.enqueue(types.EventIngest{EventType: types.EventTypeAttackStarted}, 2)
+
+	// The single worker isn't held up by the hour long backoff of the first account.
+	assert.Eventually(t, func() bool { return api.postedCount() == 1 }, time.Second, time.Millisecond)
+	assert.Equal(t, int64(2), api.batches[0].accountId)
+	assert.Equal(t, int64(0), q.stats().Dropped)
+}
+
+func Test_deliveryQueue_splitsBatchesByPayloadSize(t *testing.T) {
+	api := &postEventApiMock{}
+	q := newDeliveryQueue(api, 10, 10, time.Hour, "", time.Minute)
+	event := types.EventIngest{EventType: types.EventTypeAttackStarted, Target: "checkout"}
+	// Room for two events per batch.
+	q.maxPayloadSize = 2*payloadSize(event) + 1
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	q.start(ctx, 1)
+
+	for i := 0; i < 5; i++ {
+		q.enqueue(event, 1234)
+	}
+
+	assert.Eventually(t, func() bool { return api.postedCount() == 4 }, time.Second, time.Millisecond)
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	require.Len(t, api.batches, 2)
+	assert.Len(t, api.batches[0].events, 2)
+	assert.Len(t, api.batches[1].events, 2)
+}
+
+func Test_deliveryQueue_restoresMoreSpooledEventsThanTheQueueHolds(t *testing.T) {
+	spoolDir := t.TempDir()
+	stopped := newTestDeliveryQueue(&postEventApiMock{}, spoolDir, time.Minute)
+	for i := 0; i < 25; i++ {
+		stopped.spool(&queuedEvent{Id: uuid.NewString(), AccountId: 1234, Event: types.EventIngest{EventType: types.EventTypeAttackStarted}, EnqueuedAt: time.Now()})
+	}
+
+	api := &postEventApiMock{}
+	q := newTestDeliveryQueue(api, spoolDir, time.Minute)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	q.start(ctx, 1)
+
+	assert.Eventually(t, func() bool { return api.postedCount() == 25 }, time.Second, time.Millisecond)
+	assert.Equal(t, int64(0), q.stats().Dropped)
+	assert.Eventually(t, func() bool {
+		files, _ := os.ReadDir(spoolDir)
+		return len(files) == 0
+	}, time.Second, time.Millisecond)
+}
@@ -0,0 +1,90 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2022 Steadybit GmbH
+
+package extevents
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/rs/zerolog/log"
+	"github.com/steadybit/event-kit/go/event_kit_api"
+	"github.com/steadybit/extension-newrelic/types"
+)
+
+// dispatchedEvent is an event handed from an event listener request to the dispatcher.
+type dispatchedEvent struct {
+	request types.EventIngest
+	event   event_kit_api.EventRequestBody
+	// deliver is false for events excluded by the event filter, which are only tracked.
+	deliver bool
+}
+
+// eventDispatcher adds the entities of attacked targets to events and hands them to the
+// delivery queue and the trackers. Resolving entities may search New Relic, which mustn't
+// block event listener requests, so events are dispatched in the background. A single
+// goroutine keeps the events in the order they were received.
+type eventDispatcher struct {
+	events chan dispatchedEvent
+	// dropped counts the events dropped as the dispatcher fell behind.
+	dropped atomic.Int64
+	// done is closed once the dispatcher stopped.
+	done chan struct{}
+}
+
+func newEventDispatcher(size int) *eventDispatcher {
+	return &eventDispatcher{events: make(chan dispatchedEvent, size), done: make(chan struct{})}
+}
+
+func (d *eventDispatcher) start(ctx context.Context) {
+	go func() {
+		defer close(d.done)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case e := <-d.events:
+				dispatch(&e.request, &e.event, e.deliver)
+			}
+		}
+	}()
+}
+
+func (d *eventDispatcher) enqueue(request types.EventIngest, event event_kit_api.EventRequestBody, deliver bool) {
+	select {
+	case d.events <- dispatchedEvent{request: request, event: event, deliver: deliver}:
+	default:
+		d.dropped.Add(1)
+		log.Warn().Str("eventType", string(request.EventType)).Msg("Event dispatch queue is full. Dropping event.")
+	}
+}
+
+// dispatch sends an event to the accounts it is routed to, unless it is not to be delivered,
+// and updates the trackers.
+func dispatch(request *types.EventIngest, event *event_kit_api.EventRequestBody, deliver bool) {
+	if event.ExperimentStepTargetExecution != nil {
+		addEntityProperties(request, event.ExperimentStepTargetExecution)
+	}
+	mapping.addCustomAttributes(request, event)
+	if deliver {
+		accounts := router.accounts(event)
+		if len(accounts) == 0 {
+			log.Debug().Str("eventType", string(request.EventType)).Msg("No New Relic account to send the event to; skipping event delivery.")
+		}
+		for _, accountId := range accounts {
+			delivery.enqueue(*request, accountId)
+		}
+	}
+	if tracker != nil {
+		tracker.track(request, event)
+	}
+	if metrics != nil {
+		metrics.track(request)
+	}
+	if traces != nil {
+		traces.track(request)
+	}
+	if tagger != nil {
+		tagger.track(request)
+	}
+}
@@ -0,0 +1,156 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2022 Steadybit GmbH
+
+package extevents
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jellydator/ttlcache/v3"
+	"github.com/steadybit/event-kit/go/event_kit_api"
+	"github.com/steadybit/extension-kit/extutil"
+	"github.com/steadybit/extension-newrelic/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_eventDispatcher_resolvesEntitiesInTheBackground(t *testing.T) {
+	entities := &searchEntitiesApiMock{}
+	api := &postEventApiMock{}
+	resolver = newEntityResolver(entities)
+	router = newAccountRouter(nil, nil, false, func() []int64 { return nil })
+	mapping = &attributeMapping{}
+	delivery = newTestDeliveryQueue(api, "", time.Minute)
+	ctx, cancel := context.WithCancel(context.Background())
+	d := newEventDispatcher(10)
+	defer func() {
+		cancel()
+		<-d.done
+		resolver, router, mapping, delivery = nil, nil, nil, nil
+	}()
+	delivery.start(ctx, 1)
+	d.start(ctx)
+
+	d.enqueue(types.EventIngest{EventType: types.EventTypeAttackStarted}, event_kit_api.EventRequestBody{
+		ExperimentStepTargetExecution: &event_kit_api.ExperimentStepTargetExecution{
+			TargetAttributes: map[string][]string{
+				"new-relic.account.id": {"1234"},
+				"host.hostname":        {"node-1"},
+			},
+		},
+	}, true)
+
+	assert.Eventually(t, func() bool { return api.postedCount() == 1 }, time.Second, time.Millisecond)
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	require.Len(t, api.batches, 1)
+	assert.Equal(t, int64(1234), api.batches[0].accountId)
+	assert.Equal(t, "deployment-guid", api.posted[0].EntityGuid)
+	assert.Equal(t, []string{"domain = 'INFRA' AND type = 'HOST' AND name = 'node-1'"}, entities.queries)
+}
+
+func Test_eventDispatcher_countsDroppedEvents(t *testing.T) {
+	delivery = newTestDeliveryQueue(&postEventApiMock{}, "", time.Minute)
+	dispatcher = newEventDispatcher(1)
+	defer func() { delivery, dispatcher = nil, nil }()
+
+	dispatcher.enqueue(types.EventIngest{EventType: types.EventTypeAttackStarted}, event_kit_api.EventRequestBody{}, true)
+	dispatcher.enqueue(types.EventIngest{EventType: types.EventTypeAttackEnded}, event_kit_api.EventRequestBody{}, true)
+
+	assert.Equal(t, int64(1), GetDeliveryStats().Dropped)
+}
+
+func Test_handle_tracksEventsExcludedByTheFilter(t *testing.T) {
+	api := &postEventApiMock{}
+	var err error
+	filter, err = newEventFilter([]string{string(types.EventTypeAttackStarted)}, nil, nil, "")
+	require.NoError(t, err)
+	router = newAccountRouter(nil, nil, false, func() []int64 { return nil })
+	mapping = &attributeMapping{}
+	delivery = newTestDeliveryQueue(api, "", time.Minute)
+	metrics = newMetricsReporter(&postMetricsApiMock{}, time.Hour)
+	dispatcher = newEventDispatcher(10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer func() {
+		cancel()
+		<-dispatcher.done
+		filter, router, mapping, delivery, metrics, dispatcher = nil, nil, nil, nil, nil, nil
+	}()
+	delivery.start(ctx, 1)
+	dispatcher.start(ctx)
+
+	stepId := uuid.New()
+	stepExecutions.Set(stepId, event_kit_api.ExperimentStepExecution{Id: stepId, ExecutionId: 42, Type: event_kit_api.Action, ActionKind: extutil.Ptr(event_kit_api.Attack)}, ttlcache.DefaultTTL)
+	defer stepExecutions.Delete(stepId)
+	body, err := json.Marshal(event_kit_api.EventRequestBody{
+		Environment: new(event_kit_api.Environment{Name: "gateway"}),
+		ExperimentStepTargetExecution: &event_kit_api.ExperimentStepTargetExecution{
+			ExecutionId:      42,
+			StepExecutionId:  stepId,
+			TargetName:       "checkout",
+			TargetAttributes: map[string][]string{"new-relic.account.id": {"1234"}},
+		},
+	})
+	require.NoError(t, err)
+
+	handle(onExperimentTargetStarted)(httptest.NewRecorder(), nil, body)
+	assert.Eventually(t, func() bool {
+		metrics.mu.Lock()
+		defer metrics.mu.Unlock()
+		return len(metrics.active) == 1
+	}, time.Second, time.Millisecond)
+
+	handle(onExperimentTargetCompleted)(httptest.NewRecorder(), nil, body)
+	assert.Eventually(t, func() bool {
+		metrics.mu.Lock()
+		defer metrics.mu.Unlock()
+		return len(metrics.active) == 0
+	}, time.Second, time.Millisecond)
+
+	assert.Eventually(t, func() bool { return api.postedCount() == 1 }, time.Second, time.Millisecond)
+	assert.Equal(t, types.EventTypeAttackStarted, api.posted[0].EventType)
+	assert.Equal(t, int64(1), filter.filtered.Load())
+}
+
+// StepEnded events are opt-in, but the traces get the spans of all steps, so the spans of
+// attacked targets have their parent.
+func Test_handle_tracesStepsNotSent(t *testing.T) {
+	api := &postEventApiMock{}
+	tracesApi := &postTracesApiMock{}
+	router = newAccountRouter(nil, nil, true, func() []int64 { return []int64{1234} })
+	mapping = &attributeMapping{}
+	delivery = newTestDeliveryQueue(api, "", time.Minute)
+	traces = newTraceExporter(tracesApi, 10, 1, time.Hour)
+	dispatcher = newEventDispatcher(10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer func() {
+		cancel()
+		<-dispatcher.done
+		router, mapping, delivery, traces, dispatcher = nil, nil, nil, nil, nil
+	}()
+	delivery.start(ctx, 1)
+	traces.start(ctx)
+	dispatcher.start(ctx)
+
+	body, err := json.Marshal(event_kit_api.EventRequestBody{
+		Environment: new(event_kit_api.Environment{Name: "gateway"}),
+		ExperimentStepExecution: &event_kit_api.ExperimentStepExecution{
+			Id:          uuid.New(),
+			ExecutionId: 42,
+			Type:        event_kit_api.Action,
+			ActionKind:  extutil.Ptr(event_kit_api.Attack),
+		},
+	})
+	require.NoError(t, err)
+
+	handle(onExperimentStepCompleted)(httptest.NewRecorder(), nil, body)
+
+	assert.Eventually(t, func() bool { return tracesApi.count() == 1 }, time.Second, time.Millisecond)
+	assert.Equal(t, "attack", tracesApi.traces[0].ResourceSpans[0].ScopeSpans[0].Spans[0].Name)
+	assert.Equal(t, int64(0), delivery.stats().Queued)
+}
@@ -0,0 +1,204 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2022 Steadybit GmbH
+
+package extevents
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jellydator/ttlcache/v3"
+	"github.com/rs/zerolog/log"
+	"github.com/steadybit/event-kit/go/event_kit_api"
+	"github.com/steadybit/extension-newrelic/config"
+	"github.com/steadybit/extension-newrelic/types"
+)
+
+// targetEntity is a New Relic entity an attacked target corresponds to.
+type targetEntity struct {
+	Guid string
+	Name string
+}
+
+// entityAttributes are pairs of target attributes holding the guid and name of the New Relic
+// entity of a target, be it discovered by this extension or added by an enrichment rule.
+var entityAttributes = [][2]string{
+	{"new-relic.entity.guid", "new-relic.entity.name"},
+	{"new-relic.apm-service.guid", "new-relic.apm-service.name"},
+	{"new-relic.workload.guid", "new-relic.workload.name"},
+	{"new-relic.service-level.entity.guid", "new-relic.service-level.entity.name"},
+}
+
+type SearchEntitiesApi interface {
+	SearchEntities(ctx context.Context, query string) ([]types.GraphQlResponseEntities, error)
+}
+
+// entityResolver looks up the New Relic entities of attacked targets. Entity searches are
+// cached, as a step usually attacks many targets of the same deployment or host.
+type entityResolver struct {
+	api   SearchEntitiesApi
+	cache *ttlcache.Cache[string, []targetEntity]
+	// wait is how long resolving waits for an entity search. Slower searches go on in the
+	// background, so their result is there for the following events.
+	wait time.Duration
+
+	mu sync.Mutex
+	// searches are the running searches by query, closed once the search is done.
+	searches map[string]chan struct{}
+}
+
+const (
+	// failedSearchTtl is how long a failed entity search isn't retried, so a slow or unavailable
+	// New Relic API doesn't delay every event of a step.
+	failedSearchTtl = 1 * time.Minute
+	// entitySearchWait bounds the time an event is held up by the search of its target's entity.
+	entitySearchWait = 2 * time.Second
+)
+
+func newEntityResolver(api SearchEntitiesApi) *entityResolver {
+	return &entityResolver{
+		api: api,
+		cache: ttlcache.New[string, []targetEntity](
+			ttlcache.WithTTL[string, []targetEntity](10*time.Minute),
+			ttlcache.WithDisableTouchOnHit[string, []targetEntity](),
+		),
+		wait:     entitySearchWait,
+		searches: make(map[string]chan struct{}),
+	}
+}
+
+// resolve returns the entities named by the target's attributes or, if there are none, the
+// entities found by the target's Kubernetes deployment or host name. If the search takes longer
+// than the resolver waits, no entities are returned.
+func (r *entityResolver) resolve(target *event_kit_api.ExperimentStepTargetExecution) []targetEntity {
+	if entities := attributeEntities(target.TargetAttributes); len(entities) > 0 {
+		return entities
+	}
+
+	query := entitySearchQuery(target.TargetAttributes)
+	if query == "" {
+		return nil
+	}
+	if item := r.cache.Get(query); item != nil {
+		return item.Value()
+	}
+	select {
+	case <-r.search(query):
+		if item := r.cache.Get(query); item != nil {
+			return item.Value()
+		}
+		return nil
+	case <-time.After(r.wait):
+		log.Debug().Str("query", query).Msg("New Relic entity search of the target is still running; sending the event without entity.")
+		return nil
+	}
+}
+
+// search starts an entity search, unless one for the query is running already, and returns a
+// channel closed once the result is cached.
+func (r *entityResolver) search(query string) <-chan struct{} {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if done, ok := r.searches[query]; ok {
+		return done
+	}
+	done := make(chan struct{})
+	r.searches[query] = done
+	go func() {
+		defer func() {
+			r.mu.Lock()
+			delete(r.searches, query)
+			r.mu.Unlock()
+			close(done)
+		}()
+		found, err := r.api.SearchEntities(context.Background(), query)
+		if err != nil {
+			log.Warn().Err(err).Str("query", query).Msg("Failed to search the New Relic entity of the target.")
+			r.cache.Set(query, nil, failedSearchTtl)
+			return
+		}
+		entities := make([]targetEntity, 0, len(found))
+		for _, entity := range found {
+			entities = append(entities, targetEntity{Guid: entity.Guid, Name: entity.Name})
+		}
+		r.cache.Set(query, entities, ttlcache.DefaultTTL)
+	}()
+	return done
+}
+
+func attributeEntities(attributes map[string][]string) []targetEntity {
+	var entities []targetEntity
+	seen := make(map[string]bool)
+	for _, keys := range entityAttributes {
+		guids := attributes[keys[0]]
+		names := attributes[keys[1]]
+		for i, guid := range guids {
+			if guid == "" || seen[guid] {
+				continue
+			}
+			seen[guid] = true
+			entity := targetEntity{Guid: guid}
+			if len(names) == len(guids) {
+				entity.Name = names[i]
+			}
+			entities = append(entities, entity)
+		}
+	}
+	return entities
+}
+
+// entitySearchQuery builds an entity search for the Kubernetes deployment or host of a
+// target, or returns "" if the target has neither.
+func entitySearchQuery(attributes map[string][]string) string {
+	if deployment := firstAttribute(attributes, "k8s.deployment"); deployment != "" {
+		conditions := []string{
+			"domain = 'INFRA'",
+			"type = 'KUBERNETES_DEPLOYMENT'",
+			fmt.Sprintf("name = %s", config.NrqlString(deployment)),
+		}
+		if cluster := firstAttribute(attributes, "k8s.cluster-name"); cluster != "" {
+			conditions = append(conditions, fmt.Sprintf("tags.clusterName = %s", config.NrqlString(cluster)))
+		}
+		if namespace := firstAttribute(attributes, "k8s.namespace"); namespace != "" {
+			conditions = append(conditions, fmt.Sprintf("tags.namespaceName = %s", config.NrqlString(namespace)))
+		}
+		return strings.Join(conditions, " AND ")
+	}
+	if host := firstAttribute(attributes, "host.hostname"); host != "" {
+		return fmt.Sprintf("domain = 'INFRA' AND type = 'HOST' AND name = %s", config.NrqlString(host))
+	}
+	return ""
+}
+
+func firstAttribute(attributes map[string][]string, key string) string {
+	if values := attributes[key]; len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// addEntityProperties adds the target's entities to the event. It is called when dispatching
+// events, as resolving the entities may search New Relic. NRQL can't filter on lists, so the
+// first entity goes to entityGuid and entityName and, if there are several, all of them to
+// entityGuids.
+func addEntityProperties(newRelicEvent *types.EventIngest, targetExecution *event_kit_api.ExperimentStepTargetExecution) {
+	if resolver == nil || targetExecution == nil {
+		return
+	}
+	entities := resolver.resolve(targetExecution)
+	if len(entities) == 0 {
+		return
+	}
+	newRelicEvent.EntityGuid = entities[0].Guid
+	newRelicEvent.EntityName = entities[0].Name
+	if len(entities) > 1 {
+		guids := make([]string, 0, len(entities))
+		for _, entity := range entities {
+			guids = append(guids, entity.Guid)
+		}
+		newRelicEvent.EntityGuids = strings.Join(guids, ",")
+	}
+}
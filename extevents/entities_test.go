@@ -0,0 +1,127 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2022 Steadybit GmbH
+
+package extevents
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/steadybit/event-kit/go/event_kit_api"
+	"github.com/steadybit/extension-newrelic/types"
+	"github.com/stretchr/testify/assert"
+)
+
+type searchEntitiesApiMock struct {
+	mu      sync.Mutex
+	queries []string
+	err     error
+	// block, if set, holds searches up until it is closed.
+	block chan struct{}
+}
+
+func (m *searchEntitiesApiMock) SearchEntities(_ context.Context, query string) ([]types.GraphQlResponseEntities, error) {
+	m.mu.Lock()
+	m.queries = append(m.queries, query)
+	m.mu.Unlock()
+	if m.block != nil {
+		<-m.block
+	}
+	if m.err != nil {
+		return nil, m.err
+	}
+	return []types.GraphQlResponseEntities{{Guid: "deployment-guid", Name: "checkout"}}, nil
+}
+
+func Test_entityResolver_usesTargetAttributes(t *testing.T) {
+	api := &searchEntitiesApiMock{}
+	resolver = newEntityResolver(api)
+	defer func() { resolver = nil }()
+
+	event := types.EventIngest{}
+	addEntityProperties(&event, &event_kit_api.ExperimentStepTargetExecution{
+		TargetAttributes: map[string][]string{
+			"new-relic.entity.guid":      {"guid-1"},
+			"new-relic.entity.name":      {"checkout"},
+			"new-relic.apm-service.guid": {"guid-1", "guid-2"},
+			"k8s.deployment":             {"checkout"},
+		},
+	})
+
+	assert.Equal(t, types.EventIngest{EntityGuid: "guid-1", EntityName: "checkout", EntityGuids: "guid-1,guid-2"}, event)
+	assert.Empty(t, api.queries)
+}
+
+func Test_entityResolver_searchesAndCachesDeployments(t *testing.T) {
+	api := &searchEntitiesApiMock{}
+	resolver = newEntityResolver(api)
+	defer func() { resolver = nil }()
+
+	target := &event_kit_api.ExperimentStepTargetExecution{
+		TargetAttributes: map[string][]string{
+			"k8s.deployment":   {"checkout"},
+			"k8s.namespace":    {"shop"},
+			"k8s.cluster-name": {"o'prod"},
+			"host.hostname":    {"node-1"},
+		},
+	}
+	first := types.EventIngest{}
+	addEntityProperties(&first, target)
+	second := types.EventIngest{}
+	addEntityProperties(&second, target)
+
+	assert.Equal(t, types.EventIngest{EntityGuid: "deployment-guid", EntityName: "checkout"}, first)
+	assert.Equal(t, first, second)
+	assert.Equal(t, []string{"domain = 'INFRA' AND type = 'KUBERNETES_DEPLOYMENT' AND name = 'checkout' AND tags.clusterName = 'o\\'prod' AND tags.namespaceName = 'shop'"}, api.queries)
+}
+
+func Test_entityResolver_cachesFailedSearches(t *testing.T) {
+	api := &searchEntitiesApiMock{err: errors.New("timeout")}
+	resolver = newEntityResolver(api)
+	defer func() { resolver = nil }()
+
+	target := &event_kit_api.ExperimentStepTargetExecution{
+		TargetAttributes: map[string][]string{"host.hostname": {"node-1"}},
+	}
+	first := types.EventIngest{}
+	addEntityProperties(&first, target)
+	second := types.EventIngest{}
+	addEntityProperties(&second, target)
+
+	assert.Empty(t, first.EntityGuid)
+	assert.Empty(t, second.EntityGuid)
+	assert.Len(t, api.queries, 1)
+}
+
+func Test_entityResolver_doesNotWaitForSlowSearches(t *testing.T) {
+	api := &searchEntitiesApiMock{block: make(chan struct{})}
+	resolver = newEntityResolver(api)
+	resolver.wait = 10 * time.Millisecond
+	defer func() { resolver = nil }()
+
+	target := &event_kit_api.ExperimentStepTargetExecution{
+		TargetAttributes: map[string][]string{"host.hostname": {"node-1"}},
+	}
+	first := types.EventIngest{}
+	addEntityProperties(&first, target)
+	second := types.EventIngest{}
+	addEntityProperties(&second, target)
+	assert.Empty(t, first.EntityGuid)
+	assert.Empty(t, second.EntityGuid)
+
+	// The search went on in the background, so following events get the entity.
+	close(api.block)
+	assert.Eventually(t, func() bool { return resolver.cache.Has(entitySearchQuery(target.TargetAttributes)) }, time.Second, time.Millisecond)
+	third := types.EventIngest{}
+	addEntityProperties(&third, target)
+	assert.Equal(t, "deployment-guid", third.EntityGuid)
+	assert.Len(t, api.queries, 1)
+}
+
+func Test_entitySearchQuery_forHosts(t *testing.T) {
+	assert.Equal(t, "domain = 'INFRA' AND type = 'HOST' AND name = 'node-1'", entitySearchQuery(map[string][]string{"host.hostname": {"node-1"}}))
+	assert.Equal(t, "", entitySearchQuery(map[string][]string{"container.name": {"checkout"}}))
+}
@@ -8,6 +8,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"github.com/google/uuid"
 	"github.com/jellydator/ttlcache/v3"
 	"github.com/rs/zerolog/log"
 	"github.com/steadybit/event-kit/go/event_kit_api"
@@ -16,7 +17,8 @@ import (
 	"github.com/steadybit/extension-newrelic/config"
 	"github.com/steadybit/extension-newrelic/types"
 	"net/http"
-	"sync"
+	"path/filepath"
+	"strings"
 	"time"
 )
 
@@ -41,25 +43,113 @@ func RegisterEventListenerHandlers() {
 	)
 	go accountCache.Start()
 
+	delivery = newDeliveryQueue(&config.Config, config.Config.EventQueueSize, config.Config.EventBatchSize, config.Config.EventFlushInterval, config.Config.EventSpoolDir, config.Config.EventMaxAge)
+	delivery.start(context.Background(), config.Config.EventDeliveryWorkers)
+	router = newAccountRouter(config.Config.EventTeamAccounts, config.Config.EventEnvironmentAccounts, config.Config.EventFanOutToAllAccounts, cachedAccounts)
+	go logDeliveryStats(context.Background(), 5*time.Minute)
+	var err error
+	filter, err = newEventFilter(config.Config.EventTypes, config.Config.EventEnvironments, config.Config.EventTeams, config.Config.EventExperimentKeyPattern)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to create the event filter.")
+	}
+	resolver = newEntityResolver(&config.Config)
+	go resolver.cache.Start()
+	dispatcher = newEventDispatcher(config.Config.EventQueueSize)
+	dispatcher.start(context.Background())
+	steadybitBaseUrl = config.Config.SteadybitBaseUrl
+	if config.Config.EventSpoolDir != "" {
+		steps = newStepSpool(filepath.Join(config.Config.EventSpoolDir, stepSpoolSubdir))
+		steps.restore(stepExecutions)
+	}
+	stepEndedKinds = make(map[string]bool, len(config.Config.EventStepKinds))
+	for _, kind := range config.Config.EventStepKinds {
+		if kind = strings.TrimSpace(kind); kind != "" {
+			stepEndedKinds[kind] = true
+		}
+	}
+	mapping = &attributeMapping{target: config.Config.EventTargetAttributes, static: config.Config.EventStaticAttributes}
+	if config.Config.EventChangeTracking {
+		tracker = newChangeTracker(&config.Config, config.Config.EventQueueSize)
+		tracker.start(context.Background())
+	}
+	if config.Config.EventMetrics {
+		metrics = newMetricsReporter(&config.Config, config.Config.EventMetricsInterval)
+		metrics.start(context.Background())
+	}
+	if config.Config.EventTraces {
+		traces = newTraceExporter(&config.Config, config.Config.EventQueueSize, config.Config.EventBatchSize, config.Config.EventFlushInterval)
+		traces.start(context.Background())
+	}
+	if config.Config.EventEntityTags {
+		tagger = newEntityTagger(&config.Config, config.Config.EventQueueSize)
+		tagger.start(context.Background())
+	}
+	if config.Config.EventLogs {
+		logs = newLogForwarder(&config.Config, config.Config.EventQueueSize, config.Config.EventBatchSize, config.Config.EventFlushInterval)
+		logs.start(context.Background())
+	}
+
 	exthttp.RegisterHttpHandler("/events/experiment-started", handle(onExperimentStarted))
 	exthttp.RegisterHttpHandler("/events/experiment-completed", handle(onExperimentCompleted))
 	exthttp.RegisterHttpHandler("/events/experiment-step-started", handle(onExperimentStepStarted))
+	exthttp.RegisterHttpHandler("/events/experiment-step-completed", handle(onExperimentStepCompleted))
 	exthttp.RegisterHttpHandler("/events/experiment-target-started", handle(onExperimentTargetStarted))
 	exthttp.RegisterHttpHandler("/events/experiment-target-completed", handle(onExperimentTargetCompleted))
 }
 
 type PostEventApi interface {
-	PostEvent(ctx context.Context, event types.EventIngest, accountId int64) error
+	PostEvents(ctx context.Context, events []types.EventIngest, accountId int64) error
 }
 
+// stepKindWait is the kind of wait steps, which aren't actions and have no action kind.
+const stepKindWait = "wait"
+
+// Steps are cached from their start until the experiment completes. The TTL and capacity
+// only bound the caches if the completion of an experiment is never received.
+const (
+	stepCacheTtl      = 24 * time.Hour
+	stepCacheCapacity = 10000
+)
+
 var (
-	stepExecutions = sync.Map{}
+	stepExecutions = newStepCache[event_kit_api.ExperimentStepExecution]()
+	stepFailures   = newStepCache[stepFailure]()
+	steps          = newStepSpool("")
+
+	// stepEndedKinds are the kinds of steps StepEnded events are sent for. None by default,
+	// so the events are opt-in. The trackers get the events of all steps.
+	stepEndedKinds = map[string]bool{}
 
 	accountCache *ttlcache.Cache[string, []int64]
+	delivery     *deliveryQueue
+	router       *accountRouter
+	filter       *eventFilter
+	resolver     *entityResolver
+	dispatcher   *eventDispatcher
+	tracker      *changeTracker
+	metrics      *metricsReporter
+	traces       *traceExporter
+	logs         *logForwarder
+	tagger       *entityTagger
+	mapping      *attributeMapping
+
+	steadybitBaseUrl string
 )
 
 const accountCacheKey = "accountCache"
 
+// cachedAccounts returns all accounts of the organization, or nil if they couldn't be loaded.
+func cachedAccounts() []int64 {
+	// Get returns nil when the loader failed to fetch accounts (e.g. New Relic
+	// unreachable); guard against it instead of dereferencing a nil item.
+	accountItem := accountCache.Get(accountCacheKey)
+	if accountItem == nil {
+		log.Warn().Msg("No New Relic accounts available; skipping event delivery.")
+		return nil
+	}
+	return accountItem.Value()
+}
+
 type eventHandler func(event *event_kit_api.EventRequestBody) (*types.EventIngest, error)
 
 func handle(handler eventHandler) func(w http.ResponseWriter, r *http.Request, body []byte) {
@@ -71,21 +161,21 @@ func handle(handler eventHandler) func(w http.ResponseWriter, r *http.Request, b
 			return
 		}
 
+		// Logs are forwarded first, as handlers consume the step state logs are created from.
+		if logs != nil {
+			logs.track(&event)
+		}
+
 		if request, err := handler(&event); err == nil {
 			if request != nil {
-				// Get returns nil when the loader failed to fetch accounts (e.g. New Relic
-				// unreachable); guard against it instead of dereferencing a nil item.
-				accountItem := accountCache.Get(accountCacheKey)
-				if accountItem == nil {
-					log.Warn().Msg("No New Relic accounts available; skipping event delivery.")
-				} else {
-					for _, accountId := range accountItem.Value() {
-						eventErr := config.Config.PostEvent(r.Context(), request, accountId)
-						if eventErr != nil {
-							log.Err(eventErr).Int64("accountId", accountId).Msgf("Failed to send event to New Relic.")
-						}
-					}
+				// The filter only applies to the events sent. The trackers see all events, so
+				// whatever they started for an event is ended by its counterpart, and the traces
+				// get the spans of all steps, even if their StepEnded events aren't sent.
+				deliver := sendsStepEnded(request) && (filter == nil || filter.accepts(request))
+				if !deliver {
+					log.Debug().Str("eventType", string(request.EventType)).Msg("Event filtered; skipping event delivery.")
 				}
+				dispatcher.enqueue(*request, event, deliver)
 			}
 		} else {
 			exthttp.WriteError(w, extension_kit.ToError(err.Error(), err))
@@ -96,6 +186,36 @@ func handle(handler eventHandler) func(w http.ResponseWriter, r *http.Request, b
 	}
 }
 
+// GetDeliveryStats returns the number of events filtered, queued, sent and dropped since the start.
+func GetDeliveryStats() DeliveryStats {
+	stats := delivery.stats()
+	if dispatcher != nil {
+		stats.Dropped += dispatcher.dropped.Load()
+	}
+	if filter != nil {
+		stats.Filtered = filter.filtered.Load()
+	}
+	return stats
+}
+
+func logDeliveryStats(ctx context.Context, interval time.Duration) {
+	var last DeliveryStats
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			stats := GetDeliveryStats()
+			if stats != last {
+				log.Info().Int64("filtered", stats.Filtered).Int64("queued", stats.Queued).Int64("sent", stats.Sent).Int64("dropped", stats.Dropped).Msg("Event delivery statistics")
+				last = stats
+			}
+		}
+	}
+}
+
 func onExperimentStarted(event *event_kit_api.EventRequestBody) (*types.EventIngest, error) {
 	newRelicEvent := types.EventIngest{
 		EventType: types.EventTypeExperimentStarted,
@@ -106,13 +226,13 @@ func onExperimentStarted(event *event_kit_api.EventRequestBody) (*types.EventIng
 }
 
 func onExperimentCompleted(event *event_kit_api.EventRequestBody) (*types.EventIngest, error) {
-	stepExecutions.Range(func(key, value any) bool {
-		stepExecution := value.(event_kit_api.ExperimentStepExecution)
-		if stepExecution.ExecutionId == event.ExperimentExecution.ExecutionId {
-			log.Debug().Msgf("Delete step execution data for id %.0f", stepExecution.ExecutionId)
-			stepExecutions.Delete(key)
-		}
-		return true
+	executionId := event.ExperimentExecution.ExecutionId
+	log.Debug().Msgf("Delete step execution data for id %.0f", executionId)
+	steps.remove(deleteSteps(stepExecutions, func(step event_kit_api.ExperimentStepExecution) bool {
+		return step.ExecutionId == executionId
+	})...)
+	deleteSteps(stepFailures, func(failure stepFailure) bool {
+		return failure.targetExecution.ExecutionId == executionId
 	})
 
 	newRelicEvent := types.EventIngest{
@@ -121,6 +241,7 @@ func onExperimentCompleted(event *event_kit_api.EventRequestBody) (*types.EventI
 	addBaseProperties(&newRelicEvent, event)
 	addExperimentExecutionProperties(&newRelicEvent, event.ExperimentExecution)
 	newRelicEvent.State = string(event.ExperimentExecution.State)
+	addEndProperties(&newRelicEvent, event.EventTime, event.ExperimentExecution.Reason, event.ExperimentExecution.ReasonDetails)
 	return &newRelicEvent, nil
 }
 
@@ -128,7 +249,7 @@ func onExperimentStepStarted(event *event_kit_api.EventRequestBody) (*types.Even
 	if event.ExperimentStepExecution == nil {
 		return nil, errors.New("missing ExperimentStepExecution in event")
 	}
-	stepExecutions.Store(event.ExperimentStepExecution.Id, *event.ExperimentStepExecution)
+	rememberStep(event.ExperimentStepExecution)
 	return nil, nil
 }
 
@@ -137,13 +258,8 @@ func onExperimentTargetStarted(event *event_kit_api.EventRequestBody) (*types.Ev
 		return nil, errors.New("missing ExperimentStepTargetExecution in event")
 	}
 
-	var v, ok = stepExecutions.Load(event.ExperimentStepTargetExecution.StepExecutionId)
-	if !ok {
-		log.Warn().Msgf("Could not find step infos for step execution id %s", event.ExperimentStepTargetExecution.StepExecutionId)
-		return nil, nil
-	}
-	stepExecution := v.(event_kit_api.ExperimentStepExecution)
-	if stepExecution.ActionKind == nil || *stepExecution.ActionKind != event_kit_api.Attack {
+	stepExecution := lookupStepExecution(event)
+	if !isAttack(&stepExecution) {
 		return nil, nil
 	}
 
@@ -162,13 +278,9 @@ func onExperimentTargetCompleted(event *event_kit_api.EventRequestBody) (*types.
 		return nil, errors.New("missing ExperimentStepTargetExecution in event")
 	}
 
-	var v, ok = stepExecutions.Load(event.ExperimentStepTargetExecution.StepExecutionId)
-	if !ok {
-		log.Warn().Msgf("Could not find step infos for step execution id %s", event.ExperimentStepTargetExecution.StepExecutionId)
-		return nil, nil
-	}
-	stepExecution := v.(event_kit_api.ExperimentStepExecution)
-	if stepExecution.ActionKind == nil || *stepExecution.ActionKind != event_kit_api.Attack {
+	stepExecution := lookupStepExecution(event)
+	rememberStepFailure(event.ExperimentStepTargetExecution)
+	if !isAttack(&stepExecution) {
 		return nil, nil
 	}
 
@@ -179,10 +291,134 @@ func onExperimentTargetCompleted(event *event_kit_api.EventRequestBody) (*types.
 	addStepExecutionProperties(&newRelicEvent, &stepExecution)
 	addTargetExecutionProperties(&newRelicEvent, event.ExperimentStepTargetExecution)
 	newRelicEvent.TargetState = string(event.ExperimentStepTargetExecution.State)
+	addEndProperties(&newRelicEvent, event.EventTime, event.ExperimentStepTargetExecution.Reason, event.ExperimentStepTargetExecution.ReasonDetails)
+
+	return &newRelicEvent, nil
+}
+
+func onExperimentStepCompleted(event *event_kit_api.EventRequestBody) (*types.EventIngest, error) {
+	if event.ExperimentStepExecution == nil {
+		return nil, errors.New("missing ExperimentStepExecution in event")
+	}
+	stepExecution := event.ExperimentStepExecution
+	failure, _ := stepFailures.GetAndDelete(stepExecution.Id)
+	kind := stepKind(stepExecution)
+
+	newRelicEvent := types.EventIngest{
+		EventType: types.EventTypeStepEnded,
+	}
+	addBaseProperties(&newRelicEvent, event)
+	newRelicEvent.ExperimentKey = stepExecution.ExperimentKey
+	newRelicEvent.ExecutionId = fmt.Sprintf("%g", stepExecution.ExecutionId)
+	newRelicEvent.ExecutionUrl = executionUrl(newRelicEvent.ExperimentKey, newRelicEvent.ExecutionId)
+	addStepExecutionProperties(&newRelicEvent, stepExecution)
+	newRelicEvent.StepKind = kind
+	newRelicEvent.State = string(stepExecution.State)
+	if stepExecution.StartedTime != nil {
+		newRelicEvent.StartedTimestamp = stepExecution.StartedTime.UnixMilli()
+	}
+	if stepExecution.EndedTime != nil {
+		newRelicEvent.EndedTimestamp = stepExecution.EndedTime.UnixMilli()
+	}
+	var reason, reasonDetails *string
+	if failure != nil && stepExecution.State != event_kit_api.ExperimentStepExecutionStateCompleted {
+		targetExecution := failure.Value().targetExecution
+		reason, reasonDetails = targetExecution.Reason, targetExecution.ReasonDetails
+	}
+	addEndProperties(&newRelicEvent, event.EventTime, reason, reasonDetails)
 
 	return &newRelicEvent, nil
 }
 
+// sendsStepEnded tells whether an event is sent as far as the step kinds are concerned. StepEnded
+// events are only sent for the kinds configured.
+func sendsStepEnded(request *types.EventIngest) bool {
+	return request.EventType != types.EventTypeStepEnded || stepEndedKinds[request.StepKind]
+}
+
+// stepFailure is the last failed target execution of a step. Steps carry no reason of their
+// own, so the reason of a failed step is taken from its targets.
+type stepFailure struct {
+	targetExecution event_kit_api.ExperimentStepTargetExecution
+}
+
+func rememberStepFailure(targetExecution *event_kit_api.ExperimentStepTargetExecution) {
+	if targetExecution.Reason == nil && targetExecution.ReasonDetails == nil {
+		return
+	}
+	stepFailures.Set(targetExecution.StepExecutionId, stepFailure{targetExecution: *targetExecution}, ttlcache.DefaultTTL)
+}
+
+func newStepCache[T any]() *ttlcache.Cache[uuid.UUID, T] {
+	return ttlcache.New[uuid.UUID, T](
+		ttlcache.WithTTL[uuid.UUID, T](stepCacheTtl),
+		ttlcache.WithCapacity[uuid.UUID, T](stepCacheCapacity),
+		ttlcache.WithDisableTouchOnHit[uuid.UUID, T](),
+	)
+}
+
+// rememberStep caches a started step until its experiment completes and saves it to the step
+// spool, so it survives a restart.
+func rememberStep(stepExecution *event_kit_api.ExperimentStepExecution) {
+	stepExecutions.Set(stepExecution.Id, *stepExecution, ttlcache.DefaultTTL)
+	steps.save(*stepExecution)
+}
+
+// deleteSteps removes the matching steps from a step cache and returns their ids. Items are
+// deleted after ranging over the cache, as deleting an item while ranging ends the iteration.
+func deleteSteps[T any](cache *ttlcache.Cache[uuid.UUID, T], matches func(T) bool) []uuid.UUID {
+	var keys []uuid.UUID
+	cache.Range(func(item *ttlcache.Item[uuid.UUID, T]) bool {
+		if matches(item.Value()) {
+			keys = append(keys, item.Key())
+		}
+		return true
+	})
+	for _, key := range keys {
+		cache.Delete(key)
+	}
+	return keys
+}
+
+// lookupStepExecution returns the step of a target event. If the step's start wasn't received
+// and isn't in the step spool either, the step is taken from the event or, if missing there
+// too, derived from the target execution without its action.
+func lookupStepExecution(event *event_kit_api.EventRequestBody) event_kit_api.ExperimentStepExecution {
+	targetExecution := event.ExperimentStepTargetExecution
+	if item := stepExecutions.Get(targetExecution.StepExecutionId); item != nil {
+		return item.Value()
+	}
+	if event.ExperimentStepExecution != nil && event.ExperimentStepExecution.Id == targetExecution.StepExecutionId {
+		rememberStep(event.ExperimentStepExecution)
+		return *event.ExperimentStepExecution
+	}
+	log.Debug().Msgf("Could not find step infos for step execution id %s, using the target execution", targetExecution.StepExecutionId)
+	return event_kit_api.ExperimentStepExecution{
+		Id:            targetExecution.StepExecutionId,
+		ExecutionId:   targetExecution.ExecutionId,
+		ExperimentKey: targetExecution.ExperimentKey,
+		Type:          event_kit_api.Action,
+	}
+}
+
+// isAttack tells whether a step is an attack. An action step of unknown kind is treated as one,
+// as dropping the events of an attack is worse than reporting the targets of a check.
+func isAttack(stepExecution *event_kit_api.ExperimentStepExecution) bool {
+	kind := stepKind(stepExecution)
+	return kind == string(event_kit_api.Attack) || kind == ""
+}
+
+// stepKind is the action kind of a step, or "wait" for wait steps.
+func stepKind(stepExecution *event_kit_api.ExperimentStepExecution) string {
+	if stepExecution.Type == event_kit_api.Wait {
+		return stepKindWait
+	}
+	if stepExecution.ActionKind == nil {
+		return ""
+	}
+	return string(*stepExecution.ActionKind)
+}
+
 func getTargetName(target event_kit_api.ExperimentStepTargetExecution) string {
 	if values, ok := target.TargetAttributes["steadybit.label"]; ok {
 		return values[0]
@@ -191,6 +427,9 @@ func getTargetName(target event_kit_api.ExperimentStepTargetExecution) string {
 }
 
 func addBaseProperties(newRelicEvent *types.EventIngest, event *event_kit_api.EventRequestBody) {
+	if !event.EventTime.IsZero() {
+		newRelicEvent.Timestamp = event.EventTime.UnixMilli()
+	}
 	newRelicEvent.EnvironmentName = event.Environment.Name
 	if event.Team != nil {
 		newRelicEvent.TeamName = event.Team.Name
@@ -221,13 +460,20 @@ func addExperimentExecutionProperties(newRelicEvent *types.EventIngest, experime
 	newRelicEvent.ExperimentKey = experimentExecution.ExperimentKey
 	newRelicEvent.ExperimentName = experimentExecution.Name
 	newRelicEvent.ExecutionId = fmt.Sprintf("%g", experimentExecution.ExecutionId)
+	newRelicEvent.ExecutionUrl = executionUrl(newRelicEvent.ExperimentKey, newRelicEvent.ExecutionId)
+	if !experimentExecution.StartedTime.IsZero() {
+		newRelicEvent.StartedTimestamp = experimentExecution.StartedTime.UnixMilli()
+	}
+	if experimentExecution.EndedTime != nil {
+		newRelicEvent.EndedTimestamp = experimentExecution.EndedTime.UnixMilli()
+	}
 }
 
 func addStepExecutionProperties(newRelicEvent *types.EventIngest, stepExecution *event_kit_api.ExperimentStepExecution) {
 	if stepExecution == nil {
 		return
 	}
-	if stepExecution.Type == event_kit_api.Action {
+	if stepExecution.Type == event_kit_api.Action && stepExecution.ActionId != nil {
 		newRelicEvent.ActionId = *stepExecution.ActionId
 	}
 	if stepExecution.ActionName != nil {
@@ -236,6 +482,9 @@ func addStepExecutionProperties(newRelicEvent *types.EventIngest, stepExecution
 	if stepExecution.CustomLabel != nil {
 		newRelicEvent.ActionCustomLabel = *stepExecution.CustomLabel
 	}
+	if stepExecution.Id != uuid.Nil {
+		newRelicEvent.StepExecutionId = stepExecution.Id.String()
+	}
 }
 
 func addTargetExecutionProperties(newRelicEvent *types.EventIngest, targetExecution *event_kit_api.ExperimentStepTargetExecution) {
@@ -246,6 +495,52 @@ func addTargetExecutionProperties(newRelicEvent *types.EventIngest, targetExecut
 	newRelicEvent.ExecutionId = fmt.Sprintf("%g", targetExecution.ExecutionId)
 	newRelicEvent.Target = getTargetName(*targetExecution)
 	newRelicEvent.TargetType = targetExecution.TargetType
+	newRelicEvent.ExecutionUrl = executionUrl(newRelicEvent.ExperimentKey, newRelicEvent.ExecutionId)
+	if targetExecution.StepExecutionId != uuid.Nil {
+		newRelicEvent.StepExecutionId = targetExecution.StepExecutionId.String()
+	}
+	if targetExecution.Id != uuid.Nil {
+		newRelicEvent.TargetExecutionId = targetExecution.Id.String()
+	}
+	if targetExecution.StartedTime != nil {
+		newRelicEvent.StartedTimestamp = targetExecution.StartedTime.UnixMilli()
+	}
+	if targetExecution.EndedTime != nil {
+		newRelicEvent.EndedTimestamp = targetExecution.EndedTime.UnixMilli()
+	}
+}
+
+// addEndProperties adds the duration and, if there is one, the reason for the failure to the
+// event ending an experiment or attack. Without an end time, the event's time is used.
+func addEndProperties(newRelicEvent *types.EventIngest, eventTime time.Time, reason *string, reasonDetails *string) {
+	if newRelicEvent.EndedTimestamp == 0 {
+		newRelicEvent.EndedTimestamp = eventTime.UnixMilli()
+	}
+	if newRelicEvent.StartedTimestamp != 0 && newRelicEvent.EndedTimestamp >= newRelicEvent.StartedTimestamp {
+		newRelicEvent.DurationMs = newRelicEvent.EndedTimestamp - newRelicEvent.StartedTimestamp
+	}
+	newRelicEvent.FailureReason = failureReason(reason, reasonDetails)
+}
+
+// failureReason joins the reason of a state and its details.
+func failureReason(reason *string, reasonDetails *string) string {
+	var reasons []string
+	if reason != nil && *reason != "" {
+		reasons = append(reasons, *reason)
+	}
+	if reasonDetails != nil && *reasonDetails != "" {
+		reasons = append(reasons, *reasonDetails)
+	}
+	return strings.Join(reasons, ": ")
+}
+
+// executionUrl links to the execution in the Steadybit platform, or is empty if the platform
+// url isn't configured.
+func executionUrl(experimentKey string, executionId string) string {
+	if steadybitBaseUrl == "" || experimentKey == "" || executionId == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s/experiments/%s/executions/%s", strings.TrimSuffix(steadybitBaseUrl, "/"), experimentKey, executionId)
 }
 
 func parseBodyToEventRequestBody(body []byte) (event_kit_api.EventRequestBody, error) {
@@ -60,6 +60,7 @@ func Test_addBaseProperties(t *testing.T) {
 				},
 			},
 			want: types.EventIngest{
+				Timestamp:         eventTime.UnixMilli(),
 				EnvironmentName:   "gateway",
 				PrincipalName:     "Peter",
 				PrincipalType:     "user",
@@ -95,6 +96,7 @@ func Test_addBaseProperties(t *testing.T) {
 				},
 			},
 			want: types.EventIngest{
+				Timestamp:       eventTime.UnixMilli(),
 				EnvironmentName: "gateway",
 				PrincipalName:   "MyFancyToken",
 				PrincipalType:   "access_token",
@@ -144,9 +146,11 @@ func Test_addExperimentExecutionProperties(t *testing.T) {
 				},
 			},
 			want: types.EventIngest{
-				ExecutionId:    "42",
-				ExperimentKey:  "ExperimentKey",
-				ExperimentName: "Name",
+				ExecutionId:      "42",
+				ExperimentKey:    "ExperimentKey",
+				ExperimentName:   "Name",
+				StartedTimestamp: startedTime.UnixMilli(),
+				EndedTimestamp:   endedTime.UnixMilli(),
 			},
 		},
 	}
@@ -263,10 +267,13 @@ func Test_addTargetExecutionProperties(t *testing.T) {
 				},
 			},
 			want: types.EventIngest{
-				ExecutionId:   "42",
-				ExperimentKey: "ExperimentKey",
-				Target:        "example-label",
-				TargetType:    "com.steadybit.extension_container.container",
+				ExecutionId:       "42",
+				ExperimentKey:     "ExperimentKey",
+				Target:            "example-label",
+				TargetType:        "com.steadybit.extension_container.container",
+				TargetExecutionId: id.String(),
+				StartedTimestamp:  startedTime.UnixMilli(),
+				EndedTimestamp:    endedTime.UnixMilli(),
 			},
 		},
 	}
@@ -353,6 +360,10 @@ func Test_onExperimentStepStarted(t *testing.T) {
 				ActionName:        "started step",
 				Target:            "test",
 				TargetType:        "type",
+				Timestamp:         eventTime.UnixMilli(),
+				StepExecutionId:   stepId.String(),
+				StartedTimestamp:  startedTime.UnixMilli(),
+				EndedTimestamp:    endedTime.UnixMilli(),
 			},
 		},
 	}
@@ -367,3 +378,148 @@ func Test_onExperimentStepStarted(t *testing.T) {
 		})
 	}
 }
+
+func Test_onExperimentCompleted_addsDurationAndFailureReason(t *testing.T) {
+	steadybitBaseUrl = "https://platform.steadybit.com/"
+	defer func() { steadybitBaseUrl = "" }()
+
+	startedTime := time.Date(2021, 1, 1, 0, 1, 0, 0, time.UTC)
+	eventTime := time.Date(2021, 1, 1, 0, 3, 30, 0, time.UTC)
+
+	event, err := onExperimentCompleted(&event_kit_api.EventRequestBody{
+		Environment: new(event_kit_api.Environment{Name: "gateway"}),
+		EventTime:   eventTime,
+		ExperimentExecution: new(event_kit_api.ExperimentExecution{
+			ExecutionId:   42,
+			ExperimentKey: "ADM-1",
+			Name:          "Name",
+			Reason:        new("Check failed"),
+			ReasonDetails: new("Service level violated"),
+			StartedTime:   startedTime,
+			State:         "failed",
+		}),
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, "https://platform.steadybit.com/experiments/ADM-1/executions/42", event.ExecutionUrl)
+	assert.Equal(t, eventTime.UnixMilli(), event.Timestamp)
+	assert.Equal(t, startedTime.UnixMilli(), event.StartedTimestamp)
+	assert.Equal(t, eventTime.UnixMilli(), event.EndedTimestamp)
+	assert.Equal(t, int64(150000), event.DurationMs)
+	assert.Equal(t, "Check failed: Service level violated", event.FailureReason)
+}
+
+func Test_onExperimentStepCompleted_sendsStepResult(t *testing.T) {
+
+	stepExecutionId := uuid.MustParse("f3a3b3c3-1234-4321-abcd-0123456789ab")
+	startedTime := time.Date(2021, 1, 1, 0, 1, 0, 0, time.UTC)
+	endedTime := time.Date(2021, 1, 1, 0, 1, 30, 0, time.UTC)
+	stepExecution := event_kit_api.ExperimentStepExecution{
+		Id:            stepExecutionId,
+		Type:          event_kit_api.Action,
+		ActionId:      extutil.Ptr("com.steadybit.extension_newrelic.service_level.check"),
+		ActionKind:    extutil.Ptr(event_kit_api.Check),
+		ExecutionId:   42,
+		ExperimentKey: "ADM-1",
+		StartedTime:   &startedTime,
+		EndedTime:     &endedTime,
+		State:         event_kit_api.ExperimentStepExecutionStateFailed,
+	}
+	_, err := onExperimentStepStarted(&event_kit_api.EventRequestBody{ExperimentStepExecution: &stepExecution})
+	require.NoError(t, err)
+	_, err = onExperimentTargetCompleted(&event_kit_api.EventRequestBody{
+		ExperimentStepTargetExecution: &event_kit_api.ExperimentStepTargetExecution{
+			ExecutionId:     42,
+			ExperimentKey:   "ADM-1",
+			StepExecutionId: stepExecutionId,
+			State:           "failed",
+			Reason:          new("Check failed"),
+			ReasonDetails:   new("Burn rate too high"),
+		},
+	})
+	require.NoError(t, err)
+
+	event, err := onExperimentStepCompleted(&event_kit_api.EventRequestBody{
+		Environment:             new(event_kit_api.Environment{Name: "gateway"}),
+		EventTime:               endedTime,
+		ExperimentStepExecution: &stepExecution,
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, types.EventTypeStepEnded, event.EventType)
+	assert.Equal(t, "check", event.StepKind)
+	assert.Equal(t, "failed", event.State)
+	assert.Equal(t, "42", event.ExecutionId)
+	assert.Equal(t, stepExecutionId.String(), event.StepExecutionId)
+	assert.Equal(t, int64(30000), event.DurationMs)
+	assert.Equal(t, "Check failed: Burn rate too high", event.FailureReason)
+	assert.False(t, stepFailures.Has(stepExecutionId))
+}
+
+func Test_onExperimentTargetStarted_fallsBackOnUnknownStep(t *testing.T) {
+	stepExecutionId := uuid.New()
+	targetEvent := event_kit_api.EventRequestBody{
+		Environment: new(event_kit_api.Environment{Name: "gateway"}),
+		ExperimentStepTargetExecution: &event_kit_api.ExperimentStepTargetExecution{
+			ExecutionId:     42,
+			ExperimentKey:   "ADM-1",
+			StepExecutionId: stepExecutionId,
+			State:           "running",
+			TargetName:      "checkout",
+		},
+	}
+
+	// Without the step, its kind is unknown, so the target is reported as attacked rather than
+	// dropping the events of an attack.
+	event, err := onExperimentTargetStarted(&targetEvent)
+	require.NoError(t, err)
+	require.NotNil(t, event)
+	assert.Equal(t, types.EventTypeAttackStarted, event.EventType)
+	assert.False(t, stepExecutions.Has(stepExecutionId))
+
+	targetEvent.ExperimentStepExecution = &event_kit_api.ExperimentStepExecution{
+		Id:          stepExecutionId,
+		Type:        event_kit_api.Action,
+		ActionKind:  extutil.Ptr(event_kit_api.Check),
+		ExecutionId: 42,
+	}
+	event, err = onExperimentTargetStarted(&targetEvent)
+	require.NoError(t, err)
+	assert.Nil(t, event)
+	assert.True(t, stepExecutions.Has(stepExecutionId))
+	stepExecutions.Delete(stepExecutionId)
+
+	targetEvent.ExperimentStepExecution.ActionKind = extutil.Ptr(event_kit_api.Attack)
+	event, err = onExperimentTargetStarted(&targetEvent)
+	require.NoError(t, err)
+	require.NotNil(t, event)
+	assert.Equal(t, types.EventTypeAttackStarted, event.EventType)
+	assert.Equal(t, "42", event.ExecutionId)
+	assert.Equal(t, stepExecutionId.String(), event.StepExecutionId)
+	stepExecutions.Delete(stepExecutionId)
+}
+
+func Test_onExperimentCompleted_deletesAllStepsOfTheExecution(t *testing.T) {
+	otherStepId := uuid.New()
+	stepExecutions.Set(otherStepId, event_kit_api.ExperimentStepExecution{Id: otherStepId, ExecutionId: 7}, ttlcache.DefaultTTL)
+	stepIds := make([]uuid.UUID, 0, 5)
+	for range 5 {
+		stepId := uuid.New()
+		stepIds = append(stepIds, stepId)
+		stepExecutions.Set(stepId, event_kit_api.ExperimentStepExecution{Id: stepId, ExecutionId: 42}, ttlcache.DefaultTTL)
+		stepFailures.Set(stepId, stepFailure{targetExecution: event_kit_api.ExperimentStepTargetExecution{ExecutionId: 42, StepExecutionId: stepId}}, ttlcache.DefaultTTL)
+	}
+
+	_, err := onExperimentCompleted(&event_kit_api.EventRequestBody{
+		Environment:         new(event_kit_api.Environment{Name: "gateway"}),
+		ExperimentExecution: &event_kit_api.ExperimentExecution{ExecutionId: 42, ExperimentKey: "ADM-1"},
+	})
+	require.NoError(t, err)
+
+	for _, stepId := range stepIds {
+		assert.False(t, stepExecutions.Has(stepId))
+		assert.False(t, stepFailures.Has(stepId))
+	}
+	assert.True(t, stepExecutions.Has(otherStepId))
+	stepExecutions.Delete(otherStepId)
+}
@@ -0,0 +1,83 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2022 Steadybit GmbH
+
+package extevents
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync/atomic"
+
+	"github.com/steadybit/extension-newrelic/types"
+)
+
+// eventFilter selects the events to send to New Relic, so teams sharing an extension can
+// limit it to their environments, teams or event types. Empty criteria match all events.
+type eventFilter struct {
+	eventTypes     map[string]bool
+	environments   map[string]bool
+	teams          map[string]bool
+	experimentKeys *regexp.Regexp
+
+	filtered atomic.Int64
+}
+
+// newEventFilter creates a filter for the given event types, environment names, team keys and
+// experiment key pattern. The pattern is a regular expression that must match the whole key.
+func newEventFilter(eventTypes, environments, teams []string, experimentKeyPattern string) (*eventFilter, error) {
+	filter := &eventFilter{
+		eventTypes:   filterValues(eventTypes),
+		environments: filterValues(environments),
+		teams:        filterValues(teams),
+	}
+	if experimentKeyPattern != "" {
+		experimentKeys, err := regexp.Compile(fmt.Sprintf("^(?:%s)$", experimentKeyPattern))
+		if err != nil {
+			return nil, fmt.Errorf("invalid experiment key pattern %q: %w", experimentKeyPattern, err)
+		}
+		filter.experimentKeys = experimentKeys
+	}
+	return filter, nil
+}
+
+// accepts tells whether an event is to be sent and counts the events that are not.
+func (f *eventFilter) accepts(newRelicEvent *types.EventIngest) bool {
+	if f.matches(newRelicEvent) {
+		return true
+	}
+	f.filtered.Add(1)
+	return false
+}
+
+func (f *eventFilter) matches(newRelicEvent *types.EventIngest) bool {
+	if len(f.eventTypes) > 0 && !f.eventTypes[string(newRelicEvent.EventType)] {
+		return false
+	}
+	return f.matchesExecution(newRelicEvent)
+}
+
+// matchesExecution tells whether the environment, team and experiment of an event match,
+// regardless of its type.
+func (f *eventFilter) matchesExecution(newRelicEvent *types.EventIngest) bool {
+	if len(f.environments) > 0 && !f.environments[newRelicEvent.EnvironmentName] {
+		return false
+	}
+	if len(f.teams) > 0 && !f.teams[newRelicEvent.TeamKey] {
+		return false
+	}
+	if f.experimentKeys != nil && !f.experimentKeys.MatchString(newRelicEvent.ExperimentKey) {
+		return false
+	}
+	return true
+}
+
+func filterValues(values []string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, value := range values {
+		if value = strings.TrimSpace(value); value != "" {
+			set[value] = true
+		}
+	}
+	return set
+}
@@ -0,0 +1,48 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2022 Steadybit GmbH
+
+package extevents
+
+import (
+	"testing"
+
+	"github.com/steadybit/extension-newrelic/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_eventFilter_acceptsAllWithoutCriteria(t *testing.T) {
+	filter, err := newEventFilter(nil, nil, nil, "")
+	require.NoError(t, err)
+
+	assert.True(t, filter.accepts(&types.EventIngest{EventType: types.EventTypeAttackStarted}))
+	assert.Equal(t, int64(0), filter.filtered.Load())
+}
+
+func Test_eventFilter_matchesAllCriteria(t *testing.T) {
+	filter, err := newEventFilter(
+		[]string{"ExperimentStarted", " ExperimentEnded"},
+		[]string{"Production"},
+		[]string{"checkout", "payment"},
+		"SHOP-.*",
+	)
+	require.NoError(t, err)
+
+	accepted := types.EventIngest{EventType: types.EventTypeExperimentEnded, EnvironmentName: "Production", TeamKey: "payment", ExperimentKey: "SHOP-12"}
+	assert.True(t, filter.accepts(&accepted))
+
+	for _, event := range []types.EventIngest{
+		{EventType: types.EventTypeAttackStarted, EnvironmentName: "Production", TeamKey: "payment", ExperimentKey: "SHOP-12"},
+		{EventType: types.EventTypeExperimentEnded, EnvironmentName: "Staging", TeamKey: "payment", ExperimentKey: "SHOP-12"},
+		{EventType: types.EventTypeExperimentEnded, EnvironmentName: "Production", TeamKey: "search", ExperimentKey: "SHOP-12"},
+		{EventType: types.EventTypeExperimentEnded, EnvironmentName: "Production", TeamKey: "payment", ExperimentKey: "OLDSHOP-12"},
+	} {
+		assert.False(t, filter.accepts(&event), "%+v", event)
+	}
+	assert.Equal(t, int64(4), filter.filtered.Load())
+}
+
+func Test_newEventFilter_rejectsInvalidPattern(t *testing.T) {
+	_, err := newEventFilter(nil, nil, nil, "SHOP-(")
+	assert.Error(t, err)
+}
@@ -0,0 +1,131 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2022 Steadybit GmbH
+
+package extevents
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/steadybit/event-kit/go/event_kit_api"
+	"github.com/steadybit/extension-newrelic/types"
+)
+
+type PostLogsApi interface {
+	PostLogs(ctx context.Context, logs []types.LogEntry) error
+}
+
+// logForwarder forwards a human-readable log line for every execution event received, so
+// chaos experiments can be queried next to the logs of the services they affected. Log lines
+// carry the same attributes as the events, like experimentKey and executionId.
+type logForwarder struct {
+	*batcher[types.LogEntry]
+}
+
+func newLogForwarder(api PostLogsApi, size int, batchSize int, flushInterval time.Duration) *logForwarder {
+	return &logForwarder{newBatcher("experiment logs", size, batchSize, flushInterval, api.PostLogs)}
+}
+
+// track forwards the log line of an execution event, unless the event filter excludes the
+// event's environment, team or experiment.
+func (l *logForwarder) track(event *event_kit_api.EventRequestBody) {
+	entry, newRelicEvent := logEntry(event)
+	if entry == nil || (filter != nil && !filter.matchesExecution(newRelicEvent)) {
+		return
+	}
+	l.add(*entry)
+}
+
+// logEntry creates the log line of an execution event, along with the properties it was
+// created from, or returns nil for events of unknown names.
+func logEntry(event *event_kit_api.EventRequestBody) (*types.LogEntry, *types.EventIngest) {
+	name, found := strings.CutPrefix(event.EventName, "experiment.execution.")
+	if !found {
+		return nil, nil
+	}
+	subject, verb, found := strings.Cut(name, "-")
+	if !found {
+		subject, verb = "experiment", name
+	}
+	if verb == "created" {
+		verb = "started"
+	}
+
+	newRelicEvent := types.EventIngest{}
+	if event.Environment != nil {
+		addBaseProperties(&newRelicEvent, event)
+	} else if !event.EventTime.IsZero() {
+		newRelicEvent.Timestamp = event.EventTime.UnixMilli()
+	}
+	addExperimentExecutionProperties(&newRelicEvent, event.ExperimentExecution)
+	var reason, reasonDetails *string
+	var message string
+	switch subject {
+	case "experiment":
+		if event.ExperimentExecution == nil {
+			return nil, nil
+		}
+		reason, reasonDetails = event.ExperimentExecution.Reason, event.ExperimentExecution.ReasonDetails
+		message = fmt.Sprintf("Experiment %s %s", firstNonEmpty(newRelicEvent.ExperimentName, newRelicEvent.ExperimentKey), verb)
+		if verb == "started" && firstNonEmpty(newRelicEvent.PrincipalName, newRelicEvent.PrincipalUsername) != "" {
+			message = fmt.Sprintf("%s by %s", message, firstNonEmpty(newRelicEvent.PrincipalName, newRelicEvent.PrincipalUsername))
+		}
+	case "step":
+		stepExecution := event.ExperimentStepExecution
+		if stepExecution == nil {
+			return nil, nil
+		}
+		newRelicEvent.ExperimentKey = stepExecution.ExperimentKey
+		newRelicEvent.ExecutionId = fmt.Sprintf("%g", stepExecution.ExecutionId)
+		newRelicEvent.ExecutionUrl = executionUrl(newRelicEvent.ExperimentKey, newRelicEvent.ExecutionId)
+		addStepExecutionProperties(&newRelicEvent, stepExecution)
+		newRelicEvent.StepKind = stepKind(stepExecution)
+		if failure := stepFailures.Get(stepExecution.Id); failure != nil {
+			reason, reasonDetails = failure.Value().targetExecution.Reason, failure.Value().targetExecution.ReasonDetails
+		}
+		message = strings.Join(strings.Fields(fmt.Sprintf("Step %s %s %s", newRelicEvent.StepKind, stepLabel(&newRelicEvent), verb)), " ")
+	case "target":
+		if event.ExperimentStepTargetExecution == nil {
+			return nil, nil
+		}
+		stepExecution := lookupStepExecution(event)
+		addStepExecutionProperties(&newRelicEvent, &stepExecution)
+		addTargetExecutionProperties(&newRelicEvent, event.ExperimentStepTargetExecution)
+		newRelicEvent.StepKind = stepKind(&stepExecution)
+		reason, reasonDetails = event.ExperimentStepTargetExecution.Reason, event.ExperimentStepTargetExecution.ReasonDetails
+		message = strings.Join(strings.Fields(fmt.Sprintf("%s %s on target %s", firstNonEmpty(stepLabel(&newRelicEvent), "Step"), verb, newRelicEvent.Target)), " ")
+	default:
+		return nil, nil
+	}
+	if verb != "started" && verb != "completed" {
+		if newRelicEvent.FailureReason = failureReason(reason, reasonDetails); newRelicEvent.FailureReason != "" {
+			message = fmt.Sprintf("%s: %s", message, newRelicEvent.FailureReason)
+		}
+	}
+
+	attributes := eventFields(&newRelicEvent)
+	attributes["level"] = logLevel(verb)
+	attributes["eventName"] = event.EventName
+	return &types.LogEntry{
+		Timestamp:  eventTime(&newRelicEvent).UnixMilli(),
+		Message:    message,
+		Attributes: attributes,
+	}, &newRelicEvent
+}
+
+func stepLabel(newRelicEvent *types.EventIngest) string {
+	return firstNonEmpty(newRelicEvent.ActionCustomLabel, newRelicEvent.ActionName, newRelicEvent.ActionId)
+}
+
+func logLevel(verb string) string {
+	switch verb {
+	case "failed", "errored":
+		return "ERROR"
+	case "canceled":
+		return "WARN"
+	default:
+		return "INFO"
+	}
+}
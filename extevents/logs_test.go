@@ -0,0 +1,77 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2022 Steadybit GmbH
+
+package extevents
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/steadybit/event-kit/go/event_kit_api"
+	"github.com/steadybit/extension-kit/extutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_logEntry_forExperimentStart(t *testing.T) {
+	eventTime := time.Date(2021, 1, 1, 0, 1, 0, 0, time.UTC)
+
+	entry, _ := logEntry(&event_kit_api.EventRequestBody{
+		EventName:   "experiment.execution.created",
+		EventTime:   eventTime,
+		Environment: new(event_kit_api.Environment{Name: "Production"}),
+		Principal:   event_kit_api.UserPrincipal{Name: "Jane Doe", Username: "jane", PrincipalType: "user"},
+		ExperimentExecution: new(event_kit_api.ExperimentExecution{
+			ExecutionId:   42,
+			ExperimentKey: "ADM-1",
+			Name:          "Checkout survives pod loss",
+		}),
+	})
+
+	require.NotNil(t, entry)
+	assert.Equal(t, "Experiment Checkout survives pod loss started by Jane Doe", entry.Message)
+	assert.Equal(t, eventTime.UnixMilli(), entry.Timestamp)
+	assert.Equal(t, "ADM-1", entry.Attributes["experimentKey"])
+	assert.Equal(t, "42", entry.Attributes["executionId"])
+	assert.Equal(t, "Production", entry.Attributes["environmentName"])
+	assert.Equal(t, "INFO", entry.Attributes["level"])
+}
+
+func Test_logEntry_forFailedTarget(t *testing.T) {
+	stepExecutionId := uuid.New()
+	stepExecutions.Set(stepExecutionId, event_kit_api.ExperimentStepExecution{
+		Id:          stepExecutionId,
+		Type:        event_kit_api.Action,
+		ActionId:    extutil.Ptr("com.steadybit.extension_container.stress_cpu"),
+		ActionName:  extutil.Ptr("Stress CPU"),
+		ActionKind:  extutil.Ptr(event_kit_api.Attack),
+		ExecutionId: 42,
+	}, 0)
+	defer stepExecutions.Delete(stepExecutionId)
+
+	entry, _ := logEntry(&event_kit_api.EventRequestBody{
+		EventName:   "experiment.execution.target-failed",
+		Environment: new(event_kit_api.Environment{Name: "Production"}),
+		ExperimentStepTargetExecution: &event_kit_api.ExperimentStepTargetExecution{
+			ExecutionId:     42,
+			ExperimentKey:   "ADM-1",
+			StepExecutionId: stepExecutionId,
+			State:           "failed",
+			TargetName:      "checkout",
+			Reason:          new("Agent lost"),
+		},
+	})
+
+	require.NotNil(t, entry)
+	assert.Equal(t, "Stress CPU failed on target checkout: Agent lost", entry.Message)
+	assert.Equal(t, "ERROR", entry.Attributes["level"])
+	assert.Equal(t, "attack", entry.Attributes["stepKind"])
+	assert.Equal(t, "Agent lost", entry.Attributes["failureReason"])
+	assert.Equal(t, "experiment.execution.target-failed", entry.Attributes["eventName"])
+}
+
+func Test_logEntry_ignoresUnknownEvents(t *testing.T) {
+	entry, _ := logEntry(&event_kit_api.EventRequestBody{EventName: "experiment.step.started"})
+	assert.Nil(t, entry)
+}
@@ -0,0 +1,193 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2022 Steadybit GmbH
+
+package extevents
+
+import (
+	"context"
+	"maps"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/steadybit/extension-newrelic/types"
+)
+
+const (
+	metricExperimentRunning = "steadybit.experiment.running"
+	metricAttackActive      = "steadybit.attack.active"
+)
+
+// metricSeriesMaxAge bounds how long a series is reported as active if its end is never received.
+const metricSeriesMaxAge = 24 * time.Hour
+
+type PostMetricsApi interface {
+	PostMetrics(ctx context.Context, metrics []types.Metric) error
+}
+
+// metricSeries is a gauge reported with a value of 1 while an experiment runs or an attack is
+// active.
+type metricSeries struct {
+	name       string
+	attributes map[string]string
+	startedAt  time.Time
+}
+
+// metricsReporter publishes running experiments and active attacks as gauges, so alert
+// conditions and dashboards can use them as a time series. Active series are reported in
+// every interval and, once ended, a last time with a value of 0. Changes are reported right
+// away rather than at the next interval.
+type metricsReporter struct {
+	api      PostMetricsApi
+	interval time.Duration
+	changed  chan struct{}
+
+	mu     sync.Mutex
+	active map[string]metricSeries
+	ended  []types.Metric
+}
+
+func newMetricsReporter(api PostMetricsApi, interval time.Duration) *metricsReporter {
+	return &metricsReporter{
+		api:      api,
+		interval: interval,
+		changed:  make(chan struct{}, 1),
+		active:   make(map[string]metricSeries),
+	}
+}
+
+func (m *metricsReporter) start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(m.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			case <-m.changed:
+			}
+			m.report(ctx, time.Now())
+		}
+	}()
+}
+
+// track updates the active series for an event, whether it is sent to New Relic or not.
+func (m *metricsReporter) track(newRelicEvent *types.EventIngest) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	switch newRelicEvent.EventType {
+	case types.EventTypeExperimentStarted:
+		m.begin("experiment/"+newRelicEvent.ExecutionId, metricExperimentRunning, newRelicEvent, experimentDimensions(newRelicEvent))
+	case types.EventTypeExperimentEnded:
+		m.end("experiment/"+newRelicEvent.ExecutionId, newRelicEvent)
+		// Attacks whose end got lost end with their experiment at the latest.
+		for key, series := range m.active {
+			if series.name == metricAttackActive && series.attributes["executionId"] == newRelicEvent.ExecutionId {
+				m.end(key, newRelicEvent)
+			}
+		}
+	case types.EventTypeAttackStarted:
+		m.begin(attackSeriesKey(newRelicEvent), metricAttackActive, newRelicEvent, attackDimensions(newRelicEvent))
+	case types.EventTypeAttackEnded:
+		m.end(attackSeriesKey(newRelicEvent), newRelicEvent)
+	default:
+		return
+	}
+
+	select {
+	case m.changed <- struct{}{}:
+	default:
+	}
+}
+
+func (m *metricsReporter) begin(key string, name string, newRelicEvent *types.EventIngest, attributes map[string]string) {
+	m.active[key] = metricSeries{name: name, attributes: attributes, startedAt: eventTime(newRelicEvent)}
+}
+
+func (m *metricsReporter) end(key string, newRelicEvent *types.EventIngest) {
+	series, ok := m.active[key]
+	if !ok {
+		return
+	}
+	delete(m.active, key)
+	m.ended = append(m.ended, gauge(series, 0, eventTime(newRelicEvent)))
+}
+
+// report sends the current value of all series. Metrics that failed to be sent are not
+// retried, as the next report supersedes them.
+func (m *metricsReporter) report(ctx context.Context, now time.Time) {
+	m.mu.Lock()
+	metrics := m.ended
+	m.ended = nil
+	for key, series := range m.active {
+		if now.Sub(series.startedAt) > metricSeriesMaxAge {
+			delete(m.active, key)
+			metrics = append(metrics, gauge(series, 0, now))
+			continue
+		}
+		metrics = append(metrics, gauge(series, 1, now))
+	}
+	m.mu.Unlock()
+
+	if len(metrics) == 0 {
+		return
+	}
+	if err := m.api.PostMetrics(ctx, metrics); err != nil {
+		log.Warn().Err(err).Int("count", len(metrics)).Msg("Failed to send experiment metrics to New Relic.")
+	}
+}
+
+func gauge(series metricSeries, value float64, timestamp time.Time) types.Metric {
+	return types.Metric{
+		Name:       series.name,
+		Type:       types.MetricTypeGauge,
+		Value:      value,
+		Timestamp:  timestamp.UnixMilli(),
+		Attributes: series.attributes,
+	}
+}
+
+func attackSeriesKey(newRelicEvent *types.EventIngest) string {
+	if newRelicEvent.TargetExecutionId != "" {
+		return "attack/" + newRelicEvent.TargetExecutionId
+	}
+	return "attack/" + newRelicEvent.StepExecutionId + "/" + newRelicEvent.Target
+}
+
+func experimentDimensions(newRelicEvent *types.EventIngest) map[string]string {
+	return nonEmpty(map[string]string{
+		"experimentKey":   newRelicEvent.ExperimentKey,
+		"experimentName":  newRelicEvent.ExperimentName,
+		"executionId":     newRelicEvent.ExecutionId,
+		"teamKey":         newRelicEvent.TeamKey,
+		"teamName":        newRelicEvent.TeamName,
+		"environmentName": newRelicEvent.EnvironmentName,
+	})
+}
+
+func attackDimensions(newRelicEvent *types.EventIngest) map[string]string {
+	dimensions := experimentDimensions(newRelicEvent)
+	maps.Copy(dimensions, nonEmpty(map[string]string{
+		"actionId":   newRelicEvent.ActionId,
+		"target":     newRelicEvent.Target,
+		"targetType": newRelicEvent.TargetType,
+		"entityGuid": newRelicEvent.EntityGuid,
+		"entityName": newRelicEvent.EntityName,
+	}))
+	return dimensions
+}
+
+func nonEmpty(values map[string]string) map[string]string {
+	maps.DeleteFunc(values, func(_ string, value string) bool { return value == "" })
+	return values
+}
+
+// eventTime is the time of an event, or now if the event has none.
+func eventTime(newRelicEvent *types.EventIngest) time.Time {
+	if newRelicEvent.Timestamp == 0 {
+		return time.Now()
+	}
+	return time.UnixMilli(newRelicEvent.Timestamp)
+}
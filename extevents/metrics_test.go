@@ -0,0 +1,66 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2022 Steadybit GmbH
+
+package extevents
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/steadybit/extension-newrelic/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type postMetricsApiMock struct {
+	metrics [][]types.Metric
+}
+
+func (m *postMetricsApiMock) PostMetrics(_ context.Context, metrics []types.Metric) error {
+	m.metrics = append(m.metrics, metrics)
+	return nil
+}
+
+func Test_metricsReporter_reportsActiveAndEndedSeries(t *testing.T) {
+	api := &postMetricsApiMock{}
+	reporter := newMetricsReporter(api, time.Minute)
+	now := time.Date(2021, 1, 1, 0, 1, 0, 0, time.UTC)
+
+	reporter.track(&types.EventIngest{EventType: types.EventTypeExperimentStarted, ExperimentKey: "ADM-1", ExecutionId: "42", EnvironmentName: "Production", Timestamp: now.UnixMilli()})
+	reporter.track(&types.EventIngest{EventType: types.EventTypeAttackStarted, ExperimentKey: "ADM-1", ExecutionId: "42", EnvironmentName: "Production", Target: "checkout", TargetExecutionId: "t1", Timestamp: now.UnixMilli()})
+	reporter.report(context.Background(), now)
+
+	require.Len(t, api.metrics, 1)
+	assert.ElementsMatch(t, []types.Metric{
+		{Name: metricExperimentRunning, Type: types.MetricTypeGauge, Value: 1, Timestamp: now.UnixMilli(), Attributes: map[string]string{"experimentKey": "ADM-1", "executionId": "42", "environmentName": "Production"}},
+		{Name: metricAttackActive, Type: types.MetricTypeGauge, Value: 1, Timestamp: now.UnixMilli(), Attributes: map[string]string{"experimentKey": "ADM-1", "executionId": "42", "environmentName": "Production", "target": "checkout"}},
+	}, api.metrics[0])
+
+	ended := now.Add(time.Minute)
+	reporter.track(&types.EventIngest{EventType: types.EventTypeExperimentEnded, ExperimentKey: "ADM-1", ExecutionId: "42", Timestamp: ended.UnixMilli()})
+	reporter.report(context.Background(), ended)
+
+	require.Len(t, api.metrics, 2)
+	require.Len(t, api.metrics[1], 2)
+	for _, metric := range api.metrics[1] {
+		assert.Equal(t, float64(0), metric.Value)
+		assert.Equal(t, ended.UnixMilli(), metric.Timestamp)
+	}
+
+	reporter.report(context.Background(), ended.Add(time.Minute))
+	assert.Len(t, api.metrics, 2)
+}
+
+func Test_metricsReporter_endsStaleSeries(t *testing.T) {
+	api := &postMetricsApiMock{}
+	reporter := newMetricsReporter(api, time.Minute)
+	now := time.Date(2021, 1, 1, 0, 1, 0, 0, time.UTC)
+
+	reporter.track(&types.EventIngest{EventType: types.EventTypeAttackStarted, StepExecutionId: "s1", Target: "checkout", Timestamp: now.UnixMilli()})
+	reporter.report(context.Background(), now.Add(metricSeriesMaxAge+time.Minute))
+
+	require.Len(t, api.metrics, 1)
+	assert.Equal(t, float64(0), api.metrics[0][0].Value)
+	assert.Empty(t, reporter.active)
+}
@@ -0,0 +1,111 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2022 Steadybit GmbH
+
+package extevents
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"github.com/steadybit/event-kit/go/event_kit_api"
+)
+
+// accountAttributes are the target attributes naming the New Relic account a target belongs
+// to, be it discovered by this extension or added by an enrichment rule.
+var accountAttributes = []string{
+	"new-relic.account.id",
+	"new-relic.workload.account",
+	"new-relic.apm-service.account",
+	"new-relic.service-level.account",
+	"new-relic.synthetic-monitor.account",
+	"new-relic.alert-condition.account",
+	"new-relic.alert-policy.account",
+}
+
+// accountRouter decides which accounts an event is sent to. Accounts named by the target take
+// precedence over the accounts mapped to the team and environment of the experiment. Only
+// if neither yields an account, and fan-out is enabled, the event goes to all accounts.
+type accountRouter struct {
+	teamAccounts        map[string][]int64
+	environmentAccounts map[string][]int64
+	fanOut              bool
+	allAccounts         func() []int64
+}
+
+func newAccountRouter(teamAccounts map[string]string, environmentAccounts map[string]string, fanOut bool, allAccounts func() []int64) *accountRouter {
+	return &accountRouter{
+		teamAccounts:        parseAccountMapping("team", teamAccounts),
+		environmentAccounts: parseAccountMapping("environment", environmentAccounts),
+		fanOut:              fanOut,
+		allAccounts:         allAccounts,
+	}
+}
+
+// parseAccountMapping parses the ';' separated account ids of each key. Invalid ids are
+// logged and ignored.
+func parseAccountMapping(kind string, mapping map[string]string) map[string][]int64 {
+	result := make(map[string][]int64, len(mapping))
+	for key, value := range mapping {
+		for _, id := range strings.Split(value, ";") {
+			accountId, err := strconv.ParseInt(strings.TrimSpace(id), 10, 64)
+			if err != nil {
+				log.Warn().Str(kind, key).Str("accountId", id).Msgf("Ignoring invalid account id in the %s account mapping.", kind)
+				continue
+			}
+			result[key] = appendAccount(result[key], accountId)
+		}
+	}
+	return result
+}
+
+func (r *accountRouter) accounts(event *event_kit_api.EventRequestBody) []int64 {
+	if event.ExperimentStepTargetExecution != nil {
+		if accounts := targetAccounts(event.ExperimentStepTargetExecution.TargetAttributes); len(accounts) > 0 {
+			return accounts
+		}
+	}
+
+	var accounts []int64
+	if event.Team != nil {
+		for _, accountId := range r.teamAccounts[event.Team.Key] {
+			accounts = appendAccount(accounts, accountId)
+		}
+	}
+	if event.Environment != nil {
+		for _, accountId := range r.environmentAccounts[event.Environment.Name] {
+			accounts = appendAccount(accounts, accountId)
+		}
+	}
+	if len(accounts) > 0 {
+		return accounts
+	}
+
+	if r.fanOut {
+		return r.allAccounts()
+	}
+	return nil
+}
+
+func targetAccounts(attributes map[string][]string) []int64 {
+	var accounts []int64
+	for _, attribute := range accountAttributes {
+		for _, value := range attributes[attribute] {
+			accountId, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				log.Debug().Str("attribute", attribute).Str("value", value).Msg("Ignoring invalid account id of target.")
+				continue
+			}
+			accounts = appendAccount(accounts, accountId)
+		}
+	}
+	return accounts
+}
+
+func appendAccount(accounts []int64, accountId int64) []int64 {
+	if slices.Contains(accounts, accountId) {
+		return accounts
+	}
+	return append(accounts, accountId)
+}
@@ -0,0 +1,64 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2022 Steadybit GmbH
+
+package extevents
+
+import (
+	"testing"
+
+	"github.com/steadybit/event-kit/go/event_kit_api"
+	"github.com/stretchr/testify/assert"
+)
+
+func allAccounts() []int64 {
+	return []int64{1, 2, 3}
+}
+
+func Test_accountRouter_prefersTargetAccounts(t *testing.T) {
+	router := newAccountRouter(map[string]string{"checkout": "1234"}, nil, true, allAccounts)
+
+	accounts := router.accounts(&event_kit_api.EventRequestBody{
+		Team: &event_kit_api.Team{Key: "checkout"},
+		ExperimentStepTargetExecution: &event_kit_api.ExperimentStepTargetExecution{
+			TargetAttributes: map[string][]string{
+				"new-relic.workload.account":    {"5678"},
+				"new-relic.apm-service.account": {"5678", "9012"},
+			},
+		},
+	})
+
+	assert.Equal(t, []int64{5678, 9012}, accounts)
+}
+
+func Test_accountRouter_usesTeamAndEnvironmentMapping(t *testing.T) {
+	router := newAccountRouter(
+		map[string]string{"checkout": "1234;5678", "payment": "9012"},
+		map[string]string{"Production": "5678; 3456", "Staging": "invalid"},
+		true,
+		allAccounts,
+	)
+
+	accounts := router.accounts(&event_kit_api.EventRequestBody{
+		Team:        &event_kit_api.Team{Key: "checkout"},
+		Environment: &event_kit_api.Environment{Name: "Production"},
+		ExperimentStepTargetExecution: &event_kit_api.ExperimentStepTargetExecution{
+			TargetAttributes: map[string][]string{"k8s.cluster-name": {"prod"}},
+		},
+	})
+	assert.Equal(t, []int64{1234, 5678, 3456}, accounts)
+
+	accounts = router.accounts(&event_kit_api.EventRequestBody{
+		Environment: &event_kit_api.Environment{Name: "Staging"},
+	})
+	assert.Equal(t, []int64{1, 2, 3}, accounts)
+}
+
+func Test_accountRouter_fansOutOnlyIfEnabled(t *testing.T) {
+	event := &event_kit_api.EventRequestBody{
+		Team:        &event_kit_api.Team{Key: "checkout"},
+		Environment: &event_kit_api.Environment{Name: "Production"},
+	}
+
+	assert.Empty(t, newAccountRouter(nil, nil, false, allAccounts).accounts(event))
+	assert.Equal(t, []int64{1, 2, 3}, newAccountRouter(nil, nil, true, allAccounts).accounts(event))
+}
@@ -0,0 +1,105 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2022 Steadybit GmbH
+
+package extevents
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jellydator/ttlcache/v3"
+	"github.com/rs/zerolog/log"
+	"github.com/steadybit/event-kit/go/event_kit_api"
+)
+
+// stepSpoolSubdir is the directory in the event spool directory the started steps are kept in.
+// The delivery queue skips directories when restoring its events.
+const stepSpoolSubdir = "steps"
+
+// stepSpool keeps the started steps on disk, so the kind of a step is still known for the
+// target events received after a restart. Without a directory, steps are only kept in memory.
+type stepSpool struct {
+	dir string
+}
+
+func newStepSpool(dir string) *stepSpool {
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			log.Err(err).Str("dir", dir).Msg("Failed to create step spool directory. Steps are only kept in memory.")
+			dir = ""
+		}
+	}
+	return &stepSpool{dir: dir}
+}
+
+func (s *stepSpool) file(id uuid.UUID) string {
+	return filepath.Join(s.dir, id.String()+spoolFileSuffix)
+}
+
+func (s *stepSpool) save(stepExecution event_kit_api.ExperimentStepExecution) {
+	if s.dir == "" {
+		return
+	}
+	b, err := json.Marshal(stepExecution)
+	if err == nil {
+		err = os.WriteFile(s.file(stepExecution.Id), b, 0o600)
+	}
+	if err != nil {
+		log.Err(err).Str("stepExecutionId", stepExecution.Id.String()).Msg("Failed to write step to the spool directory. It is only kept in memory.")
+	}
+}
+
+func (s *stepSpool) remove(ids ...uuid.UUID) {
+	if s.dir == "" {
+		return
+	}
+	for _, id := range ids {
+		if err := os.Remove(s.file(id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Err(err).Str("file", s.file(id)).Msg("Failed to remove step from the spool directory.")
+		}
+	}
+}
+
+// restore adds the steps saved by a previous run to the cache. Steps older than the cache's TTL
+// belong to experiments whose completion was missed and are removed.
+func (s *stepSpool) restore(cache *ttlcache.Cache[uuid.UUID, event_kit_api.ExperimentStepExecution]) {
+	if s.dir == "" {
+		return
+	}
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		log.Err(err).Str("dir", s.dir).Msg("Failed to read step spool directory.")
+		return
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), spoolFileSuffix) {
+			continue
+		}
+		file := filepath.Join(s.dir, entry.Name())
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		if time.Since(info.ModTime()) > stepCacheTtl {
+			_ = os.Remove(file)
+			continue
+		}
+		b, err := os.ReadFile(file)
+		if err != nil {
+			log.Err(err).Str("file", file).Msg("Failed to read spooled step.")
+			continue
+		}
+		var stepExecution event_kit_api.ExperimentStepExecution
+		if err := json.Unmarshal(b, &stepExecution); err != nil || stepExecution.Id.String()+spoolFileSuffix != entry.Name() {
+			log.Warn().Err(err).Str("file", file).Msg("Ignoring invalid spooled step.")
+			_ = os.Remove(file)
+			continue
+		}
+		cache.Set(stepExecution.Id, stepExecution, stepCacheTtl-time.Since(info.ModTime()))
+	}
+}
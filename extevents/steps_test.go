@@ -0,0 +1,71 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2022 Steadybit GmbH
+
+package extevents
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/steadybit/event-kit/go/event_kit_api"
+	"github.com/steadybit/extension-kit/extutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_stepSpool_keepsStepKindAcrossRestarts(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), stepSpoolSubdir)
+	steps = newStepSpool(dir)
+	defer func() { steps = newStepSpool("") }()
+	stepExecutionId := uuid.New()
+
+	_, err := onExperimentStepStarted(&event_kit_api.EventRequestBody{
+		ExperimentStepExecution: &event_kit_api.ExperimentStepExecution{
+			Id:          stepExecutionId,
+			Type:        event_kit_api.Action,
+			ActionKind:  extutil.Ptr(event_kit_api.Check),
+			ExecutionId: 42,
+		},
+	})
+	require.NoError(t, err)
+
+	// A restart loses the cached steps, the spooled ones are restored.
+	stepExecutions.Delete(stepExecutionId)
+	newStepSpool(dir).restore(stepExecutions)
+	require.True(t, stepExecutions.Has(stepExecutionId))
+
+	event, err := onExperimentTargetStarted(&event_kit_api.EventRequestBody{
+		Environment: new(event_kit_api.Environment{Name: "gateway"}),
+		ExperimentStepTargetExecution: &event_kit_api.ExperimentStepTargetExecution{
+			ExecutionId:     42,
+			StepExecutionId: stepExecutionId,
+		},
+	})
+	require.NoError(t, err)
+	assert.Nil(t, event)
+
+	_, err = onExperimentCompleted(&event_kit_api.EventRequestBody{
+		Environment:         new(event_kit_api.Environment{Name: "gateway"}),
+		ExperimentExecution: &event_kit_api.ExperimentExecution{ExecutionId: 42},
+	})
+	require.NoError(t, err)
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func Test_stepSpool_removesStepsOlderThanTheCacheTtl(t *testing.T) {
+	spool := newStepSpool(t.TempDir())
+	stepExecutionId := uuid.New()
+	spool.save(event_kit_api.ExperimentStepExecution{Id: stepExecutionId})
+	old := time.Now().Add(-stepCacheTtl - time.Minute)
+	require.NoError(t, os.Chtimes(spool.file(stepExecutionId), old, old))
+
+	spool.restore(stepExecutions)
+
+	assert.False(t, stepExecutions.Has(stepExecutionId))
+	assert.NoFileExists(t, spool.file(stepExecutionId))
+}
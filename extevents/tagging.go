@@ -0,0 +1,237 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2022 Steadybit GmbH
+
+package extevents
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/steadybit/extension-newrelic/types"
+)
+
+// Entities under attack are tagged with the keys of the attacking experiments and the time
+// the tag expires. The expiry is extended while the attacks are active, so tags left behind
+// by a crashed extension are recognized as stale and removed.
+const (
+	attackTagKey        = "steadybit.attack"
+	attackExpiresTagKey = "steadybit.attack.expires"
+	attackTagTtl        = 15 * time.Minute
+)
+
+type EntityTaggingApi interface {
+	AddEntityTag(ctx context.Context, guid string, key string, values []string) error
+	DeleteEntityTagValues(ctx context.Context, guid string, key string, values []string) error
+	DeleteEntityTags(ctx context.Context, guid string, keys []string) error
+	SearchEntities(ctx context.Context, query string) ([]types.GraphQlResponseEntities, error)
+}
+
+// entityAttack is an attack on an entity.
+type entityAttack struct {
+	experimentKey string
+	executionId   string
+}
+
+// entityTagger tags the entities under attack for the duration of the attacks, so alert
+// workflows can route chaos-triggered alerts differently. Tag changes are applied one by one
+// in the background, in the order of the attacks' events.
+type entityTagger struct {
+	api     EntityTaggingApi
+	changes chan func(ctx context.Context)
+
+	mu      sync.Mutex
+	attacks map[string]map[string]entityAttack
+
+	// expiries are the expiry tag values set per entity. Only used by the tag changes, which
+	// run one by one.
+	expiries map[string]string
+}
+
+func newEntityTagger(api EntityTaggingApi, size int) *entityTagger {
+	return &entityTagger{
+		api:      api,
+		changes:  make(chan func(ctx context.Context), size),
+		attacks:  make(map[string]map[string]entityAttack),
+		expiries: make(map[string]string),
+	}
+}
+
+func (t *entityTagger) start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(attackTagTtl / 3)
+		defer ticker.Stop()
+		t.removeStaleTags(ctx, time.Now())
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case change := <-t.changes:
+				change(ctx)
+			case <-ticker.C:
+				t.extendTags(ctx, time.Now())
+				t.removeStaleTags(ctx, time.Now())
+			}
+		}
+	}()
+}
+
+// track updates the tags of the entities of an event, whether it is sent to New Relic or not.
+func (t *entityTagger) track(newRelicEvent *types.EventIngest) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	switch newRelicEvent.EventType {
+	case types.EventTypeAttackStarted:
+		attack := entityAttack{experimentKey: newRelicEvent.ExperimentKey, executionId: newRelicEvent.ExecutionId}
+		for _, guid := range eventEntityGuids(newRelicEvent) {
+			before := t.experimentKeys(guid)
+			if t.attacks[guid] == nil {
+				t.attacks[guid] = make(map[string]entityAttack)
+			}
+			t.attacks[guid][attackSeriesKey(newRelicEvent)] = attack
+			t.update(guid, before)
+		}
+	case types.EventTypeAttackEnded:
+		for _, guid := range eventEntityGuids(newRelicEvent) {
+			before := t.experimentKeys(guid)
+			delete(t.attacks[guid], attackSeriesKey(newRelicEvent))
+			t.update(guid, before)
+		}
+	case types.EventTypeExperimentEnded:
+		// Attacks whose end got lost end with their experiment at the latest.
+		for guid, attacks := range t.attacks {
+			before := t.experimentKeys(guid)
+			maps.DeleteFunc(attacks, func(_ string, attack entityAttack) bool {
+				return attack.executionId == newRelicEvent.ExecutionId
+			})
+			t.update(guid, before)
+		}
+	}
+}
+
+func (t *entityTagger) experimentKeys(guid string) []string {
+	var keys []string
+	for _, attack := range t.attacks[guid] {
+		if !slices.Contains(keys, attack.experimentKey) {
+			keys = append(keys, attack.experimentKey)
+		}
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// update schedules the tag changes of an entity whose attacks changed.
+func (t *entityTagger) update(guid string, before []string) {
+	after := t.experimentKeys(guid)
+	if len(after) == 0 {
+		delete(t.attacks, guid)
+		if len(before) > 0 {
+			t.schedule(guid, func(ctx context.Context) error {
+				delete(t.expiries, guid)
+				return t.api.DeleteEntityTags(ctx, guid, []string{attackTagKey, attackExpiresTagKey})
+			})
+		}
+		return
+	}
+	added := slices.DeleteFunc(slices.Clone(after), func(key string) bool { return slices.Contains(before, key) })
+	removed := slices.DeleteFunc(slices.Clone(before), func(key string) bool { return slices.Contains(after, key) })
+	if len(before) == 0 {
+		t.schedule(guid, func(ctx context.Context) error {
+			return t.setExpiry(ctx, guid, time.Now())
+		})
+	}
+	if len(added) > 0 {
+		t.schedule(guid, func(ctx context.Context) error {
+			return t.api.AddEntityTag(ctx, guid, attackTagKey, added)
+		})
+	}
+	if len(removed) > 0 {
+		t.schedule(guid, func(ctx context.Context) error {
+			return t.api.DeleteEntityTagValues(ctx, guid, attackTagKey, removed)
+		})
+	}
+}
+
+func (t *entityTagger) schedule(guid string, change func(ctx context.Context) error) {
+	select {
+	case t.changes <- func(ctx context.Context) {
+		if err := change(ctx); err != nil {
+			log.Warn().Err(err).Str("guid", guid).Msg("Failed to update the attack tags of the entity.")
+		}
+	}:
+	default:
+		log.Warn().Str("guid", guid).Msg("Entity tagging queue is full. Dropping tag change.")
+	}
+}
+
+// setExpiry sets the expiry of the entity's tags. The new expiry is added before the previous
+// one is removed, so other instances never see the tags without a valid expiry and remove them.
+func (t *entityTagger) setExpiry(ctx context.Context, guid string, now time.Time) error {
+	expires := now.Add(attackTagTtl).UTC().Format(time.RFC3339)
+	if err := t.api.AddEntityTag(ctx, guid, attackExpiresTagKey, []string{expires}); err != nil {
+		return err
+	}
+	previous, ok := t.expiries[guid]
+	t.expiries[guid] = expires
+	if !ok || previous == expires {
+		return nil
+	}
+	return t.api.DeleteEntityTagValues(ctx, guid, attackExpiresTagKey, []string{previous})
+}
+
+// extendTags extends the expiry of the tags of all entities under attack.
+func (t *entityTagger) extendTags(ctx context.Context, now time.Time) {
+	t.mu.Lock()
+	guids := slices.Collect(maps.Keys(t.attacks))
+	t.mu.Unlock()
+
+	for _, guid := range guids {
+		if err := t.setExpiry(ctx, guid, now); err != nil {
+			log.Warn().Err(err).Str("guid", guid).Msg("Failed to extend the attack tags of the entity.")
+		}
+	}
+}
+
+// removeStaleTags removes the attack tags of entities that aren't attacked anymore, but whose
+// tags weren't removed, e.g. because the extension crashed during the attack. Tags of other
+// extension instances are kept as long as they extend the expiry.
+func (t *entityTagger) removeStaleTags(ctx context.Context, now time.Time) {
+	entities, err := t.api.SearchEntities(ctx, fmt.Sprintf("tags.`%s` LIKE '%%'", attackTagKey))
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to search for entities with stale attack tags.")
+		return
+	}
+	for _, entity := range entities {
+		t.mu.Lock()
+		_, attacked := t.attacks[entity.Guid]
+		t.mu.Unlock()
+		if attacked || !attackTagExpired(entity.Tags, now) {
+			continue
+		}
+		log.Info().Str("guid", entity.Guid).Str("name", entity.Name).Msg("Removing stale attack tags from entity.")
+		if err := t.api.DeleteEntityTags(ctx, entity.Guid, []string{attackTagKey, attackExpiresTagKey}); err != nil {
+			log.Warn().Err(err).Str("guid", entity.Guid).Msg("Failed to remove stale attack tags from entity.")
+		}
+	}
+}
+
+// attackTagExpired tells whether the attack tags expired. Tags without a valid expiry are
+// considered expired.
+func attackTagExpired(tags []types.GraphQlResponseTags, now time.Time) bool {
+	for _, tag := range tags {
+		if tag.Key != attackExpiresTagKey {
+			continue
+		}
+		for _, value := range tag.Values {
+			if expires, err := time.Parse(time.RFC3339, value); err == nil && expires.After(now) {
+				return false
+			}
+		}
+	}
+	return true
+}
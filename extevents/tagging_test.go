@@ -0,0 +1,113 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2022 Steadybit GmbH
+
+package extevents
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/steadybit/extension-newrelic/types"
+	"github.com/stretchr/testify/assert"
+)
+
+type entityTaggingApiMock struct {
+	calls    []string
+	entities []types.GraphQlResponseEntities
+}
+
+func (m *entityTaggingApiMock) AddEntityTag(_ context.Context, guid string, key string, values []string) error {
+	if key == attackExpiresTagKey {
+		values = []string{"<expires>"}
+	}
+	m.calls = append(m.calls, fmt.Sprintf("add %s %s=%s", guid, key, strings.Join(values, ",")))
+	return nil
+}
+
+func (m *entityTaggingApiMock) DeleteEntityTagValues(_ context.Context, guid string, key string, values []string) error {
+	m.calls = append(m.calls, fmt.Sprintf("delete %s %s=%s", guid, key, strings.Join(values, ",")))
+	return nil
+}
+
+func (m *entityTaggingApiMock) DeleteEntityTags(_ context.Context, guid string, keys []string) error {
+	m.calls = append(m.calls, fmt.Sprintf("delete %s %s", guid, strings.Join(keys, ",")))
+	return nil
+}
+
+func (m *entityTaggingApiMock) SearchEntities(_ context.Context, _ string) ([]types.GraphQlResponseEntities, error) {
+	return m.entities, nil
+}
+
+// apply runs the scheduled tag changes.
+func (t *entityTagger) apply() {
+	for {
+		select {
+		case change := <-t.changes:
+			change(context.Background())
+		default:
+			return
+		}
+	}
+}
+
+func Test_entityTagger_tagsEntitiesWhileAttacked(t *testing.T) {
+	api := &entityTaggingApiMock{}
+	tagger := newEntityTagger(api, 100)
+
+	tagger.track(&types.EventIngest{EventType: types.EventTypeAttackStarted, ExperimentKey: "ADM-1", ExecutionId: "1", TargetExecutionId: "t1", EntityGuid: "g1"})
+	tagger.track(&types.EventIngest{EventType: types.EventTypeAttackStarted, ExperimentKey: "ADM-1", ExecutionId: "1", TargetExecutionId: "t2", EntityGuid: "g1"})
+	tagger.track(&types.EventIngest{EventType: types.EventTypeAttackStarted, ExperimentKey: "ADM-2", ExecutionId: "2", TargetExecutionId: "t3", EntityGuid: "g1"})
+	tagger.track(&types.EventIngest{EventType: types.EventTypeAttackEnded, ExperimentKey: "ADM-1", ExecutionId: "1", TargetExecutionId: "t1", EntityGuid: "g1"})
+	tagger.track(&types.EventIngest{EventType: types.EventTypeAttackEnded, ExperimentKey: "ADM-1", ExecutionId: "1", TargetExecutionId: "t2", EntityGuid: "g1"})
+	tagger.track(&types.EventIngest{EventType: types.EventTypeExperimentEnded, ExperimentKey: "ADM-2", ExecutionId: "2"})
+	tagger.apply()
+
+	assert.Equal(t, []string{
+		"add g1 steadybit.attack.expires=<expires>",
+		"add g1 steadybit.attack=ADM-1",
+		"add g1 steadybit.attack=ADM-2",
+		"delete g1 steadybit.attack=ADM-1",
+		"delete g1 steadybit.attack,steadybit.attack.expires",
+	}, api.calls)
+	assert.Empty(t, tagger.attacks)
+}
+
+// The tags must have a valid expiry at all times, or another instance may remove them as stale.
+func Test_entityTagger_addsNewExpiryBeforeRemovingThePreviousOne(t *testing.T) {
+	now := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	api := &entityTaggingApiMock{}
+	tagger := newEntityTagger(api, 100)
+	tagger.attacks["g1"] = map[string]entityAttack{"attack/t1": {experimentKey: "ADM-1", executionId: "1"}}
+
+	tagger.extendTags(context.Background(), now)
+	tagger.extendTags(context.Background(), now.Add(5*time.Minute))
+
+	assert.Equal(t, []string{
+		"add g1 steadybit.attack.expires=<expires>",
+		"add g1 steadybit.attack.expires=<expires>",
+		"delete g1 steadybit.attack.expires=2021-01-01T00:15:00Z",
+	}, api.calls)
+	assert.Equal(t, "2021-01-01T00:20:00Z", tagger.expiries["g1"])
+}
+
+func Test_entityTagger_removesStaleTags(t *testing.T) {
+	now := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	api := &entityTaggingApiMock{entities: []types.GraphQlResponseEntities{
+		{Guid: "stale", Tags: []types.GraphQlResponseTags{{Key: attackTagKey, Values: []string{"ADM-1"}}, {Key: attackExpiresTagKey, Values: []string{now.Add(-time.Minute).Format(time.RFC3339)}}}},
+		{Guid: "other-instance", Tags: []types.GraphQlResponseTags{{Key: attackTagKey, Values: []string{"ADM-2"}}, {Key: attackExpiresTagKey, Values: []string{now.Add(time.Minute).Format(time.RFC3339)}}}},
+		{Guid: "without-expiry", Tags: []types.GraphQlResponseTags{{Key: attackTagKey, Values: []string{"ADM-3"}}}},
+		{Guid: "attacked", Tags: []types.GraphQlResponseTags{{Key: attackTagKey, Values: []string{"ADM-4"}}}},
+	}}
+	tagger := newEntityTagger(api, 100)
+	tagger.attacks["attacked"] = map[string]entityAttack{"attack/t1": {experimentKey: "ADM-4", executionId: "4"}}
+
+	tagger.removeStaleTags(context.Background(), now)
+
+	assert.Equal(t, []string{
+		"delete stale steadybit.attack,steadybit.attack.expires",
+		"delete without-expiry steadybit.attack,steadybit.attack.expires",
+	}, api.calls)
+}
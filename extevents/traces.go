@@ -0,0 +1,182 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2022 Steadybit GmbH
+
+package extevents
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/steadybit/extension-newrelic/types"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+// traceServiceName is the service the spans of experiment executions belong to.
+const traceServiceName = "steadybit"
+
+const traceScopeName = "github.com/steadybit/extension-newrelic/extevents"
+
+type PostTracesApi interface {
+	PostTraces(ctx context.Context, traces *tracepb.TracesData) error
+}
+
+// traceExporter exports experiment executions as traces: a root span for the experiment with
+// a child span per step and, below an attack step, a span per attacked target. Spans are
+// created once they ended, from all events, sent to New Relic or not. Their ids are derived
+// from the execution, step and target ids, so spans find their parents without keeping any
+// state.
+type traceExporter struct {
+	*batcher[*tracepb.Span]
+}
+
+func newTraceExporter(api PostTracesApi, size int, batchSize int, flushInterval time.Duration) *traceExporter {
+	return &traceExporter{newBatcher("experiment spans", size, batchSize, flushInterval, func(ctx context.Context, spans []*tracepb.Span) error {
+		return api.PostTraces(ctx, tracesData(spans))
+	})}
+}
+
+// track exports the span ended by an event, if any.
+func (e *traceExporter) track(newRelicEvent *types.EventIngest) {
+	if span := eventSpan(newRelicEvent); span != nil {
+		e.add(span)
+	}
+}
+
+func eventSpan(newRelicEvent *types.EventIngest) *tracepb.Span {
+	execution := []string{newRelicEvent.ExperimentKey, newRelicEvent.ExecutionId}
+	span := &tracepb.Span{
+		TraceId:           traceId(execution...),
+		Kind:              tracepb.Span_SPAN_KIND_INTERNAL,
+		StartTimeUnixNano: spanTime(newRelicEvent.StartedTimestamp, newRelicEvent.Timestamp),
+		EndTimeUnixNano:   spanTime(newRelicEvent.EndedTimestamp, newRelicEvent.Timestamp),
+		Attributes:        spanAttributes(newRelicEvent),
+		Status:            spanStatus(newRelicEvent),
+	}
+	experimentSpanId := spanId(append(execution, "experiment")...)
+
+	switch newRelicEvent.EventType {
+	case types.EventTypeExperimentEnded:
+		span.SpanId = experimentSpanId
+		span.Name = fmt.Sprintf("experiment %s", firstNonEmpty(newRelicEvent.ExperimentName, newRelicEvent.ExperimentKey))
+	case types.EventTypeStepEnded:
+		span.SpanId = spanId(newRelicEvent.StepExecutionId)
+		span.ParentSpanId = experimentSpanId
+		span.Name = strings.TrimSpace(fmt.Sprintf("%s %s", newRelicEvent.StepKind, firstNonEmpty(newRelicEvent.ActionCustomLabel, newRelicEvent.ActionName, newRelicEvent.ActionId)))
+	case types.EventTypeAttackEnded:
+		span.SpanId = spanId(firstNonEmpty(newRelicEvent.TargetExecutionId, newRelicEvent.StepExecutionId+"/"+newRelicEvent.Target))
+		span.ParentSpanId = spanId(newRelicEvent.StepExecutionId)
+		span.Name = fmt.Sprintf("attack %s", newRelicEvent.Target)
+	default:
+		return nil
+	}
+	return span
+}
+
+func tracesData(spans []*tracepb.Span) *tracepb.TracesData {
+	return &tracepb.TracesData{
+		ResourceSpans: []*tracepb.ResourceSpans{{
+			Resource: &resourcepb.Resource{
+				Attributes: []*commonpb.KeyValue{stringAttribute("service.name", traceServiceName)},
+			},
+			ScopeSpans: []*tracepb.ScopeSpans{{
+				Scope: &commonpb.InstrumentationScope{Name: traceScopeName},
+				Spans: spans,
+			}},
+		}},
+	}
+}
+
+func traceId(parts ...string) []byte {
+	return hashId(16, parts...)
+}
+
+func spanId(parts ...string) []byte {
+	return hashId(8, parts...)
+}
+
+func hashId(length int, parts ...string) []byte {
+	hash := sha256.Sum256([]byte("steadybit:" + strings.Join(parts, ":")))
+	return hash[:length]
+}
+
+// spanTime converts epoch milliseconds to the epoch nanoseconds of a span, falling back to the
+// event's time.
+func spanTime(timestamp int64, fallback int64) uint64 {
+	if timestamp == 0 {
+		timestamp = fallback
+	}
+	if timestamp == 0 {
+		timestamp = time.Now().UnixMilli()
+	}
+	return uint64(time.UnixMilli(timestamp).UnixNano())
+}
+
+// spanAttributes are the attributes of the event, including the configured ones.
+func spanAttributes(newRelicEvent *types.EventIngest) []*commonpb.KeyValue {
+	fields := eventFields(newRelicEvent)
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	attributes := make([]*commonpb.KeyValue, 0, len(keys))
+	for _, key := range keys {
+		switch value := fields[key].(type) {
+		case string:
+			attributes = append(attributes, stringAttribute(key, value))
+		case float64:
+			if value == math.Trunc(value) {
+				attributes = append(attributes, &commonpb.KeyValue{Key: key, Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: int64(value)}}})
+			} else {
+				attributes = append(attributes, &commonpb.KeyValue{Key: key, Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_DoubleValue{DoubleValue: value}}})
+			}
+		case bool:
+			attributes = append(attributes, &commonpb.KeyValue{Key: key, Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_BoolValue{BoolValue: value}}})
+		}
+	}
+	return attributes
+}
+
+// eventFields are the attributes of an event as sent to New Relic, including the configured ones.
+func eventFields(newRelicEvent *types.EventIngest) map[string]any {
+	b, err := json.Marshal(newRelicEvent)
+	if err != nil {
+		return nil
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return nil
+	}
+	return fields
+}
+
+func stringAttribute(key string, value string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{Key: key, Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: value}}}
+}
+
+// spanStatus marks the spans of failed and errored executions, steps and targets as errors.
+func spanStatus(newRelicEvent *types.EventIngest) *tracepb.Status {
+	state := strings.ToLower(firstNonEmpty(newRelicEvent.TargetState, newRelicEvent.State))
+	if state != "failed" && state != "errored" && newRelicEvent.FailureReason == "" {
+		return nil
+	}
+	return &tracepb.Status{Code: tracepb.Status_STATUS_CODE_ERROR, Message: newRelicEvent.FailureReason}
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
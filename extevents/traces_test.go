@@ -0,0 +1,80 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2022 Steadybit GmbH
+
+package extevents
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/steadybit/extension-newrelic/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+type postTracesApiMock struct {
+	mu     sync.Mutex
+	traces []*tracepb.TracesData
+}
+
+func (m *postTracesApiMock) PostTraces(_ context.Context, traces *tracepb.TracesData) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.traces = append(m.traces, traces)
+	return nil
+}
+
+func (m *postTracesApiMock) count() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.traces)
+}
+
+func Test_eventSpan_linksTargetStepAndExperiment(t *testing.T) {
+	experiment := eventSpan(&types.EventIngest{EventType: types.EventTypeExperimentEnded, ExperimentKey: "ADM-1", ExperimentName: "Checkout", ExecutionId: "42", State: "COMPLETED", StartedTimestamp: 1000, EndedTimestamp: 5000})
+	step := eventSpan(&types.EventIngest{EventType: types.EventTypeStepEnded, ExperimentKey: "ADM-1", ExecutionId: "42", StepExecutionId: "s1", StepKind: "attack", ActionName: "Stress CPU", State: "completed", StartedTimestamp: 2000, EndedTimestamp: 4000})
+	target := eventSpan(&types.EventIngest{EventType: types.EventTypeAttackEnded, ExperimentKey: "ADM-1", ExecutionId: "42", StepExecutionId: "s1", TargetExecutionId: "t1", Target: "checkout", TargetState: "failed", FailureReason: "Agent lost", Timestamp: 3000})
+
+	require.NotNil(t, experiment)
+	require.NotNil(t, step)
+	require.NotNil(t, target)
+	assert.Equal(t, "experiment Checkout", experiment.Name)
+	assert.Equal(t, "attack Stress CPU", step.Name)
+	assert.Equal(t, "attack checkout", target.Name)
+	assert.Equal(t, experiment.TraceId, step.TraceId)
+	assert.Equal(t, experiment.TraceId, target.TraceId)
+	assert.Empty(t, experiment.ParentSpanId)
+	assert.Equal(t, experiment.SpanId, step.ParentSpanId)
+	assert.Equal(t, step.SpanId, target.ParentSpanId)
+	assert.Equal(t, uint64(1000*time.Millisecond), experiment.StartTimeUnixNano)
+	assert.Equal(t, uint64(5000*time.Millisecond), experiment.EndTimeUnixNano)
+	assert.Equal(t, uint64(3000*time.Millisecond), target.StartTimeUnixNano)
+	assert.Nil(t, experiment.Status)
+	assert.Equal(t, tracepb.Status_STATUS_CODE_ERROR, target.Status.Code)
+	assert.Equal(t, "Agent lost", target.Status.Message)
+	assert.Contains(t, target.Attributes, stringAttribute("target", "checkout"))
+}
+
+func Test_eventSpan_ignoresStartEvents(t *testing.T) {
+	assert.Nil(t, eventSpan(&types.EventIngest{EventType: types.EventTypeExperimentStarted, ExecutionId: "42"}))
+	assert.Nil(t, eventSpan(&types.EventIngest{EventType: types.EventTypeAttackStarted, ExecutionId: "42"}))
+}
+
+func Test_traceExporter_sendsBatches(t *testing.T) {
+	api := &postTracesApiMock{}
+	exporter := newTraceExporter(api, 10, 2, time.Hour)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	exporter.start(ctx)
+
+	exporter.track(&types.EventIngest{EventType: types.EventTypeExperimentEnded, ExperimentKey: "ADM-1", ExecutionId: "1"})
+	exporter.track(&types.EventIngest{EventType: types.EventTypeExperimentEnded, ExperimentKey: "ADM-1", ExecutionId: "2"})
+
+	assert.Eventually(t, func() bool { return api.count() == 1 }, time.Second, 10*time.Millisecond)
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	assert.Len(t, api.traces[0].ResourceSpans[0].ScopeSpans[0].Spans, 2)
+}
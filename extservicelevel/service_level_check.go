@@ -0,0 +1,305 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2022 Steadybit GmbH
+
+package extservicelevel
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/steadybit/action-kit/go/action_kit_api/v2"
+	"github.com/steadybit/action-kit/go/action_kit_sdk"
+	extension_kit "github.com/steadybit/extension-kit"
+	"github.com/steadybit/extension-kit/extbuild"
+	"github.com/steadybit/extension-kit/extutil"
+	"github.com/steadybit/extension-newrelic/config"
+)
+
+type ServiceLevelCheckAction struct{}
+
+// Make sure action implements all required interfaces
+var (
+	_ action_kit_sdk.Action[ServiceLevelCheckState]           = (*ServiceLevelCheckAction)(nil)
+	_ action_kit_sdk.ActionWithStatus[ServiceLevelCheckState] = (*ServiceLevelCheckAction)(nil)
+)
+
+type ServiceLevelCheckState struct {
+	Start                 time.Time
+	End                   time.Time
+	Target                action_kit_api.Target
+	AccountId             int64
+	Objective             float64
+	BurnRateLimit         *float64
+	ConditionCheckMode    string
+	ConditionCheckSuccess bool
+}
+
+// serviceLevelNrql sums up the events New Relic records for a service level indicator. An
+// indicator defines either good or bad events, the other sum is null.
+const serviceLevelNrql = "SELECT sum(newrelic.sli.valid) AS 'valid', sum(newrelic.sli.good) AS 'good', sum(newrelic.sli.bad) AS 'bad' " +
+	"FROM Metric WHERE sli.guid = %s SINCE %d UNTIL %d"
+
+func NewServiceLevelCheckAction() action_kit_sdk.Action[ServiceLevelCheckState] {
+	return &ServiceLevelCheckAction{}
+}
+
+func (m *ServiceLevelCheckAction) NewEmptyState() ServiceLevelCheckState {
+	return ServiceLevelCheckState{}
+}
+
+func (m *ServiceLevelCheckAction) Describe() action_kit_api.ActionDescription {
+	return action_kit_api.ActionDescription{
+		Id:          ServiceLevelCheckActionId,
+		Label:       "Service Level Check",
+		Description: "Checks the compliance and the error budget burn rate of a service level during the step.",
+		Version:     extbuild.GetSemverVersionStringOrUnknown(),
+		Icon:        new(serviceLevelCheckActionIcon),
+		TargetSelection: new(action_kit_api.TargetSelection{
+			TargetType:          ServiceLevelTargetId,
+			QuantityRestriction: extutil.Ptr(action_kit_api.QuantityRestrictionAll),
+			SelectionTemplates: new([]action_kit_api.TargetSelectionTemplate{
+				{
+					Label: "service level name",
+					Query: "new-relic.service-level.name=\"\"",
+				},
+			}),
+		}),
+		Technology: new("New Relic"),
+
+		Kind:        action_kit_api.Check,
+		TimeControl: action_kit_api.TimeControlInternal,
+		Parameters: []action_kit_api.ActionParameter{
+			{
+				Name:         "duration",
+				Label:        "Duration",
+				Description:  new(""),
+				Type:         action_kit_api.ActionParameterTypeDuration,
+				DefaultValue: new("30s"),
+				Order:        new(1),
+				Required:     new(true),
+			},
+			{
+				Name:        "burnRateLimit",
+				Label:       "Maximum Burn Rate",
+				Description: new("The maximum error budget burn rate, as a multiple of the rate that would exactly use up the error budget within the service level's time window. Decimals like 1.5 are allowed. Leave empty to only check the compliance."),
+				Type:        action_kit_api.ActionParameterTypeString,
+				Order:       new(2),
+				Required:    new(false),
+			},
+			{
+				Name:         "conditionCheckMode",
+				Label:        "Condition Check Mode",
+				Description:  new("Should the step succeed if the condition is met at least once or all the time?"),
+				Type:         action_kit_api.ActionParameterTypeString,
+				DefaultValue: new(conditionCheckModeAllTheTime),
+				Options: new([]action_kit_api.ParameterOption{
+					action_kit_api.ExplicitParameterOption{
+						Label: "All the time",
+						Value: conditionCheckModeAllTheTime,
+					},
+					action_kit_api.ExplicitParameterOption{
+						Label: "At least once",
+						Value: conditionCheckModeAtLeastOnce,
+					},
+				}),
+				Required: new(true),
+				Order:    new(3),
+			},
+		},
+		Widgets: new([]action_kit_api.Widget{
+			action_kit_api.StateOverTimeWidget{
+				Type:  action_kit_api.ComSteadybitWidgetStateOverTime,
+				Title: "New Relic Service Level",
+				Identity: action_kit_api.StateOverTimeWidgetIdentityConfig{
+					From: "newrelic.service-level-guid",
+				},
+				Label: action_kit_api.StateOverTimeWidgetLabelConfig{
+					From: "title",
+				},
+				State: action_kit_api.StateOverTimeWidgetStateConfig{
+					From: "state",
+				},
+				Tooltip: action_kit_api.StateOverTimeWidgetTooltipConfig{
+					From: "tooltip",
+				},
+				Value: new(action_kit_api.StateOverTimeWidgetValueConfig{
+					Hide: new(true),
+				}),
+			},
+		}),
+		Prepare: action_kit_api.MutatingEndpointReference{},
+		Start:   action_kit_api.MutatingEndpointReference{},
+		Status: new(action_kit_api.MutatingEndpointReferenceWithCallInterval{
+			CallInterval: new("10s"),
+		}),
+	}
+}
+
+func (m *ServiceLevelCheckAction) Prepare(_ context.Context, state *ServiceLevelCheckState, request action_kit_api.PrepareActionRequestBody) (*action_kit_api.PrepareResult, error) {
+	duration := request.Config["duration"].(float64)
+	state.Start = time.Now()
+	state.End = state.Start.Add(time.Millisecond * time.Duration(duration))
+	state.Target = *request.Target
+	state.AccountId = extutil.ToInt64(request.Target.Attributes["new-relic.service-level.account"][0])
+	if objective, ok := request.Target.Attributes["new-relic.service-level.objective"]; ok && len(objective) > 0 {
+		if _, err := fmt.Sscanf(objective[0], "%g", &state.Objective); err != nil {
+			return nil, extension_kit.ToError("Failed to parse the service level objective.", err)
+		}
+	}
+	burnRateLimit, err := parseBurnRateLimit(request.Config["burnRateLimit"])
+	if err != nil {
+		return nil, err
+	}
+	state.BurnRateLimit = burnRateLimit
+	if request.Config["conditionCheckMode"] != nil {
+		state.ConditionCheckMode = fmt.Sprintf("%v", request.Config["conditionCheckMode"])
+	}
+	return nil, nil
+}
+
+// parseBurnRateLimit parses the optional burn rate limit, which may be a decimal.
+func parseBurnRateLimit(value any) (*float64, error) {
+	if number, isNumber := value.(float64); isNumber {
+		return &number, nil
+	}
+	text := strings.TrimSpace(extutil.ToString(value))
+	if text == "" {
+		return nil, nil
+	}
+	limit, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return nil, extension_kit.ToError(fmt.Sprintf("The burn rate limit '%s' is not a number.", text), err)
+	}
+	return &limit, nil
+}
+
+func (m *ServiceLevelCheckAction) Start(ctx context.Context, state *ServiceLevelCheckState) (*action_kit_api.StartResult, error) {
+	statusResult, err := ServiceLevelCheckStatus(ctx, state, &config.Config)
+	if statusResult == nil {
+		return nil, err
+	}
+	startResult := action_kit_api.StartResult{
+		Artifacts: statusResult.Artifacts,
+		Error:     statusResult.Error,
+		Messages:  statusResult.Messages,
+		Metrics:   statusResult.Metrics,
+	}
+	return &startResult, err
+}
+
+func (m *ServiceLevelCheckAction) Status(ctx context.Context, state *ServiceLevelCheckState) (*action_kit_api.StatusResult, error) {
+	return ServiceLevelCheckStatus(ctx, state, &config.Config)
+}
+
+type NrqlApi interface {
+	QueryNrql(ctx context.Context, accountId int64, query string) ([]map[string]any, error)
+}
+
+func ServiceLevelCheckStatus(ctx context.Context, state *ServiceLevelCheckState, api NrqlApi) (*action_kit_api.StatusResult, error) {
+	now := time.Now()
+	guid := state.Target.Attributes["new-relic.service-level.guid"][0]
+	results, err := api.QueryNrql(ctx, state.AccountId, fmt.Sprintf(serviceLevelNrql, config.NrqlString(guid), state.Start.UnixMilli(), now.UnixMilli()))
+	if err != nil {
+		return nil, extension_kit.ToError("Failed to get service level events from New Relic.", err)
+	}
+
+	completed := now.After(state.End)
+	compliance, hasData := computeCompliance(results)
+	violations := make([]string, 0)
+	var burnRate float64
+	if hasData {
+		burnRate = computeBurnRate(compliance, state.Objective)
+		if compliance < state.Objective {
+			violations = append(violations, fmt.Sprintf("Compliance is %.2f%%, below the objective of %.2f%%", compliance, state.Objective))
+		}
+		if state.BurnRateLimit != nil && burnRate > *state.BurnRateLimit {
+			violations = append(violations, fmt.Sprintf("Error budget burn rate is %.1fx, above the limit of %.1fx", burnRate, *state.BurnRateLimit))
+		}
+	}
+
+	var checkError *action_kit_api.ActionKitError
+	if state.ConditionCheckMode == conditionCheckModeAllTheTime {
+		if len(violations) > 0 {
+			checkError = new(action_kit_api.ActionKitError{
+				Title:  fmt.Sprintf("%s: %s", serviceLevelName(state.Target), strings.Join(violations, ", ")),
+				Status: extutil.Ptr(action_kit_api.Failed),
+			})
+		}
+	} else if state.ConditionCheckMode == conditionCheckModeAtLeastOnce {
+		if hasData && len(violations) == 0 {
+			state.ConditionCheckSuccess = true
+		}
+		if completed && !state.ConditionCheckSuccess {
+			checkError = new(action_kit_api.ActionKitError{
+				Title:  fmt.Sprintf("%s: Service level was never met.", serviceLevelName(state.Target)),
+				Status: extutil.Ptr(action_kit_api.Failed),
+			})
+		}
+	}
+
+	return &action_kit_api.StatusResult{
+		Completed: completed,
+		Error:     checkError,
+		Metrics:   new([]action_kit_api.Metric{toMetric(state, hasData, compliance, burnRate, len(violations) > 0, now)}),
+	}, nil
+}
+
+// computeCompliance returns the percentage of good events, or false if there were no valid
+// events at all.
+func computeCompliance(results []map[string]any) (float64, bool) {
+	if len(results) == 0 {
+		return 0, false
+	}
+	valid, ok := results[0]["valid"].(float64)
+	if !ok || valid <= 0 {
+		return 0, false
+	}
+	if bad, ok := results[0]["bad"].(float64); ok {
+		return math.Max(0, valid-bad) / valid * 100, true
+	}
+	good, _ := results[0]["good"].(float64)
+	return math.Min(good, valid) / valid * 100, true
+}
+
+// computeBurnRate returns how many times faster than sustainable the error budget is used
+// up. A burn rate of 1 uses up exactly the error budget within the objective's time window.
+func computeBurnRate(compliance float64, objective float64) float64 {
+	errorBudget := 100 - objective
+	if errorBudget <= 0 {
+		if compliance < 100 {
+			return math.Inf(1)
+		}
+		return 0
+	}
+	return (100 - compliance) / errorBudget
+}
+
+func serviceLevelName(target action_kit_api.Target) string {
+	return target.Attributes["new-relic.service-level.name"][0]
+}
+
+func toMetric(state *ServiceLevelCheckState, hasData bool, compliance float64, burnRate float64, violated bool, now time.Time) action_kit_api.Metric {
+	metricState := "success"
+	tooltip := fmt.Sprintf("Compliance: %.2f%%\nObjective: %.2f%%\nBurn rate: %.1fx", compliance, state.Objective, burnRate)
+	if !hasData {
+		metricState = "info"
+		tooltip = "No events"
+	} else if violated {
+		metricState = "danger"
+	}
+	return action_kit_api.Metric{
+		Name: new("new_relic_service_level"),
+		Metric: map[string]string{
+			"newrelic.service-level-guid": state.Target.Attributes["new-relic.service-level.guid"][0],
+			"title":                       serviceLevelName(state.Target),
+			"state":                       metricState,
+			"tooltip":                     tooltip,
+		},
+		Timestamp: now,
+		Value:     0,
+	}
+}
@@ -0,0 +1,117 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2022 Steadybit GmbH
+
+package extservicelevel
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/steadybit/action-kit/go/action_kit_api/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type nrqlApiMock struct {
+	results []map[string]any
+	queries []string
+}
+
+func (m *nrqlApiMock) QueryNrql(_ context.Context, _ int64, query string) ([]map[string]any, error) {
+	m.queries = append(m.queries, query)
+	return m.results, nil
+}
+
+func newServiceLevelState(burnRateLimit *float64) *ServiceLevelCheckState {
+	return &ServiceLevelCheckState{
+		Start: time.Now(),
+		End:   time.Now().Add(time.Minute),
+		Target: action_kit_api.Target{
+			Attributes: map[string][]string{
+				"new-relic.service-level.name": {"Checkout latency"},
+				"new-relic.service-level.guid": {"sli-1"},
+			},
+		},
+		AccountId:          1234,
+		Objective:          99,
+		BurnRateLimit:      burnRateLimit,
+		ConditionCheckMode: conditionCheckModeAllTheTime,
+	}
+}
+
+func TestComputeCompliance(t *testing.T) {
+	compliance, ok := computeCompliance([]map[string]any{{"valid": 200.0, "good": nil, "bad": 4.0}})
+	assert.True(t, ok)
+	assert.InDelta(t, 98.0, compliance, 0.001)
+
+	compliance, ok = computeCompliance([]map[string]any{{"valid": 200.0, "good": 199.0, "bad": nil}})
+	assert.True(t, ok)
+	assert.InDelta(t, 99.5, compliance, 0.001)
+
+	_, ok = computeCompliance([]map[string]any{{"valid": nil, "good": nil, "bad": nil}})
+	assert.False(t, ok)
+}
+
+func TestServiceLevelCheckFailsBelowObjective(t *testing.T) {
+	api := &nrqlApiMock{results: []map[string]any{{"valid": 100.0, "good": 97.0, "bad": nil}}}
+	state := newServiceLevelState(nil)
+
+	result, err := ServiceLevelCheckStatus(context.Background(), state, api)
+
+	require.NoError(t, err)
+	require.NotNil(t, result.Error)
+	assert.Equal(t, "Checkout latency: Compliance is 97.00%, below the objective of 99.00%", result.Error.Title)
+	assert.Contains(t, api.queries[0], "sli.guid = 'sli-1'")
+	assert.Equal(t, "danger", (*result.Metrics)[0].Metric["state"])
+}
+
+func TestServiceLevelCheckFailsAboveBurnRate(t *testing.T) {
+	// 99.5% compliance meets the objective, but burns the error budget at 0.5x.
+	api := &nrqlApiMock{results: []map[string]any{{"valid": 1000.0, "good": nil, "bad": 5.0}}}
+
+	result, err := ServiceLevelCheckStatus(context.Background(), newServiceLevelState(new(1.0)), api)
+	require.NoError(t, err)
+	assert.Nil(t, result.Error)
+
+	result, err = ServiceLevelCheckStatus(context.Background(), newServiceLevelState(new(0.0)), api)
+	require.NoError(t, err)
+	require.NotNil(t, result.Error)
+	assert.Equal(t, "Checkout latency: Error budget burn rate is 0.5x, above the limit of 0.0x", result.Error.Title)
+}
+
+func TestServiceLevelCheckFractionalBurnRate(t *testing.T) {
+	limit, err := parseBurnRateLimit("1.5")
+	require.NoError(t, err)
+	assert.Equal(t, new(1.5), limit)
+	limit, err = parseBurnRateLimit("")
+	require.NoError(t, err)
+	assert.Nil(t, limit)
+	_, err = parseBurnRateLimit("1,5")
+	assert.ErrorContains(t, err, "burn rate limit")
+
+	// A burn rate of 0.5x is below 0.75x, but above the limit if it were truncated to 0.
+	api := &nrqlApiMock{results: []map[string]any{{"valid": 1000.0, "good": nil, "bad": 5.0}}}
+	limit, err = parseBurnRateLimit("0.75")
+	require.NoError(t, err)
+	result, err := ServiceLevelCheckStatus(context.Background(), newServiceLevelState(limit), api)
+	require.NoError(t, err)
+	assert.Nil(t, result.Error)
+
+	limit, err = parseBurnRateLimit(" 0.4 ")
+	require.NoError(t, err)
+	result, err = ServiceLevelCheckStatus(context.Background(), newServiceLevelState(limit), api)
+	require.NoError(t, err)
+	require.NotNil(t, result.Error)
+	assert.Equal(t, "Checkout latency: Error budget burn rate is 0.5x, above the limit of 0.4x", result.Error.Title)
+}
+
+func TestServiceLevelCheckWithoutEvents(t *testing.T) {
+	api := &nrqlApiMock{results: []map[string]any{{"valid": nil, "good": nil, "bad": nil}}}
+
+	result, err := ServiceLevelCheckStatus(context.Background(), newServiceLevelState(nil), api)
+
+	require.NoError(t, err)
+	assert.Nil(t, result.Error)
+	assert.Equal(t, "info", (*result.Metrics)[0].Metric["state"])
+}
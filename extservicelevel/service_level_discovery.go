@@ -0,0 +1,168 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2022 Steadybit GmbH
+
+package extservicelevel
+
+import (
+	"context"
+	"fmt"
+	"github.com/rs/zerolog/log"
+	"github.com/steadybit/discovery-kit/go/discovery_kit_api"
+	"github.com/steadybit/discovery-kit/go/discovery_kit_sdk"
+	"github.com/steadybit/extension-kit/extbuild"
+	"github.com/steadybit/extension-newrelic/config"
+	"github.com/steadybit/extension-newrelic/types"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type serviceLevelDiscovery struct {
+}
+
+var (
+	_ discovery_kit_sdk.TargetDescriber    = (*serviceLevelDiscovery)(nil)
+	_ discovery_kit_sdk.AttributeDescriber = (*serviceLevelDiscovery)(nil)
+)
+
+func NewServiceLevelDiscovery() discovery_kit_sdk.TargetDiscovery {
+	discovery := &serviceLevelDiscovery{}
+	return discovery_kit_sdk.NewCachedTargetDiscovery(discovery,
+		discovery_kit_sdk.WithRefreshTargetsNow(),
+		discovery_kit_sdk.WithRefreshTargetsInterval(context.Background(), 5*time.Minute),
+	)
+}
+func (d *serviceLevelDiscovery) Describe() discovery_kit_api.DiscoveryDescription {
+	return discovery_kit_api.DiscoveryDescription{
+		Id: ServiceLevelTargetId,
+		Discover: discovery_kit_api.DescribingEndpointReferenceWithCallInterval{
+			CallInterval: new("5m"),
+		},
+	}
+}
+
+func (d *serviceLevelDiscovery) DescribeTarget() discovery_kit_api.TargetDescription {
+	return discovery_kit_api.TargetDescription{
+		Id:       ServiceLevelTargetId,
+		Label:    discovery_kit_api.PluralLabel{One: "New Relic Service Level", Other: "New Relic Service Levels"},
+		Category: new("monitoring"),
+		Version:  extbuild.GetSemverVersionStringOrUnknown(),
+		Icon:     new(serviceLevelIcon),
+		Table: discovery_kit_api.Table{
+			Columns: []discovery_kit_api.Column{
+				{Attribute: "new-relic.service-level.name"},
+				{Attribute: "new-relic.service-level.entity.name"},
+				{Attribute: "new-relic.service-level.objective"},
+				{Attribute: "new-relic.service-level.account"},
+			},
+			OrderBy: []discovery_kit_api.OrderBy{
+				{
+					Attribute: "new-relic.service-level.name",
+					Direction: "ASC",
+				},
+			},
+		},
+	}
+}
+
+func (d *serviceLevelDiscovery) DescribeAttributes() []discovery_kit_api.AttributeDescription {
+	return []discovery_kit_api.AttributeDescription{
+		{
+			Attribute: "new-relic.service-level.name",
+			Label: discovery_kit_api.PluralLabel{
+				One:   "New Relic Service Level Name",
+				Other: "New Relic Service Level Names",
+			},
+		},
+		{
+			Attribute: "new-relic.service-level.account",
+			Label: discovery_kit_api.PluralLabel{
+				One:   "New Relic Service Level Account",
+				Other: "New Relic Service Level Accounts",
+			},
+		},
+		{
+			Attribute: "new-relic.service-level.objective",
+			Label: discovery_kit_api.PluralLabel{
+				One:   "New Relic Service Level Objective",
+				Other: "New Relic Service Level Objectives",
+			},
+		},
+		{
+			Attribute: "new-relic.service-level.time-window",
+			Label: discovery_kit_api.PluralLabel{
+				One:   "New Relic Service Level Time Window",
+				Other: "New Relic Service Level Time Windows",
+			},
+		},
+		{
+			Attribute: "new-relic.service-level.entity.name",
+			Label: discovery_kit_api.PluralLabel{
+				One:   "New Relic Service Level Entity Name",
+				Other: "New Relic Service Level Entity Names",
+			},
+		},
+	}
+}
+
+func (d *serviceLevelDiscovery) DiscoverTargets(ctx context.Context) ([]discovery_kit_api.Target, error) {
+	return getAllServiceLevels(ctx, &config.Config), nil
+}
+
+type GetServiceLevelsApi interface {
+	GetAccountIds(ctx context.Context) ([]int64, error)
+	GetServiceLevels(ctx context.Context, accountId int64) ([]types.ServiceLevel, error)
+}
+
+func getAllServiceLevels(ctx context.Context, api GetServiceLevelsApi) []discovery_kit_api.Target {
+	result := make([]discovery_kit_api.Target, 0, 100)
+
+	accounts, err := api.GetAccountIds(ctx)
+	if err != nil {
+		log.Err(err).Msgf("Failed to get accounts from New Relic.")
+		return result
+	}
+
+	for _, accountId := range accounts {
+		serviceLevels, err := api.GetServiceLevels(ctx, accountId)
+		if err != nil {
+			log.Err(err).Int64("accountId", accountId).Msgf("Failed to get service levels from New Relic.")
+			continue
+		}
+
+		for _, serviceLevel := range serviceLevels {
+			if len(serviceLevel.Indicator.Objectives) == 0 {
+				log.Debug().Str("guid", serviceLevel.Indicator.Guid).Msg("Service level has no objective - ignoring it.")
+				continue
+			}
+			result = append(result, toTarget(serviceLevel))
+		}
+	}
+
+	return result
+}
+
+func toTarget(serviceLevel types.ServiceLevel) discovery_kit_api.Target {
+	label := fmt.Sprintf("%s (%s)", serviceLevel.Indicator.Name, serviceLevel.EntityName)
+	// Indicators may define several objectives for different time windows; the first one is
+	// the one New Relic shows in the service level list.
+	objective := serviceLevel.Indicator.Objectives[0]
+
+	attributes := make(map[string][]string)
+	attributes["new-relic.service-level.name"] = []string{serviceLevel.Indicator.Name}
+	attributes["new-relic.service-level.guid"] = []string{serviceLevel.Indicator.Guid}
+	attributes["new-relic.service-level.account"] = []string{fmt.Sprintf("%d", serviceLevel.AccountId)}
+	attributes["new-relic.service-level.objective"] = []string{strconv.FormatFloat(objective.Target, 'f', -1, 64)}
+	if objective.TimeWindow != nil && objective.TimeWindow.Rolling != nil {
+		attributes["new-relic.service-level.time-window"] = []string{fmt.Sprintf("%d %s", objective.TimeWindow.Rolling.Count, strings.ToLower(objective.TimeWindow.Rolling.Unit))}
+	}
+	attributes["new-relic.service-level.entity.guid"] = []string{serviceLevel.EntityGuid}
+	attributes["new-relic.service-level.entity.name"] = []string{serviceLevel.EntityName}
+
+	return discovery_kit_api.Target{
+		Id:         serviceLevel.Indicator.Guid,
+		Label:      label,
+		TargetType: ServiceLevelTargetId,
+		Attributes: attributes,
+	}
+}
@@ -0,0 +1,180 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2022 Steadybit GmbH
+
+package extsynthetic
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/steadybit/action-kit/go/action_kit_api/v2"
+	"github.com/steadybit/action-kit/go/action_kit_sdk"
+	extension_kit "github.com/steadybit/extension-kit"
+	"github.com/steadybit/extension-kit/extbuild"
+	"github.com/steadybit/extension-kit/extutil"
+	"github.com/steadybit/extension-newrelic/config"
+	"github.com/steadybit/extension-newrelic/types"
+)
+
+type PauseSyntheticMonitorAction struct{}
+
+// Make sure action implements all required interfaces
+var (
+	_ action_kit_sdk.Action[PauseSyntheticMonitorState]         = (*PauseSyntheticMonitorAction)(nil)
+	_ action_kit_sdk.ActionWithStop[PauseSyntheticMonitorState] = (*PauseSyntheticMonitorAction)(nil)
+)
+
+type PauseSyntheticMonitorState struct {
+	Guid   string
+	Name   string
+	Status string
+	// Monitor holds the monitor as found on start, including its original status. It is only
+	// set if the action changed the status, and cleared once the status is restored.
+	Monitor *types.GraphQlResponseEntities
+}
+
+const (
+	monitorStatusEnabled  = "ENABLED"
+	monitorStatusDisabled = "DISABLED"
+	monitorStatusMuted    = "MUTED"
+)
+
+func NewPauseSyntheticMonitorAction() action_kit_sdk.Action[PauseSyntheticMonitorState] {
+	return &PauseSyntheticMonitorAction{}
+}
+
+func (m *PauseSyntheticMonitorAction) NewEmptyState() PauseSyntheticMonitorState {
+	return PauseSyntheticMonitorState{}
+}
+
+func (m *PauseSyntheticMonitorAction) Describe() action_kit_api.ActionDescription {
+	return action_kit_api.ActionDescription{
+		Id:          PauseSyntheticMonitorActionId,
+		Label:       "Pause Synthetic Monitor",
+		Description: "Disable or mute a synthetic monitor for a given duration, so failing checks don't page anyone.",
+		Version:     extbuild.GetSemverVersionStringOrUnknown(),
+		Icon:        new(pauseSyntheticMonitorIcon),
+		TargetSelection: new(action_kit_api.TargetSelection{
+			TargetType:          SyntheticMonitorTargetId,
+			QuantityRestriction: extutil.Ptr(action_kit_api.QuantityRestrictionAll),
+			SelectionTemplates: new([]action_kit_api.TargetSelectionTemplate{
+				{
+					Label: "synthetic monitor name",
+					Query: "new-relic.synthetic-monitor.name=\"\"",
+				},
+			}),
+		}),
+		Technology: new("New Relic"),
+
+		Kind:        action_kit_api.Other,
+		TimeControl: action_kit_api.TimeControlExternal,
+		Parameters: []action_kit_api.ActionParameter{
+			{
+				Name:         "duration",
+				Label:        "Duration",
+				Description:  new(""),
+				Type:         action_kit_api.ActionParameterTypeDuration,
+				DefaultValue: new("30s"),
+				Order:        new(1),
+				Required:     new(true),
+			},
+			{
+				Name:         "status",
+				Label:        "Status",
+				Description:  new("Disabled monitors don't run any checks, muted monitors keep checking without alerting."),
+				Type:         action_kit_api.ActionParameterTypeString,
+				DefaultValue: new(monitorStatusDisabled),
+				Options: new([]action_kit_api.ParameterOption{
+					action_kit_api.ExplicitParameterOption{
+						Label: "Disabled",
+						Value: monitorStatusDisabled,
+					},
+					action_kit_api.ExplicitParameterOption{
+						Label: "Muted",
+						Value: monitorStatusMuted,
+					},
+				}),
+				Order:    new(2),
+				Required: new(true),
+			},
+		},
+		Stop: new(action_kit_api.MutatingEndpointReference{}),
+	}
+}
+
+func (m *PauseSyntheticMonitorAction) Prepare(_ context.Context, state *PauseSyntheticMonitorState, request action_kit_api.PrepareActionRequestBody) (*action_kit_api.PrepareResult, error) {
+	state.Guid = request.Target.Attributes["new-relic.synthetic-monitor.guid"][0]
+	state.Name = request.Target.Attributes["new-relic.synthetic-monitor.name"][0]
+	state.Status = monitorStatusDisabled
+	if request.Config["status"] != nil {
+		state.Status = fmt.Sprintf("%v", request.Config["status"])
+	}
+	if state.Status != monitorStatusDisabled && state.Status != monitorStatusMuted {
+		return nil, extension_kit.ToError(fmt.Sprintf("Unsupported status %s.", state.Status), nil)
+	}
+	return nil, nil
+}
+
+func (m *PauseSyntheticMonitorAction) Start(ctx context.Context, state *PauseSyntheticMonitorState) (*action_kit_api.StartResult, error) {
+	return PauseSyntheticMonitorStart(ctx, state, &config.Config)
+}
+
+func (m *PauseSyntheticMonitorAction) Stop(ctx context.Context, state *PauseSyntheticMonitorState) (*action_kit_api.StopResult, error) {
+	return PauseSyntheticMonitorStop(ctx, state, &config.Config)
+}
+
+type SyntheticMonitorStatusApi interface {
+	GetSyntheticMonitor(ctx context.Context, guid string) (*types.GraphQlResponseEntities, error)
+	SetSyntheticMonitorStatus(ctx context.Context, monitor types.GraphQlResponseEntities, status string) error
+}
+
+func PauseSyntheticMonitorStart(ctx context.Context, state *PauseSyntheticMonitorState, api SyntheticMonitorStatusApi) (*action_kit_api.StartResult, error) {
+	monitor, err := api.GetSyntheticMonitor(ctx, state.Guid)
+	if err != nil {
+		return nil, extension_kit.ToError(fmt.Sprintf("Failed to get synthetic monitor %s from New Relic.", state.Name), err)
+	}
+
+	// Only running monitors are paused. Disabled, paused or faulty monitors don't run anyway.
+	status := originalStatus(*monitor)
+	if (status != monitorStatusEnabled && status != monitorStatusMuted) || status == state.Status {
+		return &action_kit_api.StartResult{
+			Messages: &action_kit_api.Messages{
+				action_kit_api.Message{Level: extutil.Ptr(action_kit_api.Info), Message: fmt.Sprintf("Monitor %s is %s already, leaving it untouched.", state.Name, status)},
+			},
+		}, nil
+	}
+
+	if err := api.SetSyntheticMonitorStatus(ctx, *monitor, state.Status); err != nil {
+		return nil, extension_kit.ToError(fmt.Sprintf("Failed to set the status of synthetic monitor %s to %s.", state.Name, state.Status), err)
+	}
+	state.Monitor = monitor
+	return &action_kit_api.StartResult{
+		Messages: &action_kit_api.Messages{
+			action_kit_api.Message{Level: extutil.Ptr(action_kit_api.Info), Message: fmt.Sprintf("Monitor %s set from %s to %s.", state.Name, status, state.Status)},
+		},
+	}, nil
+}
+
+func PauseSyntheticMonitorStop(ctx context.Context, state *PauseSyntheticMonitorState, api SyntheticMonitorStatusApi) (*action_kit_api.StopResult, error) {
+	if state.Monitor == nil {
+		return nil, nil
+	}
+
+	status := originalStatus(*state.Monitor)
+	if err := api.SetSyntheticMonitorStatus(ctx, *state.Monitor, status); err != nil {
+		return nil, extension_kit.ToError(fmt.Sprintf("Failed to restore the status of synthetic monitor %s to %s.", state.Name, status), err)
+	}
+	state.Monitor = nil
+	return &action_kit_api.StopResult{
+		Messages: &action_kit_api.Messages{
+			action_kit_api.Message{Level: extutil.Ptr(action_kit_api.Info), Message: fmt.Sprintf("Monitor %s restored to %s.", state.Name, status)},
+		},
+	}, nil
+}
+
+func originalStatus(monitor types.GraphQlResponseEntities) string {
+	if monitor.MonitorSummary == nil {
+		return ""
+	}
+	return monitor.MonitorSummary.Status
+}
@@ -0,0 +1,74 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2022 Steadybit GmbH
+
+package extsynthetic
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/steadybit/extension-newrelic/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type syntheticMonitorStatusApiMock struct {
+	status   string
+	updates  []string
+	failNext bool
+}
+
+func (m *syntheticMonitorStatusApiMock) GetSyntheticMonitor(_ context.Context, guid string) (*types.GraphQlResponseEntities, error) {
+	return &types.GraphQlResponseEntities{
+		Guid:           guid,
+		MonitorType:    "SIMPLE",
+		MonitorSummary: &types.SyntheticMonitorSummary{Status: m.status},
+	}, nil
+}
+
+func (m *syntheticMonitorStatusApiMock) SetSyntheticMonitorStatus(_ context.Context, _ types.GraphQlResponseEntities, status string) error {
+	if m.failNext {
+		m.failNext = false
+		return errors.New("boom")
+	}
+	m.updates = append(m.updates, status)
+	m.status = status
+	return nil
+}
+
+func TestPauseSyntheticMonitorRestoresOriginalStatus(t *testing.T) {
+	api := &syntheticMonitorStatusApiMock{status: monitorStatusMuted}
+	state := &PauseSyntheticMonitorState{Guid: "monitor-1", Name: "Checkout ping", Status: monitorStatusDisabled}
+
+	_, err := PauseSyntheticMonitorStart(context.Background(), state, api)
+	require.NoError(t, err)
+	assert.Equal(t, monitorStatusDisabled, api.status)
+
+	api.failNext = true
+	_, err = PauseSyntheticMonitorStop(context.Background(), state, api)
+	require.Error(t, err)
+	require.NotNil(t, state.Monitor)
+
+	_, err = PauseSyntheticMonitorStop(context.Background(), state, api)
+	require.NoError(t, err)
+	assert.Equal(t, monitorStatusMuted, api.status)
+	assert.Nil(t, state.Monitor)
+
+	_, err = PauseSyntheticMonitorStop(context.Background(), state, api)
+	require.NoError(t, err)
+	assert.Equal(t, []string{monitorStatusDisabled, monitorStatusMuted}, api.updates)
+}
+
+func TestPauseSyntheticMonitorLeavesDisabledMonitorUntouched(t *testing.T) {
+	api := &syntheticMonitorStatusApiMock{status: monitorStatusDisabled}
+	state := &PauseSyntheticMonitorState{Guid: "monitor-1", Name: "Checkout ping", Status: monitorStatusMuted}
+
+	result, err := PauseSyntheticMonitorStart(context.Background(), state, api)
+	require.NoError(t, err)
+	assert.Equal(t, "Monitor Checkout ping is DISABLED already, leaving it untouched.", (*result.Messages)[0].Message)
+
+	_, err = PauseSyntheticMonitorStop(context.Background(), state, api)
+	require.NoError(t, err)
+	assert.Empty(t, api.updates)
+}
@@ -0,0 +1,287 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2022 Steadybit GmbH
+
+package extsynthetic
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/steadybit/action-kit/go/action_kit_api/v2"
+	"github.com/steadybit/action-kit/go/action_kit_sdk"
+	extension_kit "github.com/steadybit/extension-kit"
+	"github.com/steadybit/extension-kit/extbuild"
+	"github.com/steadybit/extension-kit/extutil"
+	"github.com/steadybit/extension-newrelic/config"
+	"github.com/steadybit/extension-newrelic/types"
+)
+
+type RunSyntheticMonitorAction struct{}
+
+// Make sure action implements all required interfaces
+var (
+	_ action_kit_sdk.Action[RunSyntheticMonitorState]           = (*RunSyntheticMonitorAction)(nil)
+	_ action_kit_sdk.ActionWithStatus[RunSyntheticMonitorState] = (*RunSyntheticMonitorAction)(nil)
+)
+
+type RunSyntheticMonitorState struct {
+	End       time.Time
+	Target    action_kit_api.Target
+	AccountId int64
+	BatchName string
+	// Interval is the minimum time between the start of two runs.
+	Interval time.Duration
+	// BatchId is the id of the run in progress, if any.
+	BatchId string
+	NextRun time.Time
+	Runs    int
+	// Failures describes the failed runs.
+	Failures []string
+}
+
+const (
+	automatedTestInProgress = "IN_PROGRESS"
+	automatedTestPassed     = "PASSED"
+	automatedTestSuccess    = "SUCCESS"
+)
+
+// runGracePeriod is how long the last run is awaited after the duration. A run still in
+// progress then fails the step, so a stuck run doesn't keep it running.
+const runGracePeriod = 5 * time.Minute
+
+func NewRunSyntheticMonitorAction() action_kit_sdk.Action[RunSyntheticMonitorState] {
+	return &RunSyntheticMonitorAction{}
+}
+
+func (m *RunSyntheticMonitorAction) NewEmptyState() RunSyntheticMonitorState {
+	return RunSyntheticMonitorState{}
+}
+
+func (m *RunSyntheticMonitorAction) Describe() action_kit_api.ActionDescription {
+	return action_kit_api.ActionDescription{
+		Id:          RunSyntheticMonitorActionId,
+		Label:       "Run Synthetic Monitor",
+		Description: "Runs a synthetic monitor on demand, repeatedly during the step, and fails if a run fails.",
+		Version:     extbuild.GetSemverVersionStringOrUnknown(),
+		Icon:        new(runSyntheticMonitorIcon),
+		TargetSelection: new(action_kit_api.TargetSelection{
+			TargetType:          SyntheticMonitorTargetId,
+			QuantityRestriction: extutil.Ptr(action_kit_api.QuantityRestrictionAll),
+			SelectionTemplates: new([]action_kit_api.TargetSelectionTemplate{
+				{
+					Label: "synthetic monitor name",
+					Query: "new-relic.synthetic-monitor.name=\"\"",
+				},
+			}),
+		}),
+		Technology: new("New Relic"),
+
+		Kind:        action_kit_api.Check,
+		TimeControl: action_kit_api.TimeControlInternal,
+		Parameters: []action_kit_api.ActionParameter{
+			{
+				Name:         "duration",
+				Label:        "Duration",
+				Description:  new("No new runs are started after the duration, but the last run is awaited for up to 5 minutes."),
+				Type:         action_kit_api.ActionParameterTypeDuration,
+				DefaultValue: new("60s"),
+				Order:        new(1),
+				Required:     new(true),
+			},
+			{
+				Name:         "interval",
+				Label:        "Interval",
+				Description:  new("The minimum time between the start of two runs. A run starts only after the previous one finished."),
+				Type:         action_kit_api.ActionParameterTypeDuration,
+				DefaultValue: new("10s"),
+				Order:        new(2),
+				Required:     new(true),
+			},
+		},
+		Widgets: new([]action_kit_api.Widget{
+			action_kit_api.StateOverTimeWidget{
+				Type:  action_kit_api.ComSteadybitWidgetStateOverTime,
+				Title: "New Relic Synthetic Monitor Runs",
+				Identity: action_kit_api.StateOverTimeWidgetIdentityConfig{
+					From: "newrelic.synthetic-monitor-location",
+				},
+				Label: action_kit_api.StateOverTimeWidgetLabelConfig{
+					From: "title",
+				},
+				State: action_kit_api.StateOverTimeWidgetStateConfig{
+					From: "state",
+				},
+				Tooltip: action_kit_api.StateOverTimeWidgetTooltipConfig{
+					From: "tooltip",
+				},
+				Url: new(action_kit_api.StateOverTimeWidgetUrlConfig{
+					From: new("url"),
+				}),
+				Value: new(action_kit_api.StateOverTimeWidgetValueConfig{
+					Hide: new(true),
+				}),
+			},
+		}),
+		Prepare: action_kit_api.MutatingEndpointReference{},
+		Start:   action_kit_api.MutatingEndpointReference{},
+		Status: new(action_kit_api.MutatingEndpointReferenceWithCallInterval{
+			CallInterval: new("5s"),
+		}),
+	}
+}
+
+func (m *RunSyntheticMonitorAction) Prepare(_ context.Context, state *RunSyntheticMonitorState, request action_kit_api.PrepareActionRequestBody) (*action_kit_api.PrepareResult, error) {
+	duration := request.Config["duration"].(float64)
+	state.End = time.Now().Add(time.Millisecond * time.Duration(duration))
+	state.Target = *request.Target
+	state.AccountId = extutil.ToInt64(request.Target.Attributes["new-relic.synthetic-monitor.account"][0])
+	if request.Config["interval"] != nil {
+		state.Interval = time.Millisecond * time.Duration(extutil.ToInt64(request.Config["interval"]))
+	}
+	state.BatchName = "Steadybit"
+	if request.ExecutionContext != nil && request.ExecutionContext.ExperimentKey != nil && request.ExecutionContext.ExecutionId != nil {
+		state.BatchName = fmt.Sprintf("Steadybit %s (%d)", *request.ExecutionContext.ExperimentKey, *request.ExecutionContext.ExecutionId)
+	}
+	return nil, nil
+}
+
+func (m *RunSyntheticMonitorAction) Start(ctx context.Context, state *RunSyntheticMonitorState) (*action_kit_api.StartResult, error) {
+	statusResult, err := RunSyntheticMonitorStatus(ctx, state, &config.Config)
+	if statusResult == nil {
+		return nil, err
+	}
+	startResult := action_kit_api.StartResult{
+		Artifacts: statusResult.Artifacts,
+		Error:     statusResult.Error,
+		Messages:  statusResult.Messages,
+		Metrics:   statusResult.Metrics,
+	}
+	return &startResult, err
+}
+
+func (m *RunSyntheticMonitorAction) Status(ctx context.Context, state *RunSyntheticMonitorState) (*action_kit_api.StatusResult, error) {
+	return RunSyntheticMonitorStatus(ctx, state, &config.Config)
+}
+
+type SyntheticTestApi interface {
+	StartSyntheticTest(ctx context.Context, monitorGuid string, batchName string) (string, error)
+	GetSyntheticTestResult(ctx context.Context, accountId int64, batchId string) (*types.SyntheticsAutomatedTestResult, error)
+}
+
+// RunSyntheticMonitorStatus awaits the run in progress and starts the next one once the
+// interval passed. The step fails as soon as a run failed.
+func RunSyntheticMonitorStatus(ctx context.Context, state *RunSyntheticMonitorState, api SyntheticTestApi) (*action_kit_api.StatusResult, error) {
+	now := time.Now()
+	guid := state.Target.Attributes["new-relic.synthetic-monitor.guid"][0]
+	metrics := make([]action_kit_api.Metric, 0)
+
+	if state.BatchId != "" {
+		result, err := api.GetSyntheticTestResult(ctx, state.AccountId, state.BatchId)
+		if err != nil {
+			return nil, extension_kit.ToError(fmt.Sprintf("Failed to get the result of the run of synthetic monitor %s from New Relic.", monitorName(state.Target)), err)
+		}
+		metrics = append(metrics, toRunMetrics(state.Target, result, now)...)
+		if result.Status != automatedTestInProgress {
+			state.Runs++
+			if result.Status != automatedTestPassed {
+				state.Failures = append(state.Failures, runFailure(result))
+			}
+			state.BatchId = ""
+		} else if now.After(state.End.Add(runGracePeriod)) {
+			state.Failures = append(state.Failures, runTimeout(result))
+			state.BatchId = ""
+		}
+	}
+
+	if len(state.Failures) > 0 {
+		return &action_kit_api.StatusResult{
+			Completed: true,
+			Error: new(action_kit_api.ActionKitError{
+				Title:  fmt.Sprintf("%s: %s", monitorName(state.Target), strings.Join(state.Failures, ", ")),
+				Status: extutil.Ptr(action_kit_api.Failed),
+			}),
+			Metrics: new(metrics),
+		}, nil
+	}
+
+	if state.BatchId == "" && now.Before(state.End) && !now.Before(state.NextRun) {
+		batchId, err := api.StartSyntheticTest(ctx, guid, state.BatchName)
+		if err != nil {
+			return nil, extension_kit.ToError(fmt.Sprintf("Failed to run synthetic monitor %s in New Relic.", monitorName(state.Target)), err)
+		}
+		state.BatchId = batchId
+		state.NextRun = now.Add(state.Interval)
+	}
+
+	completed := state.BatchId == "" && now.After(state.End)
+	var messages *action_kit_api.Messages
+	if completed {
+		messages = &action_kit_api.Messages{
+			action_kit_api.Message{Level: extutil.Ptr(action_kit_api.Info), Message: fmt.Sprintf("Synthetic monitor %s passed %d runs.", monitorName(state.Target), state.Runs)},
+		}
+	}
+	return &action_kit_api.StatusResult{
+		Completed: completed,
+		Messages:  messages,
+		Metrics:   new(metrics),
+	}, nil
+}
+
+// runFailure describes a failed run by its failed locations.
+func runFailure(result *types.SyntheticsAutomatedTestResult) string {
+	locations := make([]string, 0, len(result.Tests))
+	for _, test := range result.Tests {
+		if test.Result != automatedTestSuccess {
+			locations = append(locations, fmt.Sprintf("%s %s", test.LocationLabel, test.Result))
+		}
+	}
+	if len(locations) == 0 {
+		return fmt.Sprintf("Run %s", result.Status)
+	}
+	return fmt.Sprintf("Run %s (%s)", result.Status, strings.Join(locations, ", "))
+}
+
+// runTimeout describes a run not finished within the grace period by its pending locations.
+func runTimeout(result *types.SyntheticsAutomatedTestResult) string {
+	locations := make([]string, 0, len(result.Tests))
+	for _, test := range result.Tests {
+		if test.Result == automatedTestInProgress {
+			locations = append(locations, test.LocationLabel)
+		}
+	}
+	if len(locations) == 0 {
+		return fmt.Sprintf("Run not finished %s after the end of the step", runGracePeriod)
+	}
+	return fmt.Sprintf("Run not finished %s after the end of the step (pending in %s)", runGracePeriod, strings.Join(locations, ", "))
+}
+
+func toRunMetrics(target action_kit_api.Target, result *types.SyntheticsAutomatedTestResult, now time.Time) []action_kit_api.Metric {
+	metrics := make([]action_kit_api.Metric, 0, len(result.Tests))
+	for _, test := range result.Tests {
+		metricState := "danger"
+		if test.Result == automatedTestSuccess {
+			metricState = "success"
+		} else if test.Result == automatedTestInProgress {
+			metricState = "info"
+		}
+		tooltip := fmt.Sprintf("Result: %s", test.Result)
+		if test.Duration != nil {
+			tooltip = fmt.Sprintf("%s\nDuration: %.0f ms", tooltip, *test.Duration)
+		}
+		metrics = append(metrics, action_kit_api.Metric{
+			Name: new("new_relic_synthetic_monitor_run"),
+			Metric: map[string]string{
+				"newrelic.synthetic-monitor-location": fmt.Sprintf("%s/%s", test.MonitorGuid, test.LocationLabel),
+				"title":                               fmt.Sprintf("%s (%s)", monitorName(target), test.LocationLabel),
+				"state":                               metricState,
+				"tooltip":                             tooltip,
+				"url":                                 test.ResultsUrl,
+			},
+			Timestamp: now,
+			Value:     0,
+		})
+	}
+	return metrics
+}
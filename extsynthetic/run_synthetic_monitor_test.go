@@ -0,0 +1,143 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2022 Steadybit GmbH
+
+package extsynthetic
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/steadybit/action-kit/go/action_kit_api/v2"
+	"github.com/steadybit/extension-newrelic/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type syntheticTestApiMock struct {
+	started []string
+	results map[string]*types.SyntheticsAutomatedTestResult
+}
+
+func (m *syntheticTestApiMock) StartSyntheticTest(_ context.Context, _ string, batchName string) (string, error) {
+	batchId := fmt.Sprintf("%s-%d", batchName, len(m.started)+1)
+	m.started = append(m.started, batchId)
+	return batchId, nil
+}
+
+func (m *syntheticTestApiMock) GetSyntheticTestResult(_ context.Context, _ int64, batchId string) (*types.SyntheticsAutomatedTestResult, error) {
+	return m.results[batchId], nil
+}
+
+func newRunSyntheticMonitorState() *RunSyntheticMonitorState {
+	return &RunSyntheticMonitorState{
+		End: time.Now().Add(time.Minute),
+		Target: action_kit_api.Target{
+			Attributes: map[string][]string{
+				"new-relic.synthetic-monitor.name": {"Checkout journey"},
+				"new-relic.synthetic-monitor.guid": {"monitor-1"},
+			},
+		},
+		AccountId: 1234,
+		BatchName: "batch",
+	}
+}
+
+func testResult(status string, result string) *types.SyntheticsAutomatedTestResult {
+	return &types.SyntheticsAutomatedTestResult{
+		Status: status,
+		Tests:  []types.SyntheticsAutomatedTest{{MonitorGuid: "monitor-1", LocationLabel: "Frankfurt, DE", Result: result, ResultsUrl: "https://one.newrelic.com/result"}},
+	}
+}
+
+func TestRunSyntheticMonitorStartsNextRunAfterPreviousFinished(t *testing.T) {
+	api := &syntheticTestApiMock{results: map[string]*types.SyntheticsAutomatedTestResult{
+		"batch-1": testResult(automatedTestInProgress, automatedTestInProgress),
+	}}
+	state := newRunSyntheticMonitorState()
+
+	result, err := RunSyntheticMonitorStatus(context.Background(), state, api)
+	require.NoError(t, err)
+	assert.False(t, result.Completed)
+	assert.Equal(t, []string{"batch-1"}, api.started)
+
+	result, err = RunSyntheticMonitorStatus(context.Background(), state, api)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"batch-1"}, api.started)
+	require.Len(t, *result.Metrics, 1)
+	assert.Equal(t, "info", (*result.Metrics)[0].Metric["state"])
+
+	api.results["batch-1"] = testResult(automatedTestPassed, automatedTestSuccess)
+	result, err = RunSyntheticMonitorStatus(context.Background(), state, api)
+	require.NoError(t, err)
+	assert.Nil(t, result.Error)
+	assert.Equal(t, "success", (*result.Metrics)[0].Metric["state"])
+	assert.Equal(t, "monitor-1/Frankfurt, DE", (*result.Metrics)[0].Metric["newrelic.synthetic-monitor-location"])
+	assert.Equal(t, []string{"batch-1", "batch-2"}, api.started)
+	assert.Equal(t, 1, state.Runs)
+}
+
+func TestRunSyntheticMonitorFailsOnFailedRun(t *testing.T) {
+	api := &syntheticTestApiMock{results: map[string]*types.SyntheticsAutomatedTestResult{
+		"batch-1": testResult("FAILED", "FAILED"),
+	}}
+	state := newRunSyntheticMonitorState()
+
+	_, err := RunSyntheticMonitorStatus(context.Background(), state, api)
+	require.NoError(t, err)
+	result, err := RunSyntheticMonitorStatus(context.Background(), state, api)
+
+	require.NoError(t, err)
+	assert.True(t, result.Completed)
+	require.NotNil(t, result.Error)
+	assert.Equal(t, "Checkout journey: Run FAILED (Frankfurt, DE FAILED)", result.Error.Title)
+	assert.Equal(t, "danger", (*result.Metrics)[0].Metric["state"])
+}
+
+func TestRunSyntheticMonitorAwaitsLastRunAfterDuration(t *testing.T) {
+	api := &syntheticTestApiMock{results: map[string]*types.SyntheticsAutomatedTestResult{
+		"batch-1": testResult(automatedTestInProgress, automatedTestInProgress),
+	}}
+	state := newRunSyntheticMonitorState()
+	state.BatchId = "batch-1"
+	state.End = time.Now().Add(-time.Second)
+
+	result, err := RunSyntheticMonitorStatus(context.Background(), state, api)
+	require.NoError(t, err)
+	assert.False(t, result.Completed)
+
+	api.results["batch-1"] = testResult(automatedTestPassed, automatedTestSuccess)
+	result, err = RunSyntheticMonitorStatus(context.Background(), state, api)
+	require.NoError(t, err)
+	assert.True(t, result.Completed)
+	assert.Nil(t, result.Error)
+	assert.Empty(t, api.started)
+}
+
+func TestRunSyntheticMonitorFailsOnRunStuckAfterGracePeriod(t *testing.T) {
+	api := &syntheticTestApiMock{results: map[string]*types.SyntheticsAutomatedTestResult{
+		"batch-1": {
+			Status: automatedTestInProgress,
+			Tests: []types.SyntheticsAutomatedTest{
+				{MonitorGuid: "monitor-1", LocationLabel: "Frankfurt, DE", Result: automatedTestSuccess},
+				{MonitorGuid: "monitor-1", LocationLabel: "Columbus, OH, USA", Result: automatedTestInProgress},
+			},
+		},
+	}}
+	state := newRunSyntheticMonitorState()
+	state.BatchId = "batch-1"
+	state.End = time.Now().Add(-runGracePeriod + time.Minute)
+
+	result, err := RunSyntheticMonitorStatus(context.Background(), state, api)
+	require.NoError(t, err)
+	assert.False(t, result.Completed)
+
+	state.End = time.Now().Add(-runGracePeriod - time.Second)
+	result, err = RunSyntheticMonitorStatus(context.Background(), state, api)
+	require.NoError(t, err)
+	assert.True(t, result.Completed)
+	require.NotNil(t, result.Error)
+	assert.Equal(t, "Checkout journey: Run not finished 5m0s after the end of the step (pending in Columbus, OH, USA)", result.Error.Title)
+	assert.Empty(t, api.started)
+}
@@ -0,0 +1,346 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2022 Steadybit GmbH
+
+package extsynthetic
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/steadybit/action-kit/go/action_kit_api/v2"
+	"github.com/steadybit/action-kit/go/action_kit_sdk"
+	extension_kit "github.com/steadybit/extension-kit"
+	"github.com/steadybit/extension-kit/extbuild"
+	"github.com/steadybit/extension-kit/extutil"
+	"github.com/steadybit/extension-newrelic/config"
+)
+
+type SyntheticMonitorCheckAction struct{}
+
+// Make sure action implements all required interfaces
+var (
+	_ action_kit_sdk.Action[SyntheticMonitorCheckState]           = (*SyntheticMonitorCheckAction)(nil)
+	_ action_kit_sdk.ActionWithStatus[SyntheticMonitorCheckState] = (*SyntheticMonitorCheckAction)(nil)
+)
+
+type SyntheticMonitorCheckState struct {
+	Start              time.Time
+	End                time.Time
+	Target             action_kit_api.Target
+	AccountId          int64
+	MinSuccessRate     float64
+	MaxDuration        *float64
+	ConditionCheckMode string
+	// ConditionCheckSuccess is set once all locations with results met the thresholds at the
+	// same time. It is only used for conditionCheckModeAtLeastOnce.
+	ConditionCheckSuccess bool
+}
+
+// syntheticMonitorNrql aggregates the results of a monitor's checks per location. Durations
+// are reported in milliseconds.
+const syntheticMonitorNrql = "SELECT percentage(count(*), WHERE result = 'SUCCESS') AS 'successRate', average(duration) AS 'duration', count(*) AS 'checks' " +
+	"FROM SyntheticCheck WHERE entityGuid = %s SINCE %d UNTIL %d FACET locationLabel LIMIT MAX"
+
+// locationResult holds the aggregated check results of a single location.
+type locationResult struct {
+	location    string
+	successRate float64
+	duration    float64
+	checks      int64
+	violations  []string
+}
+
+func NewSyntheticMonitorCheckAction() action_kit_sdk.Action[SyntheticMonitorCheckState] {
+	return &SyntheticMonitorCheckAction{}
+}
+
+func (m *SyntheticMonitorCheckAction) NewEmptyState() SyntheticMonitorCheckState {
+	return SyntheticMonitorCheckState{}
+}
+
+func (m *SyntheticMonitorCheckAction) Describe() action_kit_api.ActionDescription {
+	return action_kit_api.ActionDescription{
+		Id:          SyntheticMonitorCheckActionId,
+		Label:       "Synthetic Monitor Check",
+		Description: "Checks the success rate and duration of a synthetic monitor's checks across its locations during the step.",
+		Version:     extbuild.GetSemverVersionStringOrUnknown(),
+		Icon:        new(syntheticMonitorCheckIcon),
+		TargetSelection: new(action_kit_api.TargetSelection{
+			TargetType:          SyntheticMonitorTargetId,
+			QuantityRestriction: extutil.Ptr(action_kit_api.QuantityRestrictionAll),
+			SelectionTemplates: new([]action_kit_api.TargetSelectionTemplate{
+				{
+					Label: "synthetic monitor name",
+					Query: "new-relic.synthetic-monitor.name=\"\"",
+				},
+			}),
+		}),
+		Technology: new("New Relic"),
+
+		Kind:        action_kit_api.Check,
+		TimeControl: action_kit_api.TimeControlInternal,
+		Parameters: []action_kit_api.ActionParameter{
+			{
+				Name:         "duration",
+				Label:        "Duration",
+				Description:  new("Monitors only check at their configured period, so the duration should span at least one period."),
+				Type:         action_kit_api.ActionParameterTypeDuration,
+				DefaultValue: new("5m"),
+				Order:        new(1),
+				Required:     new(true),
+			},
+			{
+				Name:         "minSuccessRate",
+				Label:        "Minimum Success Rate",
+				Description:  new("The minimum percentage of successful checks per location, e.g. 99.5."),
+				Type:         action_kit_api.ActionParameterTypeString,
+				DefaultValue: new("100"),
+				Order:        new(2),
+				Required:     new(true),
+			},
+			{
+				Name:        "maxDuration",
+				Label:       "Maximum Duration",
+				Description: new("The maximum average duration of the checks per location in milliseconds. Leave empty to not check the duration."),
+				Type:        action_kit_api.ActionParameterTypeString,
+				Order:       new(3),
+				Required:    new(false),
+			},
+			{
+				Name:         "conditionCheckMode",
+				Label:        "Condition Check Mode",
+				Description:  new("Should the step succeed if the condition is met at least once or all the time?"),
+				Type:         action_kit_api.ActionParameterTypeString,
+				DefaultValue: new(conditionCheckModeAllTheTime),
+				Options: new([]action_kit_api.ParameterOption{
+					action_kit_api.ExplicitParameterOption{
+						Label: "All the time",
+						Value: conditionCheckModeAllTheTime,
+					},
+					action_kit_api.ExplicitParameterOption{
+						Label: "At least once",
+						Value: conditionCheckModeAtLeastOnce,
+					},
+				}),
+				Required: new(true),
+				Order:    new(4),
+			},
+		},
+		Widgets: new([]action_kit_api.Widget{
+			action_kit_api.StateOverTimeWidget{
+				Type:  action_kit_api.ComSteadybitWidgetStateOverTime,
+				Title: "New Relic Synthetic Monitor",
+				Identity: action_kit_api.StateOverTimeWidgetIdentityConfig{
+					From: "newrelic.synthetic-monitor-location",
+				},
+				Label: action_kit_api.StateOverTimeWidgetLabelConfig{
+					From: "title",
+				},
+				State: action_kit_api.StateOverTimeWidgetStateConfig{
+					From: "state",
+				},
+				Tooltip: action_kit_api.StateOverTimeWidgetTooltipConfig{
+					From: "tooltip",
+				},
+				Url: new(action_kit_api.StateOverTimeWidgetUrlConfig{
+					From: new("url"),
+				}),
+				Value: new(action_kit_api.StateOverTimeWidgetValueConfig{
+					Hide: new(true),
+				}),
+			},
+		}),
+		Prepare: action_kit_api.MutatingEndpointReference{},
+		Start:   action_kit_api.MutatingEndpointReference{},
+		Status: new(action_kit_api.MutatingEndpointReferenceWithCallInterval{
+			CallInterval: new("10s"),
+		}),
+	}
+}
+
+func (m *SyntheticMonitorCheckAction) Prepare(_ context.Context, state *SyntheticMonitorCheckState, request action_kit_api.PrepareActionRequestBody) (*action_kit_api.PrepareResult, error) {
+	duration := request.Config["duration"].(float64)
+	state.Start = time.Now()
+	state.End = state.Start.Add(time.Millisecond * time.Duration(duration))
+	state.Target = *request.Target
+	state.AccountId = extutil.ToInt64(request.Target.Attributes["new-relic.synthetic-monitor.account"][0])
+	minSuccessRate, err := parseLimit("minimum success rate", request.Config["minSuccessRate"])
+	if err != nil {
+		return nil, err
+	}
+	state.MinSuccessRate = 100
+	if minSuccessRate != nil {
+		state.MinSuccessRate = *minSuccessRate
+	}
+	state.MaxDuration, err = parseLimit("maximum duration", request.Config["maxDuration"])
+	if err != nil {
+		return nil, err
+	}
+	if request.Config["conditionCheckMode"] != nil {
+		state.ConditionCheckMode = fmt.Sprintf("%v", request.Config["conditionCheckMode"])
+	}
+	return nil, nil
+}
+
+// parseLimit parses an optional limit, which may be a decimal.
+func parseLimit(label string, value any) (*float64, error) {
+	if number, isNumber := value.(float64); isNumber {
+		return &number, nil
+	}
+	text := strings.TrimSpace(extutil.ToString(value))
+	if text == "" {
+		return nil, nil
+	}
+	limit, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return nil, extension_kit.ToError(fmt.Sprintf("The %s '%s' is not a number.", label, text), err)
+	}
+	return &limit, nil
+}
+
+func (m *SyntheticMonitorCheckAction) Start(ctx context.Context, state *SyntheticMonitorCheckState) (*action_kit_api.StartResult, error) {
+	statusResult, err := SyntheticMonitorCheckStatus(ctx, state, &config.Config)
+	if statusResult == nil {
+		return nil, err
+	}
+	startResult := action_kit_api.StartResult{
+		Artifacts: statusResult.Artifacts,
+		Error:     statusResult.Error,
+		Messages:  statusResult.Messages,
+		Metrics:   statusResult.Metrics,
+	}
+	return &startResult, err
+}
+
+func (m *SyntheticMonitorCheckAction) Status(ctx context.Context, state *SyntheticMonitorCheckState) (*action_kit_api.StatusResult, error) {
+	return SyntheticMonitorCheckStatus(ctx, state, &config.Config)
+}
+
+type NrqlApi interface {
+	QueryNrql(ctx context.Context, accountId int64, query string) ([]map[string]any, error)
+}
+
+func SyntheticMonitorCheckStatus(ctx context.Context, state *SyntheticMonitorCheckState, api NrqlApi) (*action_kit_api.StatusResult, error) {
+	now := time.Now()
+	guid := state.Target.Attributes["new-relic.synthetic-monitor.guid"][0]
+	rows, err := api.QueryNrql(ctx, state.AccountId, fmt.Sprintf(syntheticMonitorNrql, config.NrqlString(guid), state.Start.UnixMilli(), now.UnixMilli()))
+	if err != nil {
+		return nil, extension_kit.ToError("Failed to get synthetic checks from New Relic.", err)
+	}
+
+	completed := now.After(state.End)
+	results := toLocationResults(state, rows)
+	violations := make([]string, 0)
+	for _, result := range results {
+		for _, violation := range result.violations {
+			violations = append(violations, fmt.Sprintf("%s: %s", result.location, violation))
+		}
+	}
+
+	var checkError *action_kit_api.ActionKitError
+	if state.ConditionCheckMode == conditionCheckModeAllTheTime {
+		if len(violations) > 0 {
+			checkError = new(action_kit_api.ActionKitError{
+				Title:  fmt.Sprintf("%s: %s", monitorName(state.Target), strings.Join(violations, ", ")),
+				Status: extutil.Ptr(action_kit_api.Failed),
+			})
+		}
+	} else if state.ConditionCheckMode == conditionCheckModeAtLeastOnce {
+		if len(results) > 0 && len(violations) == 0 {
+			state.ConditionCheckSuccess = true
+		}
+		if completed && !state.ConditionCheckSuccess {
+			checkError = new(action_kit_api.ActionKitError{
+				Title:  fmt.Sprintf("%s: Synthetic checks never met the thresholds.", monitorName(state.Target)),
+				Status: extutil.Ptr(action_kit_api.Failed),
+			})
+		}
+	}
+
+	return &action_kit_api.StatusResult{
+		Completed: completed,
+		Error:     checkError,
+		Metrics:   new(toMetrics(state, results, now)),
+	}, nil
+}
+
+// toLocationResults evaluates the faceted NRQL rows against the thresholds, ordered by
+// location. Locations without checks in the step are omitted.
+func toLocationResults(state *SyntheticMonitorCheckState, rows []map[string]any) []locationResult {
+	results := make([]locationResult, 0, len(rows))
+	for _, row := range rows {
+		location, _ := row["facet"].(string)
+		checks, _ := row["checks"].(float64)
+		if location == "" || checks <= 0 {
+			continue
+		}
+		result := locationResult{location: location, checks: int64(checks), violations: make([]string, 0)}
+		result.successRate, _ = row["successRate"].(float64)
+		result.duration, _ = row["duration"].(float64)
+		if result.successRate < state.MinSuccessRate {
+			result.violations = append(result.violations, fmt.Sprintf("Success rate is %.1f%%, below %.1f%%", result.successRate, state.MinSuccessRate))
+		}
+		if state.MaxDuration != nil && result.duration > *state.MaxDuration {
+			result.violations = append(result.violations, fmt.Sprintf("Duration is %.0f ms, above %.0f ms", result.duration, *state.MaxDuration))
+		}
+		results = append(results, result)
+	}
+	slices.SortFunc(results, func(a, b locationResult) int {
+		return strings.Compare(a.location, b.location)
+	})
+	return results
+}
+
+func monitorName(target action_kit_api.Target) string {
+	return target.Attributes["new-relic.synthetic-monitor.name"][0]
+}
+
+func toMetrics(state *SyntheticMonitorCheckState, results []locationResult, now time.Time) []action_kit_api.Metric {
+	guid := state.Target.Attributes["new-relic.synthetic-monitor.guid"][0]
+	url := ""
+	if permalink := state.Target.Attributes["new-relic.synthetic-monitor.permalink"]; len(permalink) > 0 {
+		url = permalink[0]
+	}
+
+	if len(results) == 0 {
+		return []action_kit_api.Metric{{
+			Name: new("new_relic_synthetic_monitor"),
+			Metric: map[string]string{
+				"newrelic.synthetic-monitor-location": guid,
+				"title":                               monitorName(state.Target),
+				"state":                               "info",
+				"tooltip":                             "No checks yet",
+				"url":                                 url,
+			},
+			Timestamp: now,
+			Value:     0,
+		}}
+	}
+
+	metrics := make([]action_kit_api.Metric, 0, len(results))
+	for _, result := range results {
+		metricState := "success"
+		tooltip := fmt.Sprintf("Success rate: %.1f%%\nAverage duration: %.0f ms\nChecks: %d", result.successRate, result.duration, result.checks)
+		if len(result.violations) > 0 {
+			metricState = "danger"
+			tooltip = fmt.Sprintf("%s\n%s", tooltip, strings.Join(result.violations, "\n"))
+		}
+		metrics = append(metrics, action_kit_api.Metric{
+			Name: new("new_relic_synthetic_monitor"),
+			Metric: map[string]string{
+				"newrelic.synthetic-monitor-location": fmt.Sprintf("%s/%s", guid, result.location),
+				"title":                               fmt.Sprintf("%s (%s)", monitorName(state.Target), result.location),
+				"state":                               metricState,
+				"tooltip":                             tooltip,
+				"url":                                 url,
+			},
+			Timestamp: now,
+			Value:     0,
+		})
+	}
+	return metrics
+}
@@ -0,0 +1,128 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2022 Steadybit GmbH
+
+package extsynthetic
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/steadybit/action-kit/go/action_kit_api/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type nrqlApiMock struct {
+	results []map[string]any
+	queries []string
+}
+
+func (m *nrqlApiMock) QueryNrql(_ context.Context, _ int64, query string) ([]map[string]any, error) {
+	m.queries = append(m.queries, query)
+	return m.results, nil
+}
+
+func newSyntheticMonitorState(conditionCheckMode string, maxDuration *float64) *SyntheticMonitorCheckState {
+	return &SyntheticMonitorCheckState{
+		Start: time.Now(),
+		End:   time.Now().Add(time.Minute),
+		Target: action_kit_api.Target{
+			Attributes: map[string][]string{
+				"new-relic.synthetic-monitor.name":      {"Checkout ping"},
+				"new-relic.synthetic-monitor.guid":      {"monitor-1"},
+				"new-relic.synthetic-monitor.permalink": {"https://one.newrelic.com/monitor-1"},
+			},
+		},
+		AccountId:          1234,
+		MinSuccessRate:     100,
+		MaxDuration:        maxDuration,
+		ConditionCheckMode: conditionCheckMode,
+	}
+}
+
+func TestSyntheticMonitorCheckReportsEachLocation(t *testing.T) {
+	api := &nrqlApiMock{results: []map[string]any{
+		{"facet": "Frankfurt, DE", "successRate": 100.0, "duration": 250.0, "checks": 2.0},
+		{"facet": "Columbus, OH, USA", "successRate": 50.0, "duration": 900.0, "checks": 2.0},
+	}}
+
+	result, err := SyntheticMonitorCheckStatus(context.Background(), newSyntheticMonitorState(conditionCheckModeAllTheTime, nil), api)
+
+	require.NoError(t, err)
+	assert.Contains(t, api.queries[0], "entityGuid = 'monitor-1'")
+	require.NotNil(t, result.Error)
+	assert.Equal(t, "Checkout ping: Columbus, OH, USA: Success rate is 50.0%, below 100.0%", result.Error.Title)
+	require.Len(t, *result.Metrics, 2)
+	assert.Equal(t, "monitor-1/Columbus, OH, USA", (*result.Metrics)[0].Metric["newrelic.synthetic-monitor-location"])
+	assert.Equal(t, "danger", (*result.Metrics)[0].Metric["state"])
+	assert.Equal(t, "Checkout ping (Frankfurt, DE)", (*result.Metrics)[1].Metric["title"])
+	assert.Equal(t, "success", (*result.Metrics)[1].Metric["state"])
+	assert.Equal(t, "https://one.newrelic.com/monitor-1", (*result.Metrics)[1].Metric["url"])
+}
+
+func TestSyntheticMonitorCheckFailsAboveMaxDuration(t *testing.T) {
+	api := &nrqlApiMock{results: []map[string]any{
+		{"facet": "Frankfurt, DE", "successRate": 100.0, "duration": 1500.0, "checks": 1.0},
+	}}
+
+	result, err := SyntheticMonitorCheckStatus(context.Background(), newSyntheticMonitorState(conditionCheckModeAllTheTime, new(1000.0)), api)
+
+	require.NoError(t, err)
+	require.NotNil(t, result.Error)
+	assert.Equal(t, "Checkout ping: Frankfurt, DE: Duration is 1500 ms, above 1000 ms", result.Error.Title)
+}
+
+func TestSyntheticMonitorCheckParsesDecimalLimits(t *testing.T) {
+	state := &SyntheticMonitorCheckState{}
+	_, err := (&SyntheticMonitorCheckAction{}).Prepare(context.Background(), state, action_kit_api.PrepareActionRequestBody{
+		Config: map[string]any{"duration": 60000.0, "minSuccessRate": "99.5", "maxDuration": " 1500.5 "},
+		Target: &action_kit_api.Target{Attributes: map[string][]string{"new-relic.synthetic-monitor.account": {"1234"}}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 99.5, state.MinSuccessRate)
+	assert.Equal(t, new(1500.5), state.MaxDuration)
+
+	api := &nrqlApiMock{results: []map[string]any{
+		{"facet": "Frankfurt, DE", "successRate": 99.0, "duration": 1000.0, "checks": 100.0},
+	}}
+	checkState := newSyntheticMonitorState(conditionCheckModeAllTheTime, state.MaxDuration)
+	checkState.MinSuccessRate = state.MinSuccessRate
+	result, err := SyntheticMonitorCheckStatus(context.Background(), checkState, api)
+	require.NoError(t, err)
+	require.NotNil(t, result.Error)
+	assert.Equal(t, "Checkout ping: Frankfurt, DE: Success rate is 99.0%, below 99.5%", result.Error.Title)
+
+	_, err = parseLimit("maximum duration", "1,5")
+	assert.ErrorContains(t, err, "maximum duration")
+}
+
+func TestSyntheticMonitorCheckWithoutChecksIsNoViolation(t *testing.T) {
+	api := &nrqlApiMock{results: []map[string]any{}}
+	state := newSyntheticMonitorState(conditionCheckModeAllTheTime, nil)
+
+	result, err := SyntheticMonitorCheckStatus(context.Background(), state, api)
+
+	require.NoError(t, err)
+	assert.Nil(t, result.Error)
+	require.Len(t, *result.Metrics, 1)
+	assert.Equal(t, "info", (*result.Metrics)[0].Metric["state"])
+	assert.Equal(t, "No checks yet", (*result.Metrics)[0].Metric["tooltip"])
+}
+
+func TestSyntheticMonitorCheckAtLeastOnce(t *testing.T) {
+	api := &nrqlApiMock{results: []map[string]any{}}
+	state := newSyntheticMonitorState(conditionCheckModeAtLeastOnce, nil)
+	state.End = time.Now().Add(-time.Second)
+
+	result, err := SyntheticMonitorCheckStatus(context.Background(), state, api)
+	require.NoError(t, err)
+	require.NotNil(t, result.Error)
+	assert.Equal(t, "Checkout ping: Synthetic checks never met the thresholds.", result.Error.Title)
+
+	api.results = []map[string]any{{"facet": "Frankfurt, DE", "successRate": 100.0, "duration": 250.0, "checks": 1.0}}
+	result, err = SyntheticMonitorCheckStatus(context.Background(), state, api)
+	require.NoError(t, err)
+	assert.Nil(t, result.Error)
+	assert.True(t, result.Completed)
+}
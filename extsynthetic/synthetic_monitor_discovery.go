@@ -0,0 +1,183 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2022 Steadybit GmbH
+
+package extsynthetic
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/steadybit/discovery-kit/go/discovery_kit_api"
+	"github.com/steadybit/discovery-kit/go/discovery_kit_sdk"
+	"github.com/steadybit/extension-kit/extbuild"
+	"github.com/steadybit/extension-newrelic/config"
+	"github.com/steadybit/extension-newrelic/types"
+)
+
+type syntheticMonitorDiscovery struct {
+}
+
+var (
+	_ discovery_kit_sdk.TargetDescriber    = (*syntheticMonitorDiscovery)(nil)
+	_ discovery_kit_sdk.AttributeDescriber = (*syntheticMonitorDiscovery)(nil)
+)
+
+// syntheticMonitorsQuery selects all synthetic monitors of all accounts the API key can see.
+const syntheticMonitorsQuery = "domain = 'SYNTH' AND type = 'MONITOR'"
+
+// locationTags are the tags New Relic lists the public and private locations of a monitor in.
+var locationTags = []string{"publicLocation", "privateLocation"}
+
+func NewSyntheticMonitorDiscovery() discovery_kit_sdk.TargetDiscovery {
+	discovery := &syntheticMonitorDiscovery{}
+	return discovery_kit_sdk.NewCachedTargetDiscovery(discovery,
+		discovery_kit_sdk.WithRefreshTargetsNow(),
+		discovery_kit_sdk.WithRefreshTargetsInterval(context.Background(), 5*time.Minute),
+	)
+}
+
+func (d *syntheticMonitorDiscovery) Describe() discovery_kit_api.DiscoveryDescription {
+	return discovery_kit_api.DiscoveryDescription{
+		Id: SyntheticMonitorTargetId,
+		Discover: discovery_kit_api.DescribingEndpointReferenceWithCallInterval{
+			CallInterval: new("5m"),
+		},
+	}
+}
+
+func (d *syntheticMonitorDiscovery) DescribeTarget() discovery_kit_api.TargetDescription {
+	return discovery_kit_api.TargetDescription{
+		Id:       SyntheticMonitorTargetId,
+		Label:    discovery_kit_api.PluralLabel{One: "New Relic Synthetic Monitor", Other: "New Relic Synthetic Monitors"},
+		Category: new("monitoring"),
+		Version:  extbuild.GetSemverVersionStringOrUnknown(),
+		Icon:     new(syntheticMonitorIcon),
+		Table: discovery_kit_api.Table{
+			Columns: []discovery_kit_api.Column{
+				{Attribute: "new-relic.synthetic-monitor.name"},
+				{Attribute: "new-relic.synthetic-monitor.type"},
+				{Attribute: "new-relic.synthetic-monitor.status"},
+				{Attribute: "new-relic.synthetic-monitor.account"},
+			},
+			OrderBy: []discovery_kit_api.OrderBy{
+				{
+					Attribute: "new-relic.synthetic-monitor.name",
+					Direction: "ASC",
+				},
+			},
+		},
+	}
+}
+
+func (d *syntheticMonitorDiscovery) DescribeAttributes() []discovery_kit_api.AttributeDescription {
+	return []discovery_kit_api.AttributeDescription{
+		{
+			Attribute: "new-relic.synthetic-monitor.name",
+			Label: discovery_kit_api.PluralLabel{
+				One:   "New Relic Synthetic Monitor Name",
+				Other: "New Relic Synthetic Monitor Names",
+			},
+		},
+		{
+			Attribute: "new-relic.synthetic-monitor.account",
+			Label: discovery_kit_api.PluralLabel{
+				One:   "New Relic Synthetic Monitor Account",
+				Other: "New Relic Synthetic Monitor Accounts",
+			},
+		},
+		{
+			Attribute: "new-relic.synthetic-monitor.type",
+			Label: discovery_kit_api.PluralLabel{
+				One:   "New Relic Synthetic Monitor Type",
+				Other: "New Relic Synthetic Monitor Types",
+			},
+		},
+		{
+			Attribute: "new-relic.synthetic-monitor.period",
+			Label: discovery_kit_api.PluralLabel{
+				One:   "New Relic Synthetic Monitor Period",
+				Other: "New Relic Synthetic Monitor Periods",
+			},
+		},
+		{
+			Attribute: "new-relic.synthetic-monitor.status",
+			Label: discovery_kit_api.PluralLabel{
+				One:   "New Relic Synthetic Monitor Status",
+				Other: "New Relic Synthetic Monitor Statuses",
+			},
+		},
+		{
+			Attribute: "new-relic.synthetic-monitor.location",
+			Label: discovery_kit_api.PluralLabel{
+				One:   "New Relic Synthetic Monitor Location",
+				Other: "New Relic Synthetic Monitor Locations",
+			},
+		},
+	}
+}
+
+func (d *syntheticMonitorDiscovery) DiscoverTargets(ctx context.Context) ([]discovery_kit_api.Target, error) {
+	return getAllSyntheticMonitors(ctx, &config.Config), nil
+}
+
+type GetSyntheticMonitorsApi interface {
+	SearchEntities(ctx context.Context, query string) ([]types.GraphQlResponseEntities, error)
+}
+
+func getAllSyntheticMonitors(ctx context.Context, api GetSyntheticMonitorsApi) []discovery_kit_api.Target {
+	result := make([]discovery_kit_api.Target, 0, 100)
+
+	monitors, err := api.SearchEntities(ctx, syntheticMonitorsQuery)
+	if err != nil {
+		log.Err(err).Msgf("Failed to get synthetic monitors from New Relic.")
+		return result
+	}
+
+	for _, monitor := range monitors {
+		result = append(result, toTarget(monitor))
+	}
+
+	return result
+}
+
+func toTarget(monitor types.GraphQlResponseEntities) discovery_kit_api.Target {
+	label := fmt.Sprintf("%s (%d)", monitor.Name, monitor.AccountId)
+
+	attributes := make(map[string][]string)
+	attributes["new-relic.synthetic-monitor.name"] = []string{monitor.Name}
+	attributes["new-relic.synthetic-monitor.guid"] = []string{monitor.Guid}
+	attributes["new-relic.synthetic-monitor.permalink"] = []string{monitor.Permalink}
+	attributes["new-relic.synthetic-monitor.account"] = []string{fmt.Sprintf("%d", monitor.AccountId)}
+	if monitor.MonitorId != "" {
+		attributes["new-relic.synthetic-monitor.id"] = []string{monitor.MonitorId}
+	}
+	if monitor.MonitorType != "" {
+		attributes["new-relic.synthetic-monitor.type"] = []string{monitor.MonitorType}
+	}
+	if monitor.Period != nil {
+		attributes["new-relic.synthetic-monitor.period"] = []string{fmt.Sprintf("%d minutes", *monitor.Period)}
+	}
+	if monitor.MonitorSummary != nil && monitor.MonitorSummary.Status != "" {
+		attributes["new-relic.synthetic-monitor.status"] = []string{monitor.MonitorSummary.Status}
+	}
+	locations := make([]string, 0)
+	for _, tag := range monitor.Tags {
+		attributes[fmt.Sprintf("new-relic.synthetic-monitor.label.%s", tag.Key)] = tag.Values
+		if slices.Contains(locationTags, tag.Key) {
+			locations = append(locations, tag.Values...)
+		}
+	}
+	if len(locations) > 0 {
+		attributes["new-relic.synthetic-monitor.location"] = locations
+	}
+
+	return discovery_kit_api.Target{
+		Id:         monitor.Guid,
+		Label:      label,
+		TargetType: SyntheticMonitorTargetId,
+		Attributes: attributes,
+	}
+}
@@ -0,0 +1,38 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2022 Steadybit GmbH
+
+package extsynthetic
+
+import (
+	"testing"
+
+	"github.com/steadybit/extension-newrelic/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestToTargetCollectsLocations(t *testing.T) {
+	target := toTarget(types.GraphQlResponseEntities{
+		Guid:        "monitor-1",
+		Name:        "Checkout ping",
+		AccountId:   1234,
+		MonitorId:   "c0ffee",
+		MonitorType: "SIMPLE",
+		Period:      new(int64(5)),
+		MonitorSummary: &types.SyntheticMonitorSummary{
+			Status: "ENABLED",
+		},
+		Tags: []types.GraphQlResponseTags{
+			{Key: "publicLocation", Values: []string{"AWS_EU_CENTRAL_1", "AWS_US_EAST_2"}},
+			{Key: "privateLocation", Values: []string{"office"}},
+			{Key: "team", Values: []string{"checkout"}},
+		},
+	})
+
+	assert.Equal(t, "Checkout ping (1234)", target.Label)
+	assert.Equal(t, SyntheticMonitorTargetId, target.TargetType)
+	assert.Equal(t, []string{"SIMPLE"}, target.Attributes["new-relic.synthetic-monitor.type"])
+	assert.Equal(t, []string{"5 minutes"}, target.Attributes["new-relic.synthetic-monitor.period"])
+	assert.Equal(t, []string{"ENABLED"}, target.Attributes["new-relic.synthetic-monitor.status"])
+	assert.Equal(t, []string{"AWS_EU_CENTRAL_1", "AWS_US_EAST_2", "office"}, target.Attributes["new-relic.synthetic-monitor.location"])
+	assert.Equal(t, []string{"checkout"}, target.Attributes["new-relic.synthetic-monitor.label.team"])
+}
@@ -16,6 +16,7 @@ import (
 	"github.com/steadybit/extension-kit/extbuild"
 	"github.com/steadybit/extension-kit/extutil"
 	"github.com/steadybit/extension-newrelic/config"
+	"github.com/steadybit/extension-newrelic/types"
 )
 
 type WorkloadCheckAction struct{}
@@ -196,7 +197,7 @@ type WorkloadStatusApi interface {
 func WorkloadCheckStatus(ctx context.Context, state *WorkloadCheckState, api WorkloadStatusApi) (*action_kit_api.StatusResult, error) {
 	now := time.Now()
 	guid := state.Target.Attributes["new-relic.workload.guid"][0]
-	accountId := extutil.ToInt64(state.Target.Attributes["new-relic.workload.account"][0])
+	accountId := workloadAccountId(state.Target)
 	status, err := api.GetWorkloadStatus(ctx, guid, accountId)
 	if err != nil {
 		return nil, extension_kit.ToError("Failed to get workload status from New Relic.", err)
@@ -237,6 +238,16 @@ func WorkloadCheckStatus(ctx context.Context, state *WorkloadCheckState, api Wor
 	}, nil
 }
 
+// workloadAccountId returns the account owning the workload, which is the only account its
+// status can be read through. Targets discovered by older versions carry whichever account
+// listed the workload, so the guid takes precedence.
+func workloadAccountId(target action_kit_api.Target) int64 {
+	if accountId, ok := types.AccountIdFromEntityGuid(target.Attributes["new-relic.workload.guid"][0]); ok {
+		return accountId
+	}
+	return extutil.ToInt64(target.Attributes["new-relic.workload.account"][0])
+}
+
 func keysToString(m map[string]bool) string {
 	keys := make([]string, 0, len(m))
 	for k := range m {
@@ -12,6 +12,7 @@ import (
 	"github.com/steadybit/extension-kit/extbuild"
 	"github.com/steadybit/extension-newrelic/config"
 	"github.com/steadybit/extension-newrelic/types"
+	"slices"
 	"time"
 )
 
@@ -77,6 +78,13 @@ func (d *workloadDiscovery) DescribeAttributes() []discovery_kit_api.AttributeDe
 				Other: "New Relic Workload Accounts",
 			},
 		},
+		{
+			Attribute: "new-relic.workload.scope-account",
+			Label: discovery_kit_api.PluralLabel{
+				One:   "New Relic Workload Scope Account",
+				Other: "New Relic Workload Scope Accounts",
+			},
+		},
 	}
 }
 
@@ -98,6 +106,10 @@ func getAllWorkloads(ctx context.Context, api GetWorkloadsApi) []discovery_kit_a
 		return result
 	}
 
+	// A workload is listed once per account that can see it, so the same guid may show up
+	// several times. Merge these into a single target.
+	workloadsByGuid := make(map[string]*discoveredWorkload)
+	order := make([]string, 0, 100)
 	for _, accountId := range accounts {
 		workloads, err := api.GetWorkloads(ctx, accountId)
 		if err != nil {
@@ -108,21 +120,68 @@ func getAllWorkloads(ctx context.Context, api GetWorkloadsApi) []discovery_kit_a
 		}
 
 		for _, workload := range workloads {
-			result = append(result, toTarget(workload, accountId))
+			discovered, ok := workloadsByGuid[workload.Guid]
+			if !ok {
+				discovered = &discoveredWorkload{workload: workload, owningAccountId: owningAccountId(workload, accountId)}
+				workloadsByGuid[workload.Guid] = discovered
+				order = append(order, workload.Guid)
+			}
+			discovered.addScopeAccount(accountId)
+			if workload.ScopeAccounts != nil {
+				for _, scopeAccountId := range workload.ScopeAccounts.AccountIds {
+					discovered.addScopeAccount(scopeAccountId)
+				}
+			}
 		}
 	}
 
+	for _, guid := range order {
+		result = append(result, toTarget(workloadsByGuid[guid]))
+	}
+
 	return result
 }
 
-func toTarget(workload types.Workload, accountId int64) discovery_kit_api.Target {
-	label := fmt.Sprintf("%s (%d)", workload.Name, accountId)
+type discoveredWorkload struct {
+	workload        types.Workload
+	owningAccountId int64
+	scopeAccountIds []int64
+}
+
+func (w *discoveredWorkload) addScopeAccount(accountId int64) {
+	if !slices.Contains(w.scopeAccountIds, accountId) {
+		w.scopeAccountIds = append(w.scopeAccountIds, accountId)
+	}
+}
+
+// owningAccountId determines the account a workload was created in. Older API responses
+// lack the `account` field, in which case the account is taken from the guid and, as a
+// last resort, the account the workload was listed by.
+func owningAccountId(workload types.Workload, listedByAccountId int64) int64 {
+	if workload.Account != nil && workload.Account.Id != 0 {
+		return workload.Account.Id
+	}
+	if accountId, ok := types.AccountIdFromEntityGuid(workload.Guid); ok {
+		return accountId
+	}
+	return listedByAccountId
+}
+
+func toTarget(discovered *discoveredWorkload) discovery_kit_api.Target {
+	workload := discovered.workload
+	label := fmt.Sprintf("%s (%d)", workload.Name, discovered.owningAccountId)
+
+	scopeAccounts := make([]string, 0, len(discovered.scopeAccountIds))
+	for _, accountId := range discovered.scopeAccountIds {
+		scopeAccounts = append(scopeAccounts, fmt.Sprintf("%d", accountId))
+	}
 
 	attributes := make(map[string][]string)
 	attributes["new-relic.workload.name"] = []string{workload.Name}
 	attributes["new-relic.workload.guid"] = []string{workload.Guid}
 	attributes["new-relic.workload.permalink"] = []string{workload.Permalink}
-	attributes["new-relic.workload.account"] = []string{fmt.Sprintf("%d", accountId)}
+	attributes["new-relic.workload.account"] = []string{fmt.Sprintf("%d", discovered.owningAccountId)}
+	attributes["new-relic.workload.scope-account"] = scopeAccounts
 
 	return discovery_kit_api.Target{
 		Id:         workload.Guid,
@@ -0,0 +1,58 @@
+// SPDX-License-Identifier: MIT
+// SPDX-FileCopyrightText: 2022 Steadybit GmbH
+
+package extworkload
+
+import (
+	"context"
+	"testing"
+
+	"github.com/steadybit/extension-newrelic/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type workloadsApiMock struct {
+	accounts  []int64
+	workloads map[int64][]types.Workload
+}
+
+func (m *workloadsApiMock) GetAccountIds(_ context.Context) ([]int64, error) {
+	return m.accounts, nil
+}
+
+func (m *workloadsApiMock) GetWorkloads(_ context.Context, accountId int64) ([]types.Workload, error) {
+	return m.workloads[accountId], nil
+}
+
+// "Mjg0NzgwNnxOUjF8V09SS0xPQUR8Mjg5MzM" decodes to "2847806|NR1|WORKLOAD|28933".
+const crossAccountGuid = "Mjg0NzgwNnxOUjF8V09SS0xPQUR8Mjg5MzM"
+
+func TestGetAllWorkloadsMergesWorkloadsListedByMultipleAccounts(t *testing.T) {
+	api := &workloadsApiMock{
+		accounts: []int64{1111, 2847806},
+		workloads: map[int64][]types.Workload{
+			1111: {
+				{Guid: crossAccountGuid, Name: "checkout"},
+				{Guid: "other", Name: "other", Account: &types.GraphQlResponseAccounts{Id: 1111}},
+			},
+			2847806: {
+				{Guid: crossAccountGuid, Name: "checkout", Account: &types.GraphQlResponseAccounts{Id: 2847806}, ScopeAccounts: &types.WorkloadScopeAccounts{AccountIds: []int64{2847806, 3333}}},
+			},
+		},
+	}
+
+	targets := getAllWorkloads(context.Background(), api)
+
+	require.Len(t, targets, 2)
+	assert.Equal(t, crossAccountGuid, targets[0].Id)
+	assert.Equal(t, "checkout (2847806)", targets[0].Label)
+	assert.Equal(t, []string{"2847806"}, targets[0].Attributes["new-relic.workload.account"])
+	assert.ElementsMatch(t, []string{"1111", "2847806", "3333"}, targets[0].Attributes["new-relic.workload.scope-account"])
+	assert.Equal(t, []string{"1111"}, targets[1].Attributes["new-relic.workload.account"])
+}
+
+func TestOwningAccountIdFallsBackToListingAccount(t *testing.T) {
+	assert.Equal(t, int64(2847806), owningAccountId(types.Workload{Guid: crossAccountGuid}, 1111))
+	assert.Equal(t, int64(1111), owningAccountId(types.Workload{Guid: "guid-11111"}, 1111))
+}
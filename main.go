@@ -19,8 +19,13 @@ import (
 	"github.com/steadybit/extension-kit/extsignals"
 	"github.com/steadybit/extension-newrelic/config"
 	"github.com/steadybit/extension-newrelic/extaccount"
+	"github.com/steadybit/extension-newrelic/extalert"
+	"github.com/steadybit/extension-newrelic/extapm"
+	"github.com/steadybit/extension-newrelic/extentity"
 	"github.com/steadybit/extension-newrelic/extevents"
 	"github.com/steadybit/extension-newrelic/extincident"
+	"github.com/steadybit/extension-newrelic/extservicelevel"
+	"github.com/steadybit/extension-newrelic/extsynthetic"
 	"github.com/steadybit/extension-newrelic/extworkload"
 )
 
@@ -36,9 +41,21 @@ func main() {
 
 	discovery_kit_sdk.Register(extworkload.NewWorkloadDiscovery())
 	discovery_kit_sdk.Register(extaccount.NewAccountDiscovery())
+	discovery_kit_sdk.Register(extapm.NewServiceDiscovery())
+	discovery_kit_sdk.Register(extservicelevel.NewServiceLevelDiscovery())
+	discovery_kit_sdk.Register(extalert.NewAlertPolicyDiscovery())
+	discovery_kit_sdk.Register(extalert.NewAlertConditionDiscovery())
+	discovery_kit_sdk.Register(extsynthetic.NewSyntheticMonitorDiscovery())
 	action_kit_sdk.RegisterAction(extworkload.NewWorkloadCheckAction())
 	action_kit_sdk.RegisterAction(extaccount.NewCreateMutingRuleAction())
+	action_kit_sdk.RegisterAction(extalert.NewDisableAlertConditionsAction())
 	action_kit_sdk.RegisterAction(extincident.NewIncidentCheckAction())
+	action_kit_sdk.RegisterAction(extentity.NewAlertSeverityCheckAction())
+	action_kit_sdk.RegisterAction(extapm.NewGoldenSignalsCheckAction())
+	action_kit_sdk.RegisterAction(extservicelevel.NewServiceLevelCheckAction())
+	action_kit_sdk.RegisterAction(extsynthetic.NewSyntheticMonitorCheckAction())
+	action_kit_sdk.RegisterAction(extsynthetic.NewPauseSyntheticMonitorAction())
+	action_kit_sdk.RegisterAction(extsynthetic.NewRunSyntheticMonitorAction())
 	extevents.RegisterEventListenerHandlers()
 
 	exthttp.RegisterRevisionedHandler("/", getExtensionList)
@@ -81,6 +98,11 @@ func getExtensionList() ExtensionListResponse {
 					Path:     "/events/experiment-step-started",
 					ListenTo: []string{"experiment.execution.step-started"},
 				},
+				{
+					Method:   "POST",
+					Path:     "/events/experiment-step-completed",
+					ListenTo: []string{"experiment.execution.step-completed", "experiment.execution.step-canceled", "experiment.execution.step-errored", "experiment.execution.step-failed"},
+				},
 				{
 					Method:   "POST",
 					Path:     "/events/experiment-target-started",
@@ -0,0 +1,67 @@
+package types
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+// eventIngest has the fields of EventIngest without its JSON methods.
+type eventIngest EventIngest
+
+// eventIngestFields are the JSON names of the fields of EventIngest.
+var eventIngestFields = func() map[string]bool {
+	fields := make(map[string]bool)
+	t := reflect.TypeFor[EventIngest]()
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			fields[name] = true
+		}
+	}
+	return fields
+}()
+
+// MarshalJSON renders the additional attributes next to the fields of the event, as the
+// Event API expects a flat object. Attributes can't replace fields.
+func (e EventIngest) MarshalJSON() ([]byte, error) {
+	b, err := json.Marshal(eventIngest(e))
+	if err != nil || len(e.Attributes) == 0 {
+		return b, err
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return nil, err
+	}
+	for key, value := range e.Attributes {
+		if !eventIngestFields[key] {
+			fields[key] = value
+		}
+	}
+	return json.Marshal(fields)
+}
+
+// UnmarshalJSON reads all keys other than the fields of the event into its attributes.
+func (e *EventIngest) UnmarshalJSON(b []byte) error {
+	var event eventIngest
+	if err := json.Unmarshal(b, &event); err != nil {
+		return err
+	}
+	var values map[string]any
+	if err := json.Unmarshal(b, &values); err != nil {
+		return err
+	}
+	for key, value := range values {
+		if eventIngestFields[key] {
+			continue
+		}
+		if value, ok := value.(string); ok {
+			if event.Attributes == nil {
+				event.Attributes = make(map[string]string)
+			}
+			event.Attributes[key] = value
+		}
+	}
+	*e = EventIngest(event)
+	return nil
+}
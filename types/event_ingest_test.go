@@ -0,0 +1,32 @@
+package types
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventIngestJsonFlattensAttributes(t *testing.T) {
+	event := EventIngest{
+		EventType: EventTypeAttackStarted,
+		Target:    "checkout",
+		Attributes: map[string]string{
+			"clusterName": "prod",
+			"target":      "ignored",
+		},
+	}
+
+	b, err := json.Marshal(event)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"eventType":"AttackStarted","target":"checkout","clusterName":"prod"}`, string(b))
+
+	var decoded EventIngest
+	require.NoError(t, json.Unmarshal(b, &decoded))
+	assert.Equal(t, EventIngest{
+		EventType:  EventTypeAttackStarted,
+		Target:     "checkout",
+		Attributes: map[string]string{"clusterName": "prod"},
+	}, decoded)
+}
@@ -0,0 +1,26 @@
+package types
+
+import (
+	"encoding/base64"
+	"strconv"
+	"strings"
+)
+
+// AccountIdFromEntityGuid extracts the id of the account owning an entity. New Relic entity
+// guids are the unpadded base64 encoding of `<accountId>|<domain>|<type>|<domainId>`, e.g.
+// `2847806|NR1|WORKLOAD|28933`.
+func AccountIdFromEntityGuid(guid string) (int64, bool) {
+	decoded, err := base64.RawStdEncoding.DecodeString(strings.TrimRight(guid, "="))
+	if err != nil {
+		return 0, false
+	}
+	accountId, _, found := strings.Cut(string(decoded), "|")
+	if !found {
+		return 0, false
+	}
+	id, err := strconv.ParseInt(accountId, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return id, true
+}
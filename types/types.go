@@ -3,6 +3,7 @@ package types
 import (
 	"fmt"
 	"strings"
+	"time"
 )
 
 type EventType string
@@ -12,6 +13,7 @@ const (
 	EventTypeExperimentEnded   EventType = "ExperimentEnded"
 	EventTypeAttackStarted     EventType = "AttackStarted"
 	EventTypeAttackEnded       EventType = "AttackEnded"
+	EventTypeStepEnded         EventType = "StepEnded"
 )
 
 type EventIngest struct {
@@ -32,6 +34,69 @@ type EventIngest struct {
 	Target            string    `json:"target,omitempty"`
 	TargetType        string    `json:"targetType,omitempty"`
 	TargetState       string    `json:"targetState,omitempty"`
+	EntityGuid        string    `json:"entityGuid,omitempty"`
+	EntityName        string    `json:"entityName,omitempty"`
+	EntityGuids       string    `json:"entityGuids,omitempty"`
+	// Timestamp is the time of the event in epoch milliseconds, rather than the time New Relic received it.
+	Timestamp         int64  `json:"timestamp,omitempty"`
+	ExecutionUrl      string `json:"executionUrl,omitempty"`
+	StepExecutionId   string `json:"stepExecutionId,omitempty"`
+	TargetExecutionId string `json:"targetExecutionId,omitempty"`
+	StartedTimestamp  int64  `json:"startedTimestamp,omitempty"`
+	EndedTimestamp    int64  `json:"endedTimestamp,omitempty"`
+	DurationMs        int64  `json:"durationMs,omitempty"`
+	FailureReason     string `json:"failureReason,omitempty"`
+	StepKind          string `json:"stepKind,omitempty"`
+	// Attributes are additional, configurable attributes of the event - see MarshalJSON.
+	Attributes map[string]string `json:"-"`
+}
+
+// MetricTypeGauge is the type of metrics holding the current value of something.
+const MetricTypeGauge = "gauge"
+
+// MetricData is a set of metrics sent to the Metric API in one request.
+type MetricData struct {
+	Metrics []Metric `json:"metrics"`
+}
+
+// Metric is a data point of a dimensional metric.
+type Metric struct {
+	Name  string  `json:"name"`
+	Type  string  `json:"type"`
+	Value float64 `json:"value"`
+	// Timestamp is the time of the data point in epoch milliseconds.
+	Timestamp  int64             `json:"timestamp"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// LogData is a set of log entries sent to the Log API in one request, with attributes common
+// to all of them.
+type LogData struct {
+	Common LogCommon  `json:"common"`
+	Logs   []LogEntry `json:"logs"`
+}
+
+type LogCommon struct {
+	Attributes map[string]any `json:"attributes,omitempty"`
+}
+
+// LogEntry is a log line.
+type LogEntry struct {
+	// Timestamp is the time of the log line in epoch milliseconds.
+	Timestamp  int64          `json:"timestamp"`
+	Message    string         `json:"message"`
+	Attributes map[string]any `json:"attributes,omitempty"`
+}
+
+// ChangeTrackingEvent is a change recorded on the timeline of New Relic entities.
+type ChangeTrackingEvent struct {
+	EntityGuids      []string
+	ShortDescription string
+	Description      string
+	User             string
+	GroupId          string
+	Timestamp        time.Time
+	CustomAttributes map[string]string
 }
 
 type Workload struct {
@@ -39,6 +104,15 @@ type Workload struct {
 	Name      string          `json:"name"`
 	Permalink string          `json:"permalink"`
 	Status    *WorkloadStatus `json:"status"`
+	// Account is the account the workload was created in. Its status can only be read
+	// through this account, even if it is listed by others.
+	Account *GraphQlResponseAccounts `json:"account"`
+	// ScopeAccounts are the accounts the workload's entities are taken from.
+	ScopeAccounts *WorkloadScopeAccounts `json:"scopeAccounts"`
+}
+
+type WorkloadScopeAccounts struct {
+	AccountIds []int64 `json:"accountIds"`
 }
 
 type GraphQlResponse struct {
@@ -46,8 +120,38 @@ type GraphQlResponse struct {
 	Errors *[]GraphQlResponseError `json:"errors"`
 }
 type GraphQlResponseData struct {
-	Actor                  *GraphQlResponseActor                  `json:"actor"`
-	AlertsMutingRuleCreate *GraphQlResponseAlertsMutingRuleCreate `json:"alertsMutingRuleCreate"`
+	Actor                     *GraphQlResponseActor                     `json:"actor"`
+	AlertsMutingRuleCreate    *GraphQlResponseAlertsMutingRuleCreate    `json:"alertsMutingRuleCreate"`
+	ChangeTrackingCreateEvent *GraphQlResponseChangeTrackingCreateEvent `json:"changeTrackingCreateEvent"`
+
+	AlertsNrqlConditionStaticUpdate   *NrqlCondition `json:"alertsNrqlConditionStaticUpdate"`
+	AlertsNrqlConditionBaselineUpdate *NrqlCondition `json:"alertsNrqlConditionBaselineUpdate"`
+
+	TaggingAddTagsToEntity           *GraphQlResponseTaggingMutation `json:"taggingAddTagsToEntity"`
+	TaggingDeleteTagValuesFromEntity *GraphQlResponseTaggingMutation `json:"taggingDeleteTagValuesFromEntity"`
+	TaggingDeleteTagFromEntity       *GraphQlResponseTaggingMutation `json:"taggingDeleteTagFromEntity"`
+
+	SyntheticsMonitorUpdate      *GraphQlResponseSyntheticsMutation `json:"syntheticsMonitorUpdate"`
+	SyntheticsStartAutomatedTest *struct {
+		BatchId string `json:"batchId"`
+	} `json:"syntheticsStartAutomatedTest"`
+}
+type GraphQlResponseTaggingMutation struct {
+	Errors []struct {
+		Message string `json:"message"`
+		Type    string `json:"type"`
+	} `json:"errors"`
+}
+type GraphQlResponseSyntheticsMutation struct {
+	Errors []struct {
+		Description string `json:"description"`
+		Type        string `json:"type"`
+	} `json:"errors"`
+}
+type GraphQlResponseChangeTrackingCreateEvent struct {
+	ChangeTrackingEvent *struct {
+		ChangeTrackingId string `json:"changeTrackingId"`
+	} `json:"changeTrackingEvent"`
 }
 type GraphQlResponseAlertsMutingRuleCreate struct {
 	Id string `json:"id"`
@@ -56,6 +160,7 @@ type GraphQlResponseActor struct {
 	Account      *GraphQlResponseAccount      `json:"account"`
 	Accounts     []GraphQlResponseAccounts    `json:"accounts"`
 	Entities     []GraphQlResponseEntities    `json:"entities"`
+	EntitySearch *EntitySearchResponse        `json:"entitySearch"`
 	Organization *GraphQlResponseOrganization `json:"organization"`
 }
 
@@ -75,8 +180,77 @@ type GraphQlResponseManagedAccount struct {
 	IsCanceled bool  `json:"isCanceled"`
 }
 type GraphQlResponseAccount struct {
-	Workload *WorkloadResponse `json:"workload"`
-	AiIssues *AiIssuesResponse `json:"aiIssues"`
+	Workload   *WorkloadResponse   `json:"workload"`
+	AiIssues   *AiIssuesResponse   `json:"aiIssues"`
+	Nrql       *NrqlResponse       `json:"nrql"`
+	Alerts     *AlertsResponse     `json:"alerts"`
+	Synthetics *SyntheticsResponse `json:"synthetics"`
+}
+
+type SyntheticsResponse struct {
+	AutomatedTestResult *SyntheticsAutomatedTestResult `json:"automatedTestResult"`
+}
+
+type SyntheticsAutomatedTestResult struct {
+	// Status is one of IN_PROGRESS, PASSED, FAILED or TIMED_OUT.
+	Status string                    `json:"status"`
+	Tests  []SyntheticsAutomatedTest `json:"tests"`
+}
+
+type SyntheticsAutomatedTest struct {
+	Id            string `json:"id"`
+	MonitorGuid   string `json:"monitorGuid"`
+	MonitorName   string `json:"monitorName"`
+	LocationLabel string `json:"locationLabel"`
+	// Result is one of IN_PROGRESS, SUCCESS, FAILED or TIMED_OUT.
+	Result     string `json:"result"`
+	ResultsUrl string `json:"resultsUrl"`
+	// Duration is the duration of the check in milliseconds.
+	Duration *float64 `json:"duration"`
+}
+
+type AlertsResponse struct {
+	NrqlConditionsSearch *NrqlConditionsSearchResponse `json:"nrqlConditionsSearch"`
+	PoliciesSearch       *PoliciesSearchResponse       `json:"policiesSearch"`
+}
+
+type PoliciesSearchResponse struct {
+	NextCursor *string       `json:"nextCursor"`
+	Policies   []AlertPolicy `json:"policies"`
+}
+
+type AlertPolicy struct {
+	Id                 string `json:"id"`
+	Name               string `json:"name"`
+	IncidentPreference string `json:"incidentPreference"`
+	AccountId          int64  `json:"accountId"`
+}
+
+type NrqlConditionsSearchResponse struct {
+	NextCursor     *string         `json:"nextCursor"`
+	NrqlConditions []NrqlCondition `json:"nrqlConditions"`
+}
+
+// NrqlCondition is an alert condition based on a NRQL query.
+type NrqlCondition struct {
+	Id       string `json:"id"`
+	Name     string `json:"name"`
+	Enabled  bool   `json:"enabled"`
+	PolicyId string `json:"policyId"`
+	// Type is one of STATIC, BASELINE or OUTLIER.
+	Type       string              `json:"type"`
+	EntityGuid string              `json:"entityGuid"`
+	RunbookUrl string              `json:"runbookUrl"`
+	Nrql       *NrqlConditionQuery `json:"nrql"`
+}
+
+type NrqlConditionQuery struct {
+	Query string `json:"query"`
+}
+
+type NrqlResponse struct {
+	// Results holds one object per result row, keyed by the (aliased) NRQL select items.
+	Results []map[string]any `json:"results"`
 }
 type WorkloadResponse struct {
 	Collections []Workload `json:"collections"`
@@ -106,7 +280,71 @@ type Incident struct {
 }
 
 type GraphQlResponseEntities struct {
-	Tags []GraphQlResponseTags `json:"tags"`
+	Guid      string `json:"guid"`
+	Name      string `json:"name"`
+	Permalink string `json:"permalink"`
+	AccountId int64  `json:"accountId"`
+	// Language is only reported for APM applications.
+	Language string `json:"language"`
+	// AlertSeverity is one of NOT_ALERTING, WARNING, CRITICAL or NOT_CONFIGURED. It is only
+	// reported for alertable entities and empty otherwise.
+	AlertSeverity string                `json:"alertSeverity"`
+	Tags          []GraphQlResponseTags `json:"tags"`
+	// ServiceLevel holds the service level indicators defined for the entity.
+	ServiceLevel *ServiceLevelResponse `json:"serviceLevel"`
+	// MonitorId, MonitorType, Period and MonitorSummary are only reported for synthetic monitors.
+	MonitorId      string                   `json:"monitorId"`
+	MonitorType    string                   `json:"monitorType"`
+	Period         *int64                   `json:"period"`
+	MonitorSummary *SyntheticMonitorSummary `json:"monitorSummary"`
+}
+
+type SyntheticMonitorSummary struct {
+	// Status is one of ENABLED, DISABLED, MUTED or DELETED.
+	Status      string   `json:"status"`
+	SuccessRate *float64 `json:"successRate"`
+}
+
+type ServiceLevelResponse struct {
+	Indicators []ServiceLevelIndicator `json:"indicators"`
+}
+
+type ServiceLevelIndicator struct {
+	Guid       string                  `json:"guid"`
+	Name       string                  `json:"name"`
+	Objectives []ServiceLevelObjective `json:"objectives"`
+}
+
+type ServiceLevelObjective struct {
+	// Target is the percentage of good events required, e.g. 99.5.
+	Target     float64                 `json:"target"`
+	TimeWindow *ServiceLevelTimeWindow `json:"timeWindow"`
+}
+
+type ServiceLevelTimeWindow struct {
+	Rolling *ServiceLevelRollingTimeWindow `json:"rolling"`
+}
+
+type ServiceLevelRollingTimeWindow struct {
+	Count int    `json:"count"`
+	Unit  string `json:"unit"`
+}
+
+// ServiceLevel is a service level indicator together with the entity it is defined for.
+type ServiceLevel struct {
+	Indicator  ServiceLevelIndicator
+	AccountId  int64
+	EntityGuid string
+	EntityName string
+}
+
+type EntitySearchResponse struct {
+	Results *EntitySearchResults `json:"results"`
+}
+
+type EntitySearchResults struct {
+	Entities   []GraphQlResponseEntities `json:"entities"`
+	NextCursor *string                   `json:"nextCursor"`
 }
 
 type GraphQlResponseTags struct {